@@ -0,0 +1,306 @@
+package analyser
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/helloworldpark/tickle-stock-watcher/commons"
+	"github.com/helloworldpark/tickle-stock-watcher/database"
+	"github.com/helloworldpark/tickle-stock-watcher/structs"
+)
+
+// maxDailyMove 가격제한폭 30%를 넘어 시작한 날은 기준가가 바뀐 날(분할, 병합 등)로 본다
+const maxDailyMove = 0.3
+
+// adjustmentFactor factor of prices and volumes before the ex-date
+type adjustmentFactor struct {
+	timestamp int64
+	price     float64
+	volume    float64
+}
+
+// loadCorporateActions loads corporate actions of the stocks, or of every stock if none given.
+// Returns
+//     map[string][]structs.CorporateAction   Key: Stock ID, Value: actions ordered by timestamp
+func loadCorporateActions(dbClient *database.DBClient, stockIDs ...string) (map[string][]structs.CorporateAction, error) {
+	var actions []structs.CorporateAction
+	var err error
+	if len(stockIDs) == 0 {
+		_, err = dbClient.Select(&actions, "where true order by Timestamp")
+	} else {
+		args := make([]interface{}, len(stockIDs))
+		for i := range stockIDs {
+			args[i] = stockIDs[i]
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(stockIDs)), ",")
+		_, err = dbClient.Select(&actions, "where StockID in ("+placeholders+") order by Timestamp", args...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string][]structs.CorporateAction)
+	for _, action := range actions {
+		result[action.StockID] = append(result[action.StockID], action)
+	}
+	return result, nil
+}
+
+// detectCorporateActions finds days opening beyond the daily price limit from the previous close.
+// Such days cannot happen by trading, so the base price must have been changed by a split or a merger.
+func detectCorporateActions(prices []structs.StockPrice) []structs.CorporateAction {
+	var detected []structs.CorporateAction
+	for i := 1; i < len(prices); i++ {
+		prevClose := prices[i-1].Close
+		open := prices[i].Open
+		if open <= 0 {
+			open = prices[i].Close
+		}
+		if prevClose <= 0 || open <= 0 {
+			continue
+		}
+		ratio := float64(open) / float64(prevClose)
+		if math.Abs(ratio-1) <= maxDailyMove {
+			continue
+		}
+		detected = append(detected, structs.CorporateAction{
+			StockID:   prices[i].StockID,
+			Timestamp: prices[i].Timestamp,
+			Kind:      structs.ActionDetected,
+			Value:     ratio,
+		})
+	}
+	return detected
+}
+
+// detectExDate finds the base price changed on the ex-date from the first live quote, before the daily price is collected.
+// The base price is the previous close of the quote, or its open if unknown, compared with the last collected close.
+func (a *Analyser) detectExDate(stockPrice structs.StockPrice) (structs.CorporateAction, bool) {
+	candles := a.timeSeries.Candles
+	if len(candles) < 2 {
+		return structs.CorporateAction{}, false
+	}
+	// 마지막 봉은 오늘의 봉
+	prev := candles[len(candles)-2]
+	exDate := dayStart(stockPrice.Timestamp)
+	if prev.Period.Start.Unix() >= exDate {
+		return structs.CorporateAction{}, false
+	}
+	base := stockPrice.Close - stockPrice.Change
+	if stockPrice.Change == 0 && stockPrice.Open > 0 {
+		base = stockPrice.Open
+	}
+	prevClose := prev.ClosePrice.Float()
+	if base <= 0 || prevClose <= 0 {
+		return structs.CorporateAction{}, false
+	}
+	ratio := float64(base) / a.priceScale / prevClose
+	if math.Abs(ratio-1) <= maxDailyMove {
+		return structs.CorporateAction{}, false
+	}
+	return structs.CorporateAction{
+		StockID:   a.stockID,
+		Timestamp: exDate,
+		Kind:      structs.ActionDetected,
+		Value:     ratio,
+	}, true
+}
+
+// adjustmentFactors factors of the actions, including those detected from the prices on days without actions.
+// Detected actions, stored or not, are ignored on days with splits or dividends.
+func adjustmentFactors(prices []structs.StockPrice, actions []structs.CorporateAction) []adjustmentFactor {
+	known := make(map[int64]bool)
+	for _, action := range actions {
+		if action.Kind != structs.ActionDetected {
+			known[dayStart(action.Timestamp)] = true
+		}
+	}
+	var all []structs.CorporateAction
+	for _, action := range actions {
+		if action.Kind != structs.ActionDetected || !known[dayStart(action.Timestamp)] {
+			all = append(all, action)
+			known[dayStart(action.Timestamp)] = true
+		}
+	}
+	for _, action := range detectCorporateActions(prices) {
+		if !known[dayStart(action.Timestamp)] {
+			all = append(all, action)
+		}
+	}
+
+	var factors []adjustmentFactor
+	for _, action := range all {
+		factor := adjustmentFactor{timestamp: dayStart(action.Timestamp), price: 1, volume: 1}
+		switch action.Kind {
+		case structs.ActionSplit:
+			if action.Value <= 0 {
+				continue
+			}
+			factor.price = 1 / action.Value
+			factor.volume = action.Value
+		case structs.ActionDividend:
+			prevClose := closeBefore(prices, factor.timestamp)
+			if prevClose <= action.Value || prevClose <= 0 {
+				continue
+			}
+			factor.price = 1 - action.Value/prevClose
+		case structs.ActionDetected:
+			if action.Value <= 0 {
+				continue
+			}
+			factor.price = action.Value
+			factor.volume = 1 / action.Value
+		default:
+			continue
+		}
+		factors = append(factors, factor)
+	}
+	sort.Slice(factors, func(i, j int) bool {
+		return factors[i].timestamp < factors[j].timestamp
+	})
+	return factors
+}
+
+func dayStart(timestamp int64) int64 {
+	y, m, d := commons.Unix(timestamp).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, commons.AsiaSeoul).Unix()
+}
+
+// closeBefore close of the last price before the timestamp, 0 if none
+func closeBefore(prices []structs.StockPrice, timestamp int64) float64 {
+	k := sort.Search(len(prices), func(i int) bool {
+		return prices[i].Timestamp >= timestamp
+	})
+	if k == 0 {
+		return 0
+	}
+	return float64(prices[k-1].Close)
+}
+
+// adjustPrices adjusts the prices ordered by timestamp, so that they are comparable with the latest price.
+// Returns the adjusted prices and a fingerprint of the factors applied.
+func adjustPrices(prices []structs.StockPrice, actions []structs.CorporateAction) ([]structs.StockPrice, string) {
+	factors := adjustmentFactors(prices, actions)
+	if len(factors) == 0 {
+		return prices, ""
+	}
+	fingerprint := make([]string, len(factors))
+	for i, factor := range factors {
+		fingerprint[i] = fmt.Sprintf("%d:%.6f", factor.timestamp, factor.price)
+	}
+
+	adjusted := make([]structs.StockPrice, len(prices))
+	copy(adjusted, prices)
+	// 뒤에서부터 누적
+	priceFactor, volumeFactor := 1.0, 1.0
+	k := len(factors) - 1
+	for i := len(adjusted) - 1; i >= 0; i-- {
+		for k >= 0 && adjusted[i].Timestamp < factors[k].timestamp {
+			priceFactor *= factors[k].price
+			volumeFactor *= factors[k].volume
+			k--
+		}
+		if priceFactor == 1 && volumeFactor == 1 {
+			continue
+		}
+		p := &adjusted[i]
+		p.Open = int(math.Round(float64(p.Open) * priceFactor))
+		p.High = int(math.Round(float64(p.High) * priceFactor))
+		p.Low = int(math.Round(float64(p.Low) * priceFactor))
+		p.Close = int(math.Round(float64(p.Close) * priceFactor))
+		p.Volume *= volumeFactor
+	}
+	return adjusted, strings.Join(fingerprint, ",")
+}
+
+// adjustedPrices adjusts the prices of the stock with its corporate actions stored in DB
+func adjustedPrices(dbClient *database.DBClient, stockID string, prices []structs.StockPrice) ([]structs.StockPrice, string, error) {
+	actions, err := loadCorporateActions(dbClient, stockID)
+	if err != nil {
+		return prices, "", err
+	}
+	adjusted, fingerprint := adjustPrices(prices, actions[stockID])
+	return adjusted, fingerprint, nil
+}
+
+// LoadCorporateActionsCSV reads corporate actions, one in a line: Stock ID,date(2006-01-02),kind,value
+// Kinds are split and dividend, see structs.CorporateAction.
+func LoadCorporateActionsCSV(r io.Reader) ([]structs.CorporateAction, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var actions []structs.CorporateAction
+	for i, record := range records {
+		if len(record) != 4 {
+			return nil, newError(fmt.Sprintf("Invalid corporate action at line %d: need 4 columns, got %d", i+1, len(record)))
+		}
+		timestamp, err := commons.ParseTimestamp("2006-01-02", record[1])
+		if err != nil {
+			return nil, newError(fmt.Sprintf("Invalid date at line %d: %v", i+1, err))
+		}
+		kind := strings.ToLower(strings.TrimSpace(record[2]))
+		if kind != structs.ActionSplit && kind != structs.ActionDividend {
+			return nil, newError(fmt.Sprintf("Invalid kind at line %d: %s", i+1, record[2]))
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(record[3]), 64)
+		if err != nil || value <= 0 {
+			return nil, newError(fmt.Sprintf("Invalid value at line %d: %s", i+1, record[3]))
+		}
+		actions = append(actions, structs.CorporateAction{
+			StockID:   strings.TrimSpace(record[0]),
+			Timestamp: timestamp,
+			Kind:      kind,
+			Value:     value,
+		})
+	}
+	return actions, nil
+}
+
+// ParseCorporateAction parses a corporate action of the stock: date(2006-01-02), kind and value, see LoadCorporateActionsCSV
+func ParseCorporateAction(stockID, date, kind, value string) (structs.CorporateAction, error) {
+	actions, err := LoadCorporateActionsCSV(strings.NewReader(strings.Join([]string{stockID, date, kind, value}, ",")))
+	if err != nil {
+		return structs.CorporateAction{}, err
+	}
+	return actions[0], nil
+}
+
+// StoreCorporateActions stores the corporate actions
+func StoreCorporateActions(dbClient *database.DBClient, actions []structs.CorporateAction) error {
+	if len(actions) == 0 {
+		return nil
+	}
+	rows := make([]interface{}, len(actions))
+	for i := range actions {
+		rows[i] = &actions[i]
+	}
+	_, err := dbClient.Upsert(rows...)
+	return err
+}
+
+// ImportCorporateActions stores the corporate actions in the CSV file, see LoadCorporateActionsCSV
+func ImportCorporateActions(dbClient *database.DBClient, path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	actions, err := LoadCorporateActionsCSV(file)
+	if err != nil || len(actions) == 0 {
+		return 0, err
+	}
+	if err := StoreCorporateActions(dbClient, actions); err != nil {
+		return 0, err
+	}
+	return len(actions), nil
+}
@@ -0,0 +1,128 @@
+package analyser
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/helloworldpark/tickle-stock-watcher/commons"
+	"github.com/helloworldpark/tickle-stock-watcher/structs"
+)
+
+func newSplitPrices() []structs.StockPrice {
+	monday := time.Date(2018, time.April, 30, 0, 0, 0, 0, commons.AsiaSeoul)
+	prices := newWeekdayPrices("005930", monday, 6)
+	// 4번째 날부터 1:50 분할
+	for i := 3; i < len(prices); i++ {
+		prices[i].Open /= 50
+		prices[i].Close /= 50
+		prices[i].High /= 50
+		prices[i].Low /= 50
+		prices[i].Volume *= 50
+	}
+	return prices
+}
+
+func TestDetectCorporateActions(t *testing.T) {
+	prices := newSplitPrices()
+	detected := detectCorporateActions(prices)
+	if len(detected) != 1 || detected[0].Timestamp != prices[3].Timestamp {
+		t.Fatalf("Expected a split on the 4th day, got %+v", detected)
+	}
+
+	adjusted, fingerprint := adjustPrices(prices, nil)
+	if len(fingerprint) == 0 {
+		t.Error("Expected a fingerprint of the detected split")
+	}
+	// 분할 전 가격이 분할 후 가격과 이어진다
+	if c := adjusted[2].Close; c < 19 || c > 22 {
+		t.Errorf("Expected adjusted close near 20, got %d", c)
+	}
+	if prices[2].Close != 1020 {
+		t.Error("Raw prices must not be modified")
+	}
+	if adjusted[5] != prices[5] {
+		t.Errorf("Prices after the split must be kept, got %+v", adjusted[5])
+	}
+}
+
+func TestAdjustPricesWithActions(t *testing.T) {
+	prices := newSplitPrices()
+	actions := []structs.CorporateAction{
+		{StockID: "005930", Timestamp: prices[3].Timestamp, Kind: structs.ActionSplit, Value: 50},
+		{StockID: "005930", Timestamp: prices[5].Timestamp, Kind: structs.ActionDividend, Value: 1.01},
+	}
+	adjusted, _ := adjustPrices(prices, actions)
+
+	// 배당 1.01원 / 전일 종가 20.2원 = 5% 조정, 분할 1/50
+	expected := structs.StockPrice{StockID: "005930", Timestamp: prices[0].Timestamp, Open: 19, Close: 19, High: 19, Low: 19, Volume: 5000}
+	if adjusted[0] != expected {
+		t.Errorf("Expected %+v, got %+v", expected, adjusted[0])
+	}
+	if c := adjusted[4].Close; c != 19 {
+		t.Errorf("Expected dividend adjusted close 19, got %d", c)
+	}
+	if adjusted[5] != prices[5] {
+		t.Errorf("Prices on the ex-date must be kept, got %+v", adjusted[5])
+	}
+}
+
+func TestAdjustPricesWithStoredDetection(t *testing.T) {
+	prices := newSplitPrices()
+	// 시세에서 찾아 저장한 기준가 변경과 나중에 들어온 분할이 겹치면 분할만 적용한다
+	actions := []structs.CorporateAction{
+		{StockID: "005930", Timestamp: prices[3].Timestamp, Kind: structs.ActionDetected, Value: 0.02},
+		{StockID: "005930", Timestamp: prices[3].Timestamp, Kind: structs.ActionSplit, Value: 50},
+	}
+	adjusted, fingerprint := adjustPrices(prices, actions)
+	if strings.Count(fingerprint, ":") != 1 {
+		t.Errorf("Expected a single factor, got %s", fingerprint)
+	}
+	if c := adjusted[2].Close; c < 19 || c > 22 {
+		t.Errorf("Expected adjusted close near 20, got %d", c)
+	}
+}
+
+func TestDetectExDate(t *testing.T) {
+	monday := time.Date(2018, time.April, 30, 0, 0, 0, 0, commons.AsiaSeoul)
+	ana := NewAnalyser("005930")
+	for _, price := range newWeekdayPrices("005930", monday, 3) {
+		ana.AppendPastPrice(price)
+	}
+	ana.prepareWatching(commons.Now())
+
+	// 전일 종가 1020원, 1:50 분할 후 기준가 20원
+	quote := structs.StockPrice{StockID: "005930", Timestamp: commons.Now().Unix(), Close: 21, Change: 1}
+	action, ok := ana.detectExDate(quote)
+	if !ok || action.Kind != structs.ActionDetected || action.Timestamp != commons.Today().Unix() {
+		t.Fatalf("Expected the ex-date today, got %+v", action)
+	}
+	if action.Value < 0.019 || action.Value > 0.02 {
+		t.Errorf("Expected ratio near 1/50, got %f", action.Value)
+	}
+
+	quote = structs.StockPrice{StockID: "005930", Timestamp: commons.Now().Unix(), Close: 1100, Change: 80}
+	if _, ok := ana.detectExDate(quote); ok {
+		t.Error("Expected no ex-date within the daily price limit")
+	}
+	quote = structs.StockPrice{StockID: "005930", Timestamp: commons.Now().Unix(), Open: 20, Close: 21}
+	if _, ok := ana.detectExDate(quote); !ok {
+		t.Error("Expected the ex-date from the open without the change")
+	}
+}
+
+func TestLoadCorporateActionsCSV(t *testing.T) {
+	csv := "# Stock ID, date, kind, value\n005930,2018-05-04,split,50\n005930, 2019-12-27, Dividend, 354\n"
+	actions, err := LoadCorporateActionsCSV(strings.NewReader(csv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 2 || actions[0].Kind != structs.ActionSplit || actions[1].Kind != structs.ActionDividend || actions[1].Value != 354 {
+		t.Errorf("Unexpected actions: %+v", actions)
+	}
+	for _, invalid := range []string{"005930,2018-05-04,split", "005930,2018/05/04,split,50", "005930,2018-05-04,merger,2", "005930,2018-05-04,split,-1"} {
+		if _, err := LoadCorporateActionsCSV(strings.NewReader(invalid)); err == nil {
+			t.Errorf("%s: expected error", invalid)
+		}
+	}
+}
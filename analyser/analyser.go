@@ -1,10 +1,13 @@
 package analyser
 
 import (
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/helloworldpark/govaluate"
 	"github.com/helloworldpark/tickle-stock-watcher/commons"
+	"github.com/helloworldpark/tickle-stock-watcher/logger"
 	"github.com/helloworldpark/tickle-stock-watcher/structs"
 	"github.com/sdcoffey/big"
 	"github.com/sdcoffey/techan"
@@ -17,8 +20,10 @@ type ruleGen = func(...interface{}) (techan.Rule, error)
 type uid = int64
 
 type eventWrapper struct {
-	repeat bool
-	event  EventTrigger
+	repeat   bool
+	event    EventTrigger
+	strategy structs.UserStock // To create the event again
+	callback EventCallback
 }
 
 const (
@@ -30,9 +35,16 @@ const (
 type Analyser struct {
 	userStrategy map[uid]map[techan.OrderSide]eventWrapper
 	timeSeries   *techan.TimeSeries
+	intraday     map[string]*techan.TimeSeries // Key: Time frame, i.e. 15m
+	periodic     map[string]*techan.TimeSeries // Key: Time frame, i.e. w, aggregated from timeSeries
+	lastIntraday structs.IntradayPrice
 	counter      *commons.Ref
 	stockID      string
+	priceScale   float64 // Prices are divided by this, i.e. structs.IndexPriceScale for indices
 	isWatching   bool
+	adjustment   string               // Fingerprint of the corporate actions the past prices are adjusted by
+	refs         map[string]*Analyser // Key: Stock ID, analysers of other instruments strategies refer to
+	mutex        *sync.RWMutex        // Guards the candles and the strategies, read-locked while evaluated
 }
 
 // NewAnalyser creates and returns a pointer of a new prepared Analyser struct
@@ -40,8 +52,13 @@ func NewAnalyser(stockID string) *Analyser {
 	newAnalyser := Analyser{}
 	newAnalyser.userStrategy = make(map[uid]map[techan.OrderSide]eventWrapper)
 	newAnalyser.timeSeries = techan.NewTimeSeries()
+	newAnalyser.intraday = make(map[string]*techan.TimeSeries)
+	newAnalyser.periodic = make(map[string]*techan.TimeSeries)
+	newAnalyser.refs = make(map[string]*Analyser)
+	newAnalyser.mutex = &sync.RWMutex{}
 	newAnalyser.counter = &commons.Ref{}
 	newAnalyser.stockID = stockID
+	newAnalyser.priceScale = structs.PriceScale(stockID)
 	newAnalyser.isWatching = false
 	return &newAnalyser
 }
@@ -68,17 +85,7 @@ func (a *Analyser) Count() int {
 // AppendStrategy Appends strategy with callback
 func (a *Analyser) AppendStrategy(strategy structs.UserStock, callback EventCallback) (bool, error) {
 	// First, parse tokens
-	tmpTokens, err := parseTokens(strategy.Strategy)
-	if err != nil {
-		return false, err
-	}
-
-	newTokens, err := tidyTokens(tmpTokens)
-	if err != nil {
-		return false, err
-	}
-
-	postfixToken, err := reorderTokenByPostfix(newTokens)
+	postfixToken, err := parseStrategy(strategy.Strategy)
 	if err != nil {
 		return false, err
 	}
@@ -91,7 +98,7 @@ func (a *Analyser) AppendStrategy(strategy structs.UserStock, callback EventCall
 	}
 
 	// Cache into map
-	userStrategy := eventWrapper{repeat: strategy.Repeat, event: event}
+	userStrategy := eventWrapper{repeat: strategy.Repeat, event: event, strategy: strategy, callback: callback}
 	strategies, ok := a.userStrategy[strategy.UserID]
 	if !ok {
 		a.userStrategy[strategy.UserID] = make(map[techan.OrderSide]eventWrapper)
@@ -121,16 +128,72 @@ func (a *Analyser) DeleteStrategy(userid int64, orderside techan.OrderSide) {
 
 // CalculateStrategies calculates strategies from the last candle
 func (a *Analyser) CalculateStrategies() {
+	for _, triggered := range a.triggeredStrategies() {
+		triggered.fire()
+	}
+}
+
+// triggeredEvent a strategy satisfied at the last candle, to be fired after the analysers are unlocked
+type triggeredEvent struct {
+	event     eventWrapper
+	price     structs.StockPrice
+	orderSide techan.OrderSide
+	userID    uid
+}
+
+func (t triggeredEvent) fire() {
+	t.event.event.OnEvent(t.price, int(t.orderSide), t.userID, t.event.repeat)
+}
+
+// triggeredStrategies finds the strategies satisfied at the last candle without firing them
+func (a *Analyser) triggeredStrategies() []triggeredEvent {
+	var result []triggeredEvent
 	price := candleToStockPrice(a.stockID, a.timeSeries.LastCandle(), true)
 	for userid, events := range a.userStrategy {
 		for orderside, event := range events {
 			if event.event.IsTriggered(a.timeSeries.LastIndex(), nil) {
-				event.event.OnEvent(price, int(orderside), userid, event.repeat)
+				result = append(result, triggeredEvent{event: event, price: price, orderSide: orderside, userID: userid})
+			}
+		}
+	}
+	return result
+}
+
+// lockAnalysers locks the analysers in the order of their stock IDs, so that analysers locked together never deadlock.
+// Returns the function unlocking them.
+func lockAnalysers(analysers []*Analyser, write bool) func() {
+	sorted := make([]*Analyser, len(analysers))
+	copy(sorted, analysers)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].stockID < sorted[j].stockID
+	})
+	for _, a := range sorted {
+		if write {
+			a.mutex.Lock()
+		} else {
+			a.mutex.RLock()
+		}
+	}
+	return func() {
+		for i := len(sorted) - 1; i >= 0; i-- {
+			if write {
+				sorted[i].mutex.Unlock()
+			} else {
+				sorted[i].mutex.RUnlock()
 			}
 		}
 	}
 }
 
+// withReferences the analyser and the analysers of the instruments it refers to, to be locked together
+func (a *Analyser) withReferences() []*Analyser {
+	result := []*Analyser{a}
+	for _, ref := range a.refs {
+		result = append(result, ref)
+	}
+	return result
+}
+
 func (a *Analyser) hasStrategyOfOrderSide(userid uid, orderside int) bool {
 	events, ok := a.userStrategy[userid]
 	if !ok {
@@ -144,29 +207,108 @@ func (a *Analyser) hasStrategyOfOrderSide(userid uid, orderside int) bool {
  * Price-watching
  */
 
-func (a *Analyser) prepareWatching() {
-	newCandle := techan.NewCandle(techan.NewTimePeriod(commons.Today(), time.Hour*24))
+// prepareWatching appends the live candle of the day of now
+func (a *Analyser) prepareWatching(now time.Time) {
+	y, m, d := now.In(commons.AsiaSeoul).Date()
+	newCandle := techan.NewCandle(techan.NewTimePeriod(time.Date(y, m, d, 0, 0, 0, 0, commons.AsiaSeoul), time.Hour*24))
 	a.timeSeries.AddCandle(newCandle)
 	if len(a.timeSeries.Candles) > maxCandles {
 		a.timeSeries.Candles = a.timeSeries.Candles[len(a.timeSeries.Candles)-maxCandles:]
 	}
 }
 
+// resetPastPrices clears the daily candles and those aggregated from them, so that they can be loaded again.
+// Returns the live candle if watching.
+func (a *Analyser) resetPastPrices() *techan.Candle {
+	var live *techan.Candle
+	if a.isWatching {
+		live = a.timeSeries.LastCandle()
+	}
+	a.timeSeries.Candles = nil
+	for _, series := range a.periodic {
+		series.Candles = nil
+	}
+	return live
+}
+
+// restoreLiveCandle puts back the live candle after the past prices are loaded again
+func (a *Analyser) restoreLiveCandle(live *techan.Candle) {
+	if a.timeSeries.AddCandle(live) {
+		a.syncPeriodic(live)
+	}
+}
+
+// rebuildStrategies creates the events again, since indicators may cache values by the index of candles
+func (a *Analyser) rebuildStrategies() {
+	for _, strategies := range a.userStrategy {
+		for orderSide, wrapper := range strategies {
+			postfixToken, err := parseStrategy(wrapper.strategy.Strategy)
+			if err != nil {
+				continue
+			}
+			event, err := a.createEvent(postfixToken, orderSide, wrapper.callback)
+			if err != nil {
+				logger.Error("[Analyser] Error while rebuilding strategy %s of %s: %+v", wrapper.strategy.Strategy, a.stockID, err)
+				continue
+			}
+			wrapper.event = event
+			strategies[orderSide] = wrapper
+		}
+	}
+}
+
 func (a *Analyser) isWatchingPrice() bool {
 	return a.isWatching
 }
 
+// watchPrice updates the live candle with the intraday snapshot
+// Open, high and low missing in the snapshot are assembled from the prices watched so far.
 func (a *Analyser) watchPrice(stockPrice structs.StockPrice) {
 	a.isWatching = true
 	lastCandle := a.timeSeries.LastCandle()
-	lastCandle.ClosePrice = big.NewDecimal(float64(stockPrice.Close))
+	closePrice := a.price(stockPrice.Close)
+	open := closePrice
+	if stockPrice.Open > 0 {
+		open = a.price(stockPrice.Open)
+	}
+	high := closePrice
+	if stockPrice.High > 0 {
+		high = a.price(stockPrice.High)
+	}
+	low := closePrice
+	if stockPrice.Low > 0 {
+		low = a.price(stockPrice.Low)
+	}
+
+	if lastCandle.OpenPrice.Zero() || stockPrice.Open > 0 {
+		lastCandle.OpenPrice = open
+	}
+	if lastCandle.MaxPrice.Zero() || high.GT(lastCandle.MaxPrice) {
+		lastCandle.MaxPrice = high
+	}
+	if lastCandle.MinPrice.Zero() || low.LT(lastCandle.MinPrice) {
+		lastCandle.MinPrice = low
+	}
+	lastCandle.ClosePrice = closePrice
+	// 거래량은 당일 누적
+	if stockPrice.Volume > 0 {
+		lastCandle.Volume = big.NewDecimal(stockPrice.Volume)
+	}
 	lastCandle.Period.End = commons.Unix(stockPrice.Timestamp)
+
+	a.syncPeriodic(lastCandle)
+	a.AppendIntradayPrice(structs.NewIntradayPrice(stockPrice))
 }
 
 func (a *Analyser) stopWatchingPrice() {
 	a.isWatching = false
 }
 
+// price the stored price in the unit of the candles, i.e. points for indices
+func (a *Analyser) price(stored int) big.Decimal {
+	return big.NewDecimal(float64(stored) / a.priceScale)
+}
+
 // AppendPastPrice appends price into the time series
 func (a *Analyser) AppendPastPrice(stockPrice structs.StockPrice) {
 	var lastTimestamp int64
@@ -183,14 +325,15 @@ func (a *Analyser) AppendPastPrice(stockPrice structs.StockPrice) {
 		start := commons.Unix(stockPrice.Timestamp)
 		candle = techan.NewCandle(techan.NewTimePeriod(start, time.Hour*24))
 	}
-	candle.OpenPrice = big.NewDecimal(float64(stockPrice.Open))
-	candle.ClosePrice = big.NewDecimal(float64(stockPrice.Close))
-	candle.MaxPrice = big.NewDecimal(float64(stockPrice.High))
-	candle.MinPrice = big.NewDecimal(float64(stockPrice.Low))
+	candle.OpenPrice = a.price(stockPrice.Open)
+	candle.ClosePrice = a.price(stockPrice.Close)
+	candle.MaxPrice = a.price(stockPrice.High)
+	candle.MinPrice = a.price(stockPrice.Low)
 	candle.Volume = big.NewDecimal(float64(stockPrice.Volume))
 	if a.timeSeries.AddCandle(candle) && len(a.timeSeries.Candles) > maxCandles {
 		a.timeSeries.Candles = a.timeSeries.Candles[(len(a.timeSeries.Candles) - maxCandles):]
 	}
+	a.syncPeriodic(candle)
 }
 
 // NeedPriceFrom calculates timestamp from when to fetch coin price data.
@@ -3,7 +3,9 @@ package analyser
 import (
 	"bytes"
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/helloworldpark/tickle-stock-watcher/commons"
 	"github.com/helloworldpark/tickle-stock-watcher/database"
@@ -20,8 +22,9 @@ type User = structs.User
 type UserStock = structs.UserStock
 
 type analyserHolder struct {
-	analyser *Analyser
-	sentinel chan struct{}
+	analyser    *Analyser
+	sentinel    chan struct{}
+	recalculate chan struct{} // Signals the feeding goroutine to calculate the strategies again, i.e. on prices of the references
 }
 
 // BrokerAccess give access to broker
@@ -31,10 +34,12 @@ type BrokerAccess interface {
 
 // Broker is an Analysis Manager
 type Broker struct {
-	analysers map[string]*analyserHolder // Key: Stock ID, Value: Analyser Holder
-	users     map[int64]map[string]bool  // Key: User ID, Value: Stock ID set
-	dbClient  *database.DBClient
-	mutex     *sync.Mutex
+	analysers   map[string]*analyserHolder // Key: Stock ID, Value: Analyser Holder
+	users       map[int64]map[string]bool  // Key: User ID, Value: Stock ID set
+	dbClient    *database.DBClient
+	mutex       *sync.Mutex
+	onReference func(stockID string, retained bool) // Called whenever an instrument is referred or released by an analyser
+	now         func() time.Time                    // Clock of the live candles, i.e. the replay clock while replaying
 }
 
 // NewBroker creates a new initialized pointer of Broker
@@ -44,16 +49,33 @@ func NewBroker(dbClient *database.DBClient) *Broker {
 	newBroker.dbClient = dbClient
 	newBroker.users = make(map[int64]map[string]bool)
 	newBroker.mutex = &sync.Mutex{}
+	newBroker.now = commons.Now
 
 	return &newBroker
 }
 
+// SetClock sets the clock which dates the live candles, i.e. the replay clock while replaying
+func (b *Broker) SetClock(now func() time.Time) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.now = now
+}
+
+// SetReferenceHandler sets the handler called whenever an analyser starts or stops referring to another instrument,
+// i.e. to watch the price of the instrument as long as referred.
+func (b *Broker) SetReferenceHandler(handler func(stockID string, retained bool)) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.onReference = handler
+}
+
 func newHolder(stockID string) *analyserHolder {
 	newAnalyser := NewAnalyser(stockID)
 	newAnalyser.Retain()
 	holder := analyserHolder{
-		analyser: newAnalyser,
-		sentinel: make(chan struct{}),
+		analyser:    newAnalyser,
+		sentinel:    make(chan struct{}),
+		recalculate: make(chan struct{}, 1),
 	}
 	return &holder
 }
@@ -74,7 +96,10 @@ func (b *Broker) AddStrategy(userStrategy UserStock, callback EventCallback, upd
 		if userOK {
 			// 이 주식은 다른 사람이 전략을 넣은 적이 있고, 이 유저도 넣는 경우이다
 			// 만일 이전에 넣은 적이 없는 Order Side라면, Retain한다
-			if !holder.analyser.hasStrategyOfOrderSide(userStrategy.UserID, userStrategy.OrderSide) {
+			holder.analyser.mutex.RLock()
+			hasStrategy := holder.analyser.hasStrategyOfOrderSide(userStrategy.UserID, userStrategy.OrderSide)
+			holder.analyser.mutex.RUnlock()
+			if !hasStrategy {
 				b.mutex.Lock()
 				holder.analyser.Retain()
 				b.mutex.Unlock()
@@ -114,20 +139,21 @@ func (b *Broker) AddStrategy(userStrategy UserStock, callback EventCallback, upd
 
 	// Add or update strategy of the analyser
 	b.mutex.Lock()
-	ok, err := b.analysers[userStrategy.StockID].analyser.AppendStrategy(userStrategy, callback)
+	// 다른 종목, 지수를 참조하면 그 분석기도 불러와 둔다
+	if refs, err := ReferencedInstruments(userStrategy.Strategy); err == nil {
+		b.retainReferences(holder, refs)
+	}
+	unlock := lockAnalysers(holder.analyser.withReferences(), true)
+	intradayBefore := len(holder.analyser.intraday)
+	ok, err := holder.analyser.AppendStrategy(userStrategy, callback)
+	needsIntraday := len(holder.analyser.intraday) > intradayBefore
+	unlock()
+	if ok || !didRetainAnalyser || !b.releaseHolder(userStrategy.StockID, holder) {
+		// 바뀐 전략이 더 이상 참조하지 않는 종목은 놓아준다
+		b.pruneReferences(holder)
+	}
 	b.mutex.Unlock()
 	if !ok {
-		if didRetainAnalyser {
-			b.mutex.Lock()
-			holder.analyser.Release()
-			if holder.analyser.Count() <= 0 {
-				// Deactivate analyser
-				close(holder.sentinel)
-				// Delete analyser from list
-				delete(b.analysers, userStrategy.StockID)
-			}
-			b.mutex.Unlock()
-		}
 		didRetainAnalyser = false
 		return didRetainAnalyser, err
 	}
@@ -138,7 +164,8 @@ func (b *Broker) AddStrategy(userStrategy UserStock, callback EventCallback, upd
 	}
 
 	// Update stock price if needed
-	if !stockOK {
+	// 새로운 분봉이 필요해도 장중 시세를 불러온다
+	if !stockOK || needsIntraday {
 		b.UpdatePastPriceOfStock(userStrategy.StockID)
 	}
 	return didRetainAnalyser, err
@@ -148,21 +175,13 @@ func (b *Broker) AddStrategy(userStrategy UserStock, callback EventCallback, upd
 // Analyser will be destroyed only if there are no need to manage it.
 func (b *Broker) DeleteStrategy(user User, stockID string, orderSide int) error {
 	// Handle analysers
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
 	holder, ok := b.analysers[stockID]
-	if ok {
-		b.mutex.Lock()
-		holder.analyser.Release()
-		if holder.analyser.Count() <= 0 {
-			// Deactivate analyser
-			close(holder.sentinel)
-			logger.Info("[Analyser] Closed sentinel %s", stockID)
-			// Delete analyser from list
-			delete(b.analysers, stockID)
-		} else {
-			holder.analyser.DeleteStrategy(user.UserID, techan.OrderSide(orderSide))
-		}
-		defer b.mutex.Unlock()
-	} else {
+	// 정지된 전략은 분석기에 없다
+	if ok && b.hasStrategy(holder, user.UserID, orderSide) {
+		b.deleteStrategyOfHolder(holder, user.UserID, orderSide)
+	} else if !b.isSuspended(user.UserID, stockID, orderSide) {
 		return newError(fmt.Sprintf("Trying to delete an analyser which was not registered for stock ID %s", stockID))
 	}
 
@@ -171,6 +190,156 @@ func (b *Broker) DeleteStrategy(user User, stockID string, orderSide int) error
 	return err
 }
 
+// SuspendStrategy takes the strategy out of its analyser but keeps it in DB as suspended, i.e. while the stock is not listed.
+// Resume it by AddStrategy.
+func (b *Broker) SuspendStrategy(userStrategy UserStock) error {
+	b.mutex.Lock()
+	if holder, ok := b.analysers[userStrategy.StockID]; ok && b.hasStrategy(holder, userStrategy.UserID, userStrategy.OrderSide) {
+		b.deleteStrategyOfHolder(holder, userStrategy.UserID, userStrategy.OrderSide)
+	}
+	b.mutex.Unlock()
+
+	userStrategy.Suspended = true
+	_, err := b.dbClient.Upsert(&userStrategy)
+	return err
+}
+
+// hasStrategy checks if the analyser of the holder has the strategy of the user
+func (b *Broker) hasStrategy(holder *analyserHolder, userID int64, orderSide int) bool {
+	holder.analyser.mutex.RLock()
+	defer holder.analyser.mutex.RUnlock()
+	return holder.analyser.hasStrategyOfOrderSide(userID, orderSide)
+}
+
+// deleteStrategyOfHolder releases the holder for the strategy, deleting the strategy if the holder survives.
+// Mutex must be locked.
+func (b *Broker) deleteStrategyOfHolder(holder *analyserHolder, userID int64, orderSide int) {
+	if b.releaseHolder(holder.analyser.stockID, holder) {
+		return
+	}
+	holder.analyser.mutex.Lock()
+	holder.analyser.DeleteStrategy(userID, techan.OrderSide(orderSide))
+	holder.analyser.mutex.Unlock()
+	b.pruneReferences(holder)
+}
+
+// isSuspended checks if the strategy is suspended in DB, thus not in any analyser
+func (b *Broker) isSuspended(userID int64, stockID string, orderSide int) bool {
+	var suspended []UserStock
+	_, err := b.dbClient.Select(&suspended, "where UserID=? and StockID=? and OrderSide=? and Suspended=?", userID, stockID, orderSide, true)
+	if err != nil {
+		logger.Error("[Analyser] Error while selecting suspended strategy from database: %s", err.Error())
+	}
+	return len(suspended) > 0
+}
+
+// retainReferences links the analysers of the instruments to the holder, creating and loading them if needed.
+// A referenced analyser is retained once for each analyser linking it. Mutex must be locked.
+func (b *Broker) retainReferences(holder *analyserHolder, stockIDs []string) {
+	for _, stockID := range stockIDs {
+		if _, ok := holder.analyser.refs[stockID]; ok || stockID == holder.analyser.stockID {
+			continue
+		}
+		ref, ok := b.analysers[stockID]
+		if ok {
+			ref.analyser.Retain()
+		} else {
+			ref = newHolder(stockID)
+			b.analysers[stockID] = ref
+			b.updatePastPriceOfStockImpl(stockID, ref)
+		}
+		holder.analyser.linkReference(stockID, ref.analyser)
+		logger.Info("[Analyser] %s refers to %s: Referred %d times", holder.analyser.stockID, stockID, ref.analyser.Count())
+		if b.onReference != nil {
+			b.onReference(stockID, true)
+		}
+	}
+}
+
+// releaseReference unlinks the instrument from the holder and releases its analyser. Mutex must be locked.
+func (b *Broker) releaseReference(holder *analyserHolder, stockID string) {
+	delete(holder.analyser.refs, stockID)
+	if ref, ok := b.analysers[stockID]; ok {
+		b.releaseHolder(stockID, ref)
+	}
+	logger.Info("[Analyser] %s stopped referring to %s", holder.analyser.stockID, stockID)
+	if b.onReference != nil {
+		b.onReference(stockID, false)
+	}
+}
+
+// pruneReferences releases the instruments none of the strategies of the holder refers to any more.
+// Mutex must be locked.
+func (b *Broker) pruneReferences(holder *analyserHolder) {
+	needed := holder.analyser.referencedByStrategies()
+	for stockID := range holder.analyser.refs {
+		if !needed[stockID] {
+			b.releaseReference(holder, stockID)
+		}
+	}
+}
+
+// releaseHolder releases the analyser, and destroys it with its references if nothing needs it.
+// Returns true if destroyed. Mutex must be locked.
+func (b *Broker) releaseHolder(stockID string, holder *analyserHolder) bool {
+	holder.analyser.Release()
+	if holder.analyser.Count() > 0 {
+		return false
+	}
+	// Deactivate analyser
+	close(holder.sentinel)
+	logger.Info("[Analyser] Closed sentinel %s", stockID)
+	// Delete analyser from list
+	delete(b.analysers, stockID)
+	for refID := range holder.analyser.refs {
+		b.releaseReference(holder, refID)
+	}
+	return true
+}
+
+// ReferencedStocks stock IDs of the analysers referred by the others, which need their prices fed as well
+func (b *Broker) ReferencedStocks() []string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	set := make(map[string]bool)
+	for _, holder := range b.analysers {
+		for stockID := range holder.analyser.refs {
+			set[stockID] = true
+		}
+	}
+	result := make([]string, 0, len(set))
+	for stockID := range set {
+		result = append(result, stockID)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// dependentsOf holders of the analysers referring to the stock
+func (b *Broker) dependentsOf(stockID string) []*analyserHolder {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	var result []*analyserHolder
+	for _, holder := range b.analysers {
+		if _, ok := holder.analyser.refs[stockID]; ok {
+			result = append(result, holder)
+		}
+	}
+	return result
+}
+
+// rebuildDependents creates the strategies referring to the stock again, after its past prices are loaded again.
+// Mutex must be locked.
+func (b *Broker) rebuildDependents(stockID string) {
+	for _, holder := range b.analysers {
+		if _, ok := holder.analyser.refs[stockID]; ok {
+			unlock := lockAnalysers(holder.analyser.withReferences(), true)
+			holder.analyser.rebuildStrategies()
+			unlock()
+		}
+	}
+}
+
 // GetStrategy gets strategy of a specific user.
 func (b *Broker) GetStrategy(user User) []UserStock {
 	var result []UserStock
@@ -190,12 +359,25 @@ func (b *Broker) CanFeedPrice(stockID string) bool {
 		logger.Warn("[Analyser] Attempt to feed price of nonexisting stock ID: %s", stockID)
 		return false
 	}
-	b.mutex.Lock()
+	holder.analyser.mutex.RLock()
 	isWatching := holder.analyser.isWatchingPrice()
-	b.mutex.Unlock()
+	holder.analyser.mutex.RUnlock()
 	return !isWatching
 }
 
+// NeedsIntradayPrice checks if the strategies of the stock use intraday time frames
+func (b *Broker) NeedsIntradayPrice(stockID string) bool {
+	b.mutex.Lock()
+	holder, ok := b.analysers[stockID]
+	b.mutex.Unlock()
+	if !ok {
+		return false
+	}
+	holder.analyser.mutex.RLock()
+	defer holder.analyser.mutex.RUnlock()
+	return len(holder.analyser.intraday) > 0
+}
+
 // FeedPrice is a function for updating the latest stock price.
 func (b *Broker) FeedPrice(stockID string, provider <-chan structs.StockPrice) {
 	canFeed := b.CanFeedPrice(stockID)
@@ -210,19 +392,74 @@ func (b *Broker) FeedPrice(stockID string, provider <-chan structs.StockPrice) {
 	}
 	b.mutex.Lock()
 	holder := b.analysers[stockID]
-	holder.analyser.prepareWatching()
+	sentinel := holder.sentinel
+	holder.analyser.mutex.Lock()
+	holder.analyser.prepareWatching(b.now())
+	holder.analyser.mutex.Unlock()
 	b.mutex.Unlock()
+	// 참조하는 종목의 가격도 함께 읽으므로 같이 잠그고, 전략이 걸리면 잠금을 푼 뒤에 알린다
+	calculate := func() {
+		b.mutex.Lock()
+		analysers := holder.analyser.withReferences()
+		b.mutex.Unlock()
+		unlock := lockAnalysers(analysers, false)
+		triggered := holder.analyser.triggeredStrategies()
+		unlock()
+		for _, t := range triggered {
+			t.fire()
+		}
+	}
 	funcWork := func() {
 		defer func() {
+			holder.analyser.mutex.Lock()
 			holder.analyser.stopWatchingPrice()
+			holder.analyser.mutex.Unlock()
 			logger.Info("[Analyser] Stop watching price: %s", stockID)
 		}()
+		hasPrice := false
+		checkedExDate := false
 		for {
 			select {
-			case price := <-provider:
+			case price, ok := <-provider:
+				if !ok {
+					logger.Info("[Analyser] Provider closed: %s", stockID)
+					return
+				}
+				if price.Close <= 0 {
+					logger.Warn("[Analyser] Skipping invalid price of %s: %+v", stockID, price)
+					continue
+				}
+				holder.analyser.mutex.Lock()
 				holder.analyser.watchPrice(price)
-				holder.analyser.CalculateStrategies()
-			case <-holder.sentinel:
+				var exDate structs.CorporateAction
+				isExDate := false
+				if !checkedExDate {
+					exDate, isExDate = holder.analyser.detectExDate(price)
+					checkedExDate = true
+				}
+				holder.analyser.mutex.Unlock()
+				hasPrice = true
+				// 분할, 병합 등으로 기준가가 바뀌었으면 장 마감 후 수집을 기다리지 않고 지난 가격을 맞춘다
+				if isExDate {
+					logger.Info("[Analyser] Detected ex-date of %s from the quote: %f", stockID, exDate.Value)
+					if err := b.AddCorporateActions([]structs.CorporateAction{exDate}); err != nil {
+						logger.Error("[Analyser] Error while storing ex-date of %s: %s", stockID, err.Error())
+					}
+				}
+				calculate()
+				// 이 종목을 참조하는 전략들은 각자의 고루틴에서 다시 계산한다
+				for _, dependent := range b.dependentsOf(stockID) {
+					select {
+					case dependent.recalculate <- struct{}{}:
+					default:
+					}
+				}
+			case <-holder.recalculate:
+				// 아직 시세를 받지 못한 종목은 오늘의 봉이 비어 있으므로 건너뛴다
+				if hasPrice {
+					calculate()
+				}
+			case <-sentinel:
 				logger.Info("[Analyser] Holder Sentinel Called: %s", stockID)
 				return
 			}
@@ -231,6 +468,22 @@ func (b *Broker) FeedPrice(stockID string, provider <-chan structs.StockPrice) {
 	commons.InvokeGoroutine(fmt.Sprintf("[Broker][%s]", stockID), funcWork)
 }
 
+// AddCorporateActions stores the corporate actions and adjusts the past prices of the stocks by them
+func (b *Broker) AddCorporateActions(actions []structs.CorporateAction) error {
+	if err := StoreCorporateActions(b.dbClient, actions); err != nil {
+		return err
+	}
+	reloaded := make(map[string]bool)
+	for _, action := range actions {
+		if reloaded[action.StockID] {
+			continue
+		}
+		reloaded[action.StockID] = true
+		b.ReloadPastPrice(action.StockID)
+	}
+	return nil
+}
+
 // StopFeedingPrice Stop feeding price of all analysers
 func (b *Broker) StopFeedingPrice() {
 	b.mutex.Lock()
@@ -265,8 +518,28 @@ func (b *Broker) UpdatePastPriceOfStock(stockID string) {
 	logger.Info("[Analyser] UpdatePastPriceOfStock %s", stockID)
 }
 
+// ReloadPastPrice reloads every past price of the stock, i.e. after older prices are imported.
+func (b *Broker) ReloadPastPrice(stockID string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	holder, ok := b.analysers[stockID]
+	if !ok {
+		return
+	}
+	b.reloadPastPriceOfStockImpl(stockID, holder, true)
+	logger.Info("[Analyser] ReloadPastPrice %s", stockID)
+}
+
 func (b *Broker) updatePastPriceOfStockImpl(stockID string, holder *analyserHolder) {
+	b.reloadPastPriceOfStockImpl(stockID, holder, false)
+}
+
+// reloadPastPriceOfStockImpl appends the past prices of the stock, loading every past price again if forced to.
+// Mutex must be locked.
+func (b *Broker) reloadPastPriceOfStockImpl(stockID string, holder *analyserHolder, force bool) {
+	holder.analyser.mutex.RLock()
 	timestampFrom := holder.analyser.NeedPriceFrom()
+	holder.analyser.mutex.RUnlock()
 	var prices []structs.StockPrice
 	_, err := b.dbClient.Select(&prices,
 		"where StockID=? and Timestamp>=? order by Timestamp",
@@ -276,10 +549,53 @@ func (b *Broker) updatePastPriceOfStockImpl(stockID string, holder *analyserHold
 			stockID, commons.Unix(timestampFrom).String(), err.Error())
 		return
 	}
+	prices, adjustment, err := adjustedPrices(b.dbClient, stockID, prices)
+	if err != nil {
+		logger.Error("[Analyser] Error while loading corporate actions of %s: %s", stockID, err.Error())
+	}
+	// 새로운 분할, 배당 등이 있으면 지난 가격을 모두 다시 맞춘다
+	var live *techan.Candle
+	unlock := lockAnalysers(holder.analyser.withReferences(), true)
+	reload := force || (adjustment != holder.analyser.adjustment && len(holder.analyser.timeSeries.Candles) > 0)
+	if reload {
+		live = holder.analyser.resetPastPrices()
+	}
+	holder.analyser.adjustment = adjustment
 	for i := range prices {
 		holder.analyser.AppendPastPrice(prices[i])
 	}
+	if reload {
+		if live != nil {
+			holder.analyser.restoreLiveCandle(live)
+		}
+		holder.analyser.rebuildStrategies()
+	}
+	intradayFrom, ok := holder.analyser.intradayPriceFrom()
+	unlock()
+	if reload {
+		b.rebuildDependents(stockID)
+		logger.Info("[Analyser] Reloaded past price info of %s: %s", stockID, adjustment)
+	}
 	logger.Info("[Analyser] Updated past price info of %s: %d cases", stockID, len(prices))
+
+	if !ok {
+		return
+	}
+	var intraday []structs.IntradayPrice
+	_, err = b.dbClient.Select(&intraday,
+		"where StockID=? and Timestamp>=? order by Timestamp",
+		stockID, intradayFrom)
+	if err != nil {
+		logger.Error("[Analyser] Error while updating intraday price of %s since %s: %s",
+			stockID, commons.Unix(intradayFrom).String(), err.Error())
+		return
+	}
+	holder.analyser.mutex.Lock()
+	for i := range intraday {
+		holder.analyser.AppendIntradayPrice(intraday[i])
+	}
+	holder.analyser.mutex.Unlock()
+	logger.Info("[Analyser] Updated intraday price info of %s: %d cases", stockID, len(intraday))
 }
 
 // Description description of this Watcher
@@ -307,8 +623,13 @@ func (b *Broker) Description() string {
 	addLine("Analysers: %v", len(b.analysers))
 	for stockid, holder := range b.analysers {
 		addLine("    [Analyser#%v]", stockid)
+		holder.analyser.mutex.RLock()
 		addLine("        [IsWatching: %v]", holder.analyser.isWatchingPrice())
+		holder.analyser.mutex.RUnlock()
 		addLine("        [Reference Count: %v]", holder.analyser.Count())
+		for refID := range holder.analyser.refs {
+			addLine("        [Refers to: %v]", refID)
+		}
 		addLine("        [Time Series: %v]", holder.analyser.timeSeries.LastIndex()+1)
 		lastCandle := holder.analyser.timeSeries.LastCandle()
 		addLine("            [Last Candle]")
@@ -318,6 +639,9 @@ func (b *Broker) Description() string {
 		addLine("                [High:   %v]", lastCandle.MaxPrice.FormattedString(2))
 		addLine("                [Low:    %v]", lastCandle.MinPrice.FormattedString(2))
 		addLine("                [Volume: %v]", lastCandle.Volume.FormattedString(2))
+		for timeframe, series := range holder.analyser.intraday {
+			addLine("        [Time Series@%s: %v]", timeframe, series.LastIndex()+1)
+		}
 	}
 
 	return buf.String()
@@ -325,7 +649,7 @@ func (b *Broker) Description() string {
 
 func (b *Broker) Situation(stockName, stockID string) (bool, string, string) {
 	stockAccess := watcher.NewStockItemChecker(b.dbClient)
-	didDraw, savePath := NewCandlePlot(b.dbClient, 10, stockID, stockAccess)
+	didDraw, savePath := NewCandlePlot(b.dbClient, 10, stockID, stockAccess, ProspectCandlePlotOptions)
 	if !didDraw {
 		return false, "", ""
 	}
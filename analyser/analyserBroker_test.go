@@ -17,7 +17,7 @@ package analyser_test
 // 	})
 
 // 	g := mockGeneral{
-// 		priceWatcher: watcher.New(client, time.Millisecond*500),
+// 		priceWatcher: watcher.New(client, watcher.NewNaverSource(), time.Millisecond*500),
 // 		broker:       analyser.NewBroker(client),
 // 	}
 
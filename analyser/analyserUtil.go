@@ -2,6 +2,7 @@ package analyser
 
 import (
 	"fmt"
+	"math"
 	"sort"
 	"strings"
 
@@ -78,6 +79,9 @@ func cacheIndicators() {
 	// Increase
 	indicatorMap["increase"] = makeIncrease()
 
+	// Relative Strength
+	indicatorMap["rs"] = makeRelativeStrength()
+
 	// Local Extrema
 	indicatorMap["extrema"] = makeExtrema()
 
@@ -95,6 +99,17 @@ func cacheIndicators() {
 	indicatorMap["isZero"] = funcIsZero
 	indicatorMap["iszero"] = funcIsZero
 	indicatorMap["zero"] = funcIsZero
+
+	// Moving Average
+	indicatorMap["sma"] = makeMovingAverage("SMA", newSMA)
+	indicatorMap["ema"] = makeMovingAverage("EMA", newEMA)
+
+	// Bollinger Band
+	indicatorMap["bollup"] = makeBollingerBand(true)
+	indicatorMap["bolldown"] = makeBollingerBand(false)
+
+	// Volume
+	indicatorMap["volume"] = makeVolume()
 }
 
 func cacheRules() {
@@ -150,9 +165,10 @@ func tidyTokens(tokens []token) ([]token, error) {
 		if t.Kind == govaluate.VARIABLE {
 			// Change function name to lower case
 			t.Value = strings.ToLower(t.Value.(string))
-			_, ok := indicatorMap[t.Value.(string)]
+			name, _, _ := splitSeriesName(t.Value.(string))
+			_, ok := indicatorMap[name]
 			if !ok {
-				return nil, newError(fmt.Sprintf("Unsupported function used: %s", t.Value.(string)))
+				return nil, newError(fmt.Sprintf("Unsupported function used: %s", name))
 			}
 		} else if t.Kind == govaluate.CLAUSE {
 			t.Value = "("
@@ -167,6 +183,29 @@ func parseTokens(statement string) ([]token, error) {
 	return govaluate.ParseTokens(statement, nil)
 }
 
+// parseStrategy parses a statement of the strategy DSL into postfix ordered functions
+func parseStrategy(statement string) ([]function, error) {
+	statement, err := expandInstruments(statement)
+	if err != nil {
+		return nil, err
+	}
+	statement, err = expandTimeframes(statement)
+	if err != nil {
+		return nil, err
+	}
+	tmpTokens, err := parseTokens(statement)
+	if err != nil {
+		return nil, err
+	}
+
+	newTokens, err := tidyTokens(tmpTokens)
+	if err != nil {
+		return nil, err
+	}
+
+	return reorderTokenByPostfix(newTokens)
+}
+
 type function struct {
 	t    token
 	argc int
@@ -407,6 +446,40 @@ func precedenceOf(t token) int {
 }
 
 func (a *Analyser) createRule(fcns []function) (techan.Rule, error) {
+	indicators, rules, err := a.composeFunctions(fcns)
+	if err != nil {
+		return nil, err
+	}
+	if len(indicators) != 0 || len(rules) != 1 {
+		// Something wrong
+		return nil, newError(fmt.Sprintf("Rule must exist and be unique: %d rules generated", len(rules)))
+	}
+
+	return rules[0], nil
+}
+
+// createIndicator composes an indicator from an expression without any comparison, i.e. rsi(14)
+func (a *Analyser) createIndicator(fcns []function) (techan.Indicator, error) {
+	indicators, rules, err := a.composeFunctions(fcns)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) != 0 || len(indicators) != 1 {
+		return nil, newError(fmt.Sprintf("Indicator must exist and be unique: %d indicators, %d rules generated", len(indicators), len(rules)))
+	}
+
+	if indicator, ok := indicators[0].(techan.Indicator); ok {
+		return indicator, nil
+	}
+	value, ok := indicators[0].(float64)
+	if !ok {
+		return nil, newError(fmt.Sprintf("Invalid indicator: %v", indicators[0]))
+	}
+	return techan.NewConstantIndicator(value), nil
+}
+
+// composeFunctions evaluates postfix ordered functions into indicators and rules
+func (a *Analyser) composeFunctions(fcns []function) ([]interface{}, []techan.Rule, error) {
 	indicators := make([]interface{}, 0)
 	rules := make([]techan.Rule, 0)
 	for len(fcns) > 0 {
@@ -421,17 +494,38 @@ func (a *Analyser) createRule(fcns []function) (techan.Rule, error) {
 			// 인자를 슬라이스에 담고
 			// indicator를 만든다
 			if len(indicators) < f.argc {
-				return nil, newError("Invalid syntax")
+				return nil, nil, newError("Invalid syntax")
 			}
 			args := indicators[len(indicators)-f.argc:]
 			indicators = indicators[:len(indicators)-f.argc]
-			gen, ok := indicatorMap[f.t.Value.(string)]
+			name, timeframe, instrument := splitSeriesName(f.t.Value.(string))
+			gen, ok := indicatorMap[name]
 			if !ok {
-				return nil, newError("Not implemented function")
+				return nil, nil, newError("Not implemented function")
+			}
+			source, err := a.reference(instrument)
+			if err != nil {
+				return nil, nil, err
+			}
+			if source == a {
+				instrument = ""
 			}
-			indicator, err := gen(a.timeSeries, args...)
+			series, err := source.seriesOf(timeframe)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
+			}
+			// 같은 시간 단위, 같은 종목의 인자는 그 시계열 그대로 쓴다
+			for i := range args {
+				if framed, ok := args[i].(timeframeIndicator); ok && framed.timeframe == timeframe && framed.instrument == instrument {
+					args[i] = framed.indicator
+				}
+			}
+			indicator, err := gen(series, args...)
+			if err != nil {
+				return nil, nil, err
+			}
+			if len(timeframe) > 0 || len(instrument) > 0 {
+				indicator = timeframeIndicator{indicator: indicator, timeframe: timeframe, instrument: instrument, base: a.timeSeries, series: series}
 			}
 			indicators = append(indicators, indicator)
 		case govaluate.PREFIX:
@@ -445,7 +539,7 @@ func (a *Analyser) createRule(fcns []function) (techan.Rule, error) {
 			}
 		case govaluate.COMPARATOR:
 			if len(indicators) < 2 {
-				return nil, newError(fmt.Sprintf("Cannot compose a comparing rule with %d indicators", len(indicators)))
+				return nil, nil, newError(fmt.Sprintf("Cannot compose a comparing rule with %d indicators", len(indicators)))
 			}
 			rhs := indicators[len(indicators)-1]
 			lhs := indicators[len(indicators)-2]
@@ -462,7 +556,7 @@ func (a *Analyser) createRule(fcns []function) (techan.Rule, error) {
 			}
 			rule, err := ruleMaker(lhsIndicator, rhsIndicator)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			rules = append(rules, rule)
 		case govaluate.LOGICALOP:
@@ -472,7 +566,7 @@ func (a *Analyser) createRule(fcns []function) (techan.Rule, error) {
 			ruleMaker := ruleMap[f.t.Value.(string)]
 			rule, err := ruleMaker(lhs, rhs)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			rules = append(rules, rule)
 		case govaluate.MODIFIER:
@@ -490,18 +584,13 @@ func (a *Analyser) createRule(fcns []function) (techan.Rule, error) {
 			}
 			operated, err := indicatorMap[f.t.Value.(string)](nil, lhsIndicator, rhsIndicator)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			indicators = append(indicators, operated)
 		}
 	}
 
-	if len(rules) != 1 {
-		// Something wrong
-		return nil, newError(fmt.Sprintf("Rule must exist and be unique: %d rules generated", len(rules)))
-	}
-
-	return rules[0], nil
+	return indicators, rules, nil
 }
 
 func candleToStockPrice(stockID string, c *techan.Candle, useEndTime bool) structs.StockPrice {
@@ -512,13 +601,14 @@ func candleToStockPrice(stockID string, c *techan.Candle, useEndTime bool) struc
 	if useEndTime {
 		timestamp = c.Period.End.Unix()
 	}
+	scale := structs.PriceScale(stockID)
 	return structs.StockPrice{
 		StockID:   stockID,
 		Timestamp: timestamp,
-		Open:      int(c.OpenPrice.Float()),
-		Close:     int(c.ClosePrice.Float()),
-		High:      int(c.MaxPrice.Float()),
-		Low:       int(c.MinPrice.Float()),
+		Open:      int(math.Round(c.OpenPrice.Float() * scale)),
+		Close:     int(math.Round(c.ClosePrice.Float() * scale)),
+		High:      int(math.Round(c.MaxPrice.Float() * scale)),
+		Low:       int(math.Round(c.MinPrice.Float() * scale)),
 		Volume:    c.Volume.Float(),
 	}
 }
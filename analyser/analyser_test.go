@@ -3,6 +3,7 @@ package analyser
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/helloworldpark/tickle-stock-watcher/commons"
 	"github.com/helloworldpark/tickle-stock-watcher/database"
@@ -49,3 +50,34 @@ func TestAppendPastPrice(t *testing.T) {
 		fmt.Printf("Price[%d]:%v\n%v\n", i, commons.Unix(prices[i].Timestamp), analyser.timeSeries.LastCandle())
 	}
 }
+
+func TestWatchPrice(t *testing.T) {
+	analyser := newAnalyserWithPrices("005930", newSinePrices("005930", 30, 0))
+	analyser.prepareWatching(commons.Now())
+
+	// 스냅샷이 온전하면 그대로
+	analyser.watchPrice(structs.StockPrice{StockID: "005930", Open: 55000, High: 56800, Low: 54900, Close: 56300, Volume: 1000})
+	live := candleToStockPrice("005930", analyser.timeSeries.LastCandle(), false)
+	if live.Open != 55000 || live.High != 56800 || live.Low != 54900 || live.Close != 56300 || live.Volume != 1000 {
+		t.Errorf("Unexpected live candle: %+v", live)
+	}
+
+	// 현재가만 있으면 지금까지의 가격으로 고가, 저가를 맞춘다
+	analyser.watchPrice(structs.StockPrice{StockID: "005930", Close: 57000})
+	live = candleToStockPrice("005930", analyser.timeSeries.LastCandle(), false)
+	if live.Open != 55000 || live.High != 57000 || live.Low != 54900 || live.Close != 57000 || live.Volume != 1000 {
+		t.Errorf("Unexpected live candle: %+v", live)
+	}
+}
+
+func TestPrepareWatchingOnReplayClock(t *testing.T) {
+	analyser := newAnalyserWithPrices("005930", newSinePrices("005930", 30, 0))
+
+	// 재생 중에는 벽시계가 아니라 재생 시각의 날짜로 봉을 만든다
+	replayed := time.Date(2017, time.September, 1, 10, 30, 0, 0, commons.AsiaSeoul)
+	analyser.prepareWatching(replayed)
+	start := analyser.timeSeries.LastCandle().Period.Start
+	if !start.Equal(time.Date(2017, time.September, 1, 0, 0, 0, 0, commons.AsiaSeoul)) {
+		t.Errorf("Expected the live candle on the replayed day, got %v", start)
+	}
+}
@@ -0,0 +1,48 @@
+package analyser
+
+import (
+	"github.com/helloworldpark/tickle-stock-watcher/database"
+	"github.com/helloworldpark/tickle-stock-watcher/structs"
+)
+
+// MarketBreadth counts stocks by the change of their close prices over a period
+type MarketBreadth struct {
+	From, To  int64 // Timestamps of the first and the last prices compared
+	Advancing int
+	Declining int
+	Unchanged int
+}
+
+// MarketBreadthSince compares the close prices of every stock since timestampFrom with their last close prices
+func MarketBreadthSince(dbClient *database.DBClient, timestampFrom int64) (MarketBreadth, error) {
+	histories, err := loadPriceHistories(dbClient, timestampFrom)
+	if err != nil {
+		return MarketBreadth{}, err
+	}
+	return marketBreadthFromHistories(histories), nil
+}
+
+func marketBreadthFromHistories(histories map[string][]structs.StockPrice) MarketBreadth {
+	var breadth MarketBreadth
+	for _, prices := range histories {
+		if len(prices) < 2 {
+			continue
+		}
+		first, last := prices[0], prices[len(prices)-1]
+		if breadth.From == 0 || first.Timestamp < breadth.From {
+			breadth.From = first.Timestamp
+		}
+		if last.Timestamp > breadth.To {
+			breadth.To = last.Timestamp
+		}
+		switch {
+		case last.Close > first.Close:
+			breadth.Advancing++
+		case last.Close < first.Close:
+			breadth.Declining++
+		default:
+			breadth.Unchanged++
+		}
+	}
+	return breadth
+}
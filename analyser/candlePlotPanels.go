@@ -0,0 +1,349 @@
+package analyser
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/sdcoffey/techan"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+)
+
+// CandlePlotOptions decides what to draw along with the candles
+type CandlePlotOptions struct {
+	// Overlays indicators drawn over the candles, written in the strategy DSL
+	// ex) sma(20), ema(60), bollinger(20, 2)
+	Overlays []string
+	// SubPanels panels stacked below the candles
+	// volume, macd, macd(12,26,9), rsi, rsi(14)
+	SubPanels []string
+	// Tag appended to the file name, to keep the chart apart from the others of the same stock
+	Tag string
+}
+
+// ProspectCandlePlotOptions options used for the charts of prospects
+var ProspectCandlePlotOptions = CandlePlotOptions{
+	Overlays:  []string{"sma(20)", "bollinger(20,2)"},
+	SubPanels: []string{"volume", "macd", "rsi"},
+}
+
+// subPanels names of the supported sub panels
+var subPanels = map[string]bool{
+	"volume": true,
+	"macd":   true,
+	"rsi":    true,
+}
+
+// ParseCandlePlotOptions sorts specs into overlays and sub panels
+// ex) sma(20) ema(60) volume macd(12,26,9)
+func ParseCandlePlotOptions(specs []string) (CandlePlotOptions, error) {
+	options := CandlePlotOptions{}
+	for _, spec := range specs {
+		name := strings.ToLower(strings.TrimSpace(spec))
+		if open := strings.Index(name, "("); open >= 0 {
+			name = name[:open]
+		}
+		if subPanels[name] || name == "bollinger" {
+			if _, _, err := parseChartSpec(spec); err != nil {
+				return options, err
+			}
+		} else if _, err := parseStrategy(spec); err != nil {
+			return options, newError(fmt.Sprintf("Invalid chart option %s: %v", spec, err))
+		}
+		if subPanels[name] {
+			options.SubPanels = append(options.SubPanels, spec)
+		} else {
+			options.Overlays = append(options.Overlays, spec)
+		}
+	}
+	return options, nil
+}
+
+// subPanelHeightRatio height of a sub panel compared to the candle panel
+const subPanelHeightRatio = 0.35
+
+var overlayColors = []color.Color{
+	color.RGBA{R: 230, G: 120, A: 255},
+	color.RGBA{G: 150, B: 60, A: 255},
+	color.RGBA{R: 140, B: 200, A: 255},
+	color.RGBA{R: 100, G: 100, B: 100, A: 255},
+}
+
+// plotWindow is the range of candles drawn in a chart
+type plotWindow struct {
+	timeSeries *techan.TimeSeries
+	from       int // First index of the candles to draw
+}
+
+func (w plotWindow) xys(indicator techan.Indicator) plotter.XYs {
+	xys := make(plotter.XYs, 0, len(w.timeSeries.Candles)-w.from)
+	for i := w.from; i < len(w.timeSeries.Candles); i++ {
+		v := indicator.Calculate(i).Float()
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		// 봉의 가운데에 찍는다
+		t := float64(w.timeSeries.Candles[i].Period.Start.Unix()) + 12*60*60
+		xys = append(xys, plotter.XY{X: t, Y: v})
+	}
+	return xys
+}
+
+func (w plotWindow) line(indicator techan.Indicator, c color.Color) (*plotter.Line, error) {
+	line, err := plotter.NewLine(w.xys(indicator))
+	if err != nil {
+		return nil, err
+	}
+	line.Color = c
+	return line, nil
+}
+
+// parseChartSpec parses specs like 'macd(12,26,9)' into its name and arguments
+func parseChartSpec(spec string) (string, []float64, error) {
+	spec = strings.ToLower(strings.Replace(spec, " ", "", -1))
+	open := strings.Index(spec, "(")
+	if open < 0 {
+		return spec, nil, nil
+	}
+	if !strings.HasSuffix(spec, ")") {
+		return "", nil, newError(fmt.Sprintf("Invalid chart option: %s", spec))
+	}
+	name := spec[:open]
+	var args []float64
+	for _, s := range strings.Split(spec[open+1:len(spec)-1], ",") {
+		if len(s) == 0 {
+			continue
+		}
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return "", nil, newError(fmt.Sprintf("Invalid chart option: %s", spec))
+		}
+		args = append(args, v)
+	}
+	return name, args, nil
+}
+
+// floatArgs fills missing arguments with default values
+func floatArgs(args []float64, defaults ...float64) ([]interface{}, error) {
+	if len(args) > 0 && len(args) != len(defaults) {
+		return nil, newError(fmt.Sprintf("Number of parameters incorrect: got %d, need %d", len(args), len(defaults)))
+	}
+	if len(args) == 0 {
+		args = defaults
+	}
+	result := make([]interface{}, len(args))
+	for i := range args {
+		result[i] = args[i]
+	}
+	return result, nil
+}
+
+// newOverlays creates lines drawn over the candles
+func newOverlays(ana *Analyser, window plotWindow, specs []string) ([]plot.Plotter, error) {
+	var plotters []plot.Plotter
+	for i, spec := range specs {
+		c := overlayColors[i%len(overlayColors)]
+		var indicators []techan.Indicator
+		if strings.HasPrefix(strings.ToLower(strings.TrimSpace(spec)), "bollinger") {
+			// 볼린저 밴드는 상단, 중심, 하단 세 줄
+			_, args, err := parseChartSpec(spec)
+			if err != nil {
+				return nil, err
+			}
+			bollArgs, err := floatArgs(args, 20, 2)
+			if err != nil {
+				return nil, err
+			}
+			upper, err := indicatorMap["bollup"](ana.timeSeries, bollArgs...)
+			if err != nil {
+				return nil, err
+			}
+			middle, err := indicatorMap["sma"](ana.timeSeries, bollArgs[0])
+			if err != nil {
+				return nil, err
+			}
+			lower, err := indicatorMap["bolldown"](ana.timeSeries, bollArgs...)
+			if err != nil {
+				return nil, err
+			}
+			indicators = append(indicators, upper, middle, lower)
+		} else {
+			fcns, err := parseStrategy(spec)
+			if err != nil {
+				return nil, err
+			}
+			indicator, err := ana.createIndicator(fcns)
+			if err != nil {
+				return nil, err
+			}
+			indicators = append(indicators, indicator)
+		}
+
+		for _, indicator := range indicators {
+			line, err := window.line(indicator, c)
+			if err != nil {
+				return nil, err
+			}
+			plotters = append(plotters, line)
+		}
+	}
+	return plotters, nil
+}
+
+// newSubPanel creates a panel drawn below the candles
+func newSubPanel(ana *Analyser, window plotWindow, spec string, upColor, downColor color.Color) (*plot.Plot, error) {
+	name, args, err := parseChartSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	p, err := plot.New()
+	if err != nil {
+		return nil, err
+	}
+
+	switch name {
+	case "volume":
+		volume, _ := indicatorMap["volume"](ana.timeSeries)
+		bars := newTimeBars(window, volume, func(i int) color.Color {
+			candle := ana.timeSeries.Candles[i]
+			if candle.ClosePrice.GTE(candle.OpenPrice) {
+				return upColor
+			}
+			return downColor
+		})
+		p.Add(bars)
+		p.Y.Label.Text = "Volume"
+	case "macd":
+		macdArgs, err := floatArgs(args, 12, 26, 9)
+		if err != nil {
+			return nil, err
+		}
+		macd, err := indicatorMap["macd"](ana.timeSeries, macdArgs[:2]...)
+		if err != nil {
+			return nil, err
+		}
+		hist, err := indicatorMap["macdhist"](ana.timeSeries, macdArgs...)
+		if err != nil {
+			return nil, err
+		}
+		bars := newTimeBars(window, hist, func(i int) color.Color {
+			if hist.Calculate(i).Float() >= 0 {
+				return upColor
+			}
+			return downColor
+		})
+		macdLine, err := window.line(macd, overlayColors[0])
+		if err != nil {
+			return nil, err
+		}
+		signalLine, err := window.line(newMinusIndicator(macd, hist), overlayColors[2])
+		if err != nil {
+			return nil, err
+		}
+		p.Add(bars, macdLine, signalLine, plotter.NewGrid())
+		p.Y.Label.Text = "MACD"
+	case "rsi":
+		rsiArgs, err := floatArgs(args, 14)
+		if err != nil {
+			return nil, err
+		}
+		rsi, err := indicatorMap["rsi"](ana.timeSeries, rsiArgs...)
+		if err != nil {
+			return nil, err
+		}
+		rsiLine, err := window.line(rsi, overlayColors[2])
+		if err != nil {
+			return nil, err
+		}
+		p.Add(rsiLine)
+		// 과매도 30, 과매수 70
+		for _, level := range []float64{30, 70} {
+			band, err := window.line(techan.NewConstantIndicator(level), overlayColors[3])
+			if err != nil {
+				return nil, err
+			}
+			band.Dashes = []vg.Length{vg.Points(2), vg.Points(2)}
+			p.Add(band)
+		}
+		p.Y.Min, p.Y.Max = 0, 100
+		p.Y.Label.Text = "RSI"
+	default:
+		return nil, newError(fmt.Sprintf("Unsupported chart panel: %s", spec))
+	}
+	return p, nil
+}
+
+// alignPanels splits the canvas vertically by heights, top to bottom,
+// and aligns the data area of the panels so that their X axes match.
+func alignPanels(panels []*plot.Plot, heights []float64, dc draw.Canvas) []draw.Canvas {
+	var total float64
+	for _, h := range heights {
+		total += h
+	}
+
+	canvases := make([]draw.Canvas, len(panels))
+	top := dc.Max.Y
+	for i := range panels {
+		h := vg.Length(heights[i]/total) * (dc.Max.Y - dc.Min.Y)
+		canvases[i] = draw.Crop(dc, 0, 0, top-h-dc.Min.Y, top-dc.Max.Y)
+		top -= h
+	}
+
+	var padLeft, padRight vg.Length
+	for i, p := range panels {
+		dataCanvas := p.DataCanvas(canvases[i])
+		padLeft = vg.Length(math.Max(float64(padLeft), float64(dataCanvas.Min.X-canvases[i].Min.X)))
+		padRight = vg.Length(math.Max(float64(padRight), float64(canvases[i].Max.X-dataCanvas.Max.X)))
+	}
+	for i, p := range panels {
+		dataCanvas := p.DataCanvas(canvases[i])
+		left := padLeft - (dataCanvas.Min.X - canvases[i].Min.X)
+		right := padRight - (canvases[i].Max.X - dataCanvas.Max.X)
+		canvases[i] = draw.Crop(canvases[i], left, -right, 0, 0)
+	}
+	return canvases
+}
+
+// timeBars bars located by timestamps of the candles
+type timeBars struct {
+	xys    plotter.XYs
+	colors []color.Color
+}
+
+func newTimeBars(window plotWindow, indicator techan.Indicator, colorOf func(int) color.Color) *timeBars {
+	bars := &timeBars{}
+	for i := window.from; i < len(window.timeSeries.Candles); i++ {
+		t := float64(window.timeSeries.Candles[i].Period.Start.Unix())
+		bars.xys = append(bars.xys, plotter.XY{X: t, Y: indicator.Calculate(i).Float()})
+		bars.colors = append(bars.colors, colorOf(i))
+	}
+	return bars
+}
+
+// Plot Plot
+func (b *timeBars) Plot(c draw.Canvas, plt *plot.Plot) {
+	trX, trY := plt.Transforms(&c)
+	for i, xy := range b.xys {
+		// 봉과 같은 폭으로 그린다
+		x0 := trX(xy.X + 2*60*60)
+		x1 := trX(xy.X + 22*60*60)
+		y0 := trY(0)
+		y1 := trY(xy.Y)
+		var r vg.Rectangle
+		r.Min = vg.Point{X: x0, Y: vg.Length(math.Min(float64(y0), float64(y1)))}
+		r.Max = vg.Point{X: x1, Y: vg.Length(math.Max(float64(y0), float64(y1)))}
+		c.SetColor(b.colors[i])
+		c.Fill(r.Path())
+	}
+}
+
+// DataRange DataRange
+func (b *timeBars) DataRange() (xmin, xmax, ymin, ymax float64) {
+	xmin, xmax, ymin, ymax = plotter.XYRange(b.xys)
+	return xmin, xmax + 24*60*60, math.Min(ymin, 0), math.Max(ymax, 0)
+}
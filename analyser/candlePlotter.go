@@ -14,13 +14,19 @@ import (
 	"github.com/sdcoffey/techan"
 	"gonum.org/v1/plot"
 	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+	"gonum.org/v1/plot/vg/vgimg"
 )
 
 const magicString = "tmpday"
 const saveDirFormat = "tmpday%04d%02d%02d/"
-const savePathFormat = "candle%s.png"
+const savePathFormat = "candle%s%s.png"
 const additionalDays = 50
 
+// Size of the candle panel, regardless of the number of days drawn
+const candlePlotWidth = 24 * vg.Centimeter
+const candlePlotHeight = 14 * vg.Centimeter
+
 func newCandlePlotDir(date time.Time) string {
 	y, m, d := date.Date()
 	return fmt.Sprintf(saveDirFormat, y, m, d)
@@ -51,7 +57,7 @@ func CleanupOldCandleplots() error {
 // NewCandlePlot draws and saves a new candle plot of Stock ID
 //               didPlot bool
 //               savePath string, full path
-func NewCandlePlot(dbClient *database.DBClient, days int, stockID string, stockAccess *watcher.StockItemChecker) (bool, string) {
+func NewCandlePlot(dbClient *database.DBClient, days int, stockID string, stockAccess *watcher.StockItemChecker, options CandlePlotOptions) (bool, string) {
 
 	stockInfo, isValid := stockAccess.StockFromID(stockID)
 	if !isValid {
@@ -59,26 +65,51 @@ func NewCandlePlot(dbClient *database.DBClient, days int, stockID string, stockA
 		return false, ""
 	}
 
-	ana := NewAnalyser(stockInfo.StockID)
-	timestampFrom := commons.MaxInt64(ana.NeedPriceFrom(), commons.Now().Unix()-60*60*24*int64(days+additionalDays))
-	var prices []structs.StockPrice
-	_, err := dbClient.Select(&prices,
-		"where StockID=? and Timestamp>=? order by Timestamp",
-		stockID, timestampFrom)
+	prices, err := selectPricesForDays(dbClient, days, stockID)
+	if err != nil {
+		logger.Error("[CandlePlot] Error: %+v", err)
+		return false, ""
+	}
+	if len(prices) == 0 {
+		logger.Error("[CandlePlot] Error: No prices of %s", stockID)
+		return false, ""
+	}
+	// 상장한 지 얼마 안 된 종목은 있는 만큼만 그린다
+	return newCandlePlotFromPrices(stockInfo, commons.MinInt(days, len(prices)), prices, options)
+}
+
+// NewCandleChart draws a candle plot of Stock ID, uploads it and returns the URL of the chart
+func NewCandleChart(dbClient *database.DBClient, days int, stockID string, stockAccess *watcher.StockItemChecker, options CandlePlotOptions) (string, error) {
+	if err := MkCandlePlotDir(); err != nil && !os.IsExist(err) {
+		return "", err
+	}
+	didPlot, savePath := NewCandlePlot(dbClient, days, stockID, stockAccess, options)
+	if !didPlot {
+		return "", newError(fmt.Sprintf("Failed to draw chart of %s", stockID))
+	}
+	savePath, err := uploadLocalImage(savePath)
 	if err != nil {
-		logger.Error("[CandlePlot] Error: +v", err)
+		return "", err
+	}
+	return baseURL + savePath, nil
+}
+
+func newCandlePlotFromPrices(stockInfo structs.Stock, days int, prices []structs.StockPrice, options CandlePlotOptions) (bool, string) {
+	if len(prices) < days {
+		logger.Error("[CandlePlot] Error: Not enough prices of %s to plot %d days: %d", stockInfo.StockID, days, len(prices))
 		return false, ""
 	}
 
+	ana := NewAnalyser(stockInfo.StockID)
 	candles := Candles{}
 	for i := range prices {
 		ana.AppendPastPrice(prices[i])
 		candles = append(candles, candle{
 			Timestamp: float64(prices[i].Timestamp),
-			Open:      float64(prices[i].Open),
-			Close:     float64(prices[i].Close),
-			High:      float64(prices[i].High),
-			Low:       float64(prices[i].Low),
+			Open:      float64(prices[i].Open) / ana.priceScale,
+			Close:     float64(prices[i].Close) / ana.priceScale,
+			High:      float64(prices[i].High) / ana.priceScale,
+			Low:       float64(prices[i].Low) / ana.priceScale,
 		})
 	}
 
@@ -89,18 +120,61 @@ func NewCandlePlot(dbClient *database.DBClient, days int, stockID string, stockA
 	}
 	y, m, d := commons.Now().Date()
 	p.Title.Text = fmt.Sprintf("%4d.%02d.%02d#%s", y, m, d, stockInfo.StockID)
-	p.X.Label.Text = "Date"
-	p.X.Tick.Marker = plot.TimeTicks{Format: "2006-01-02"}
 
 	saveDir := fmt.Sprintf(saveDirFormat, y, m, d)
-	savePath := saveDir + fmt.Sprintf(savePathFormat, stockID)
+	savePath := saveDir + fmt.Sprintf(savePathFormat, stockInfo.StockID, options.Tag)
 
 	upColor := color.RGBA{R: 128, A: 255}
 	downColor := color.RGBA{B: 120, A: 255}
 	cs := NewCandleSticks(candles, ana.timeSeries, days, upColor, downColor)
 	p.Add(cs)
 
-	if err := p.Save(vg.Length(days)*vg.Centimeter, vg.Length(days)*vg.Centimeter, savePath); err != nil {
+	// Overlays and sub panels
+	window := plotWindow{timeSeries: ana.timeSeries, from: commons.MaxInt(0, len(ana.timeSeries.Candles)-days)}
+	overlays, err := newOverlays(ana, window, options.Overlays)
+	if err != nil {
+		logger.Error("[CandlePlot] Error while drawing overlays of %s: %+v", stockInfo.StockID, err)
+		return false, ""
+	}
+	p.Add(overlays...)
+
+	panels := []*plot.Plot{p}
+	heights := []float64{1}
+	for _, spec := range options.SubPanels {
+		panel, err := newSubPanel(ana, window, spec, upColor, downColor)
+		if err != nil {
+			logger.Error("[CandlePlot] Error while drawing panel of %s: %+v", stockInfo.StockID, err)
+			return false, ""
+		}
+		panels = append(panels, panel)
+		heights = append(heights, subPanelHeightRatio)
+	}
+
+	xmin, xmax, _, _ := cs.DataRange()
+	for i, panel := range panels {
+		panel.X.Min, panel.X.Max = xmin, xmax
+		if i == len(panels)-1 {
+			panel.X.Label.Text = "Date"
+			panel.X.Tick.Marker = plot.TimeTicks{Format: "2006-01-02"}
+		} else {
+			panel.X.Tick.Marker = plot.ConstantTicks{}
+		}
+	}
+
+	height := candlePlotHeight * vg.Length(1+subPanelHeightRatio*float64(len(options.SubPanels)))
+	img := vgimg.New(candlePlotWidth, height)
+	dc := draw.New(img)
+	canvases := alignPanels(panels, heights, dc)
+	for i, panel := range panels {
+		panel.Draw(canvases[i])
+	}
+
+	f, err := os.Create(savePath)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+	if _, err := (vgimg.PngCanvas{Canvas: img}).WriteTo(f); err != nil {
 		panic(err)
 	}
 
@@ -111,19 +185,39 @@ func NewCandlePlot(dbClient *database.DBClient, days int, stockID string, stockA
 	return true, wd + savePath
 }
 
-// NewProspect find new prospect of the day
-func NewProspect(dbClient *database.DBClient, days int, stockID string) []structs.StockPrice {
-	ana := NewAnalyser(stockID)
-	timestampFrom := commons.MaxInt64(ana.NeedPriceFrom(), commons.Now().Unix()-60*60*24*int64(days+additionalDays))
+// selectPricesForDays selects prices needed to analyse the last days of the stock, adjusted by corporate actions
+func selectPricesForDays(dbClient *database.DBClient, days int, stockID string) ([]structs.StockPrice, error) {
 	var prices []structs.StockPrice
 	_, err := dbClient.Select(&prices,
 		"where StockID=? and Timestamp>=? order by Timestamp",
-		stockID, timestampFrom)
+		stockID, priceTimestampFrom(days))
 	if err != nil {
-		logger.Error("[CandlePlotter] Error: +v", err)
+		return nil, err
+	}
+	prices, _, err = adjustedPrices(dbClient, stockID, prices)
+	return prices, err
+}
+
+// priceTimestampFrom calculates timestamp from when prices are needed to analyse the last days
+// days are counted as trading days, so weekends are taken into account
+func priceTimestampFrom(days int) int64 {
+	ana := NewAnalyser("")
+	calendarDays := int64(days*7/5 + additionalDays)
+	return commons.MaxInt64(ana.NeedPriceFrom(), commons.Now().Unix()-60*60*24*calendarDays)
+}
+
+// NewProspect find new prospect of the day
+func NewProspect(dbClient *database.DBClient, days int, stockID string) []structs.StockPrice {
+	prices, err := selectPricesForDays(dbClient, days, stockID)
+	if err != nil {
+		logger.Error("[CandlePlotter] Error: %+v", err)
 		return nil
 	}
+	return newProspectFromPrices(stockID, prices)
+}
 
+func newProspectFromPrices(stockID string, prices []structs.StockPrice) []structs.StockPrice {
+	ana := NewAnalyser(stockID)
 	isPromising := newProspectCriteriaMACD(ana.timeSeries)
 
 	var promisingPrices []structs.StockPrice
@@ -1,8 +1,10 @@
 package analyser
 
 import (
+	"os"
 	"testing"
 
+	"github.com/helloworldpark/tickle-stock-watcher/structs"
 	"github.com/helloworldpark/tickle-stock-watcher/watcher"
 )
 
@@ -21,7 +23,46 @@ func TestCandlePlotterValidity(t *testing.T) {
 
 	stockItemChecker := watcher.NewStockItemChecker(dbClient)
 
-	if didDraw, _ := NewCandlePlot(dbClient, 10, "003490", stockItemChecker); !didDraw {
+	if didDraw, _ := NewCandlePlot(dbClient, 10, "003490", stockItemChecker, ProspectCandlePlotOptions); !didDraw {
 		t.FailNow()
 	}
 }
+
+func TestCandlePlotWithPanels(t *testing.T) {
+	if err := MkCandlePlotDir(); err != nil && !os.IsExist(err) {
+		t.Fatal(err)
+	}
+	defer CleanupOldCandleplots()
+
+	stock := structs.Stock{StockID: "000001", Name: "Sine"}
+	prices := newSinePrices(stock.StockID, 80, 0)
+	options := CandlePlotOptions{
+		Overlays:  []string{"sma(20)", "ema(5)", "bollinger(20,2)", "close() * 1.1"},
+		SubPanels: []string{"volume", "macd(12,26,9)", "rsi"},
+	}
+	didPlot, savePath := newCandlePlotFromPrices(stock, 30, prices, options)
+	if !didPlot {
+		t.Fatal("Failed to plot")
+	}
+	if _, err := os.Stat(savePath); err != nil {
+		t.Error(err)
+	}
+
+	options.SubPanels = []string{"stochastic"}
+	if didPlot, _ := newCandlePlotFromPrices(stock, 30, prices, options); didPlot {
+		t.Error("Unsupported panel must not be plotted")
+	}
+}
+
+func TestParseCandlePlotOptions(t *testing.T) {
+	options, err := ParseCandlePlotOptions([]string{"sma(20)", "volume", "bollinger(20,2)", "macd(12,26,9)", "close()*1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(options.Overlays) != 3 || len(options.SubPanels) != 2 {
+		t.Errorf("Overlays: %v SubPanels: %v", options.Overlays, options.SubPanels)
+	}
+	if _, err := ParseCandlePlotOptions([]string{"rsi(14"}); err == nil {
+		t.Error("Invalid panel must be rejected")
+	}
+}
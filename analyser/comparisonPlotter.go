@@ -0,0 +1,138 @@
+package analyser
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/helloworldpark/tickle-stock-watcher/commons"
+	"github.com/helloworldpark/tickle-stock-watcher/database"
+	"github.com/helloworldpark/tickle-stock-watcher/logger"
+	"github.com/helloworldpark/tickle-stock-watcher/structs"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+)
+
+const comparisonPathFormat = "compare%s.png"
+
+// NewComparisonPlot draws and saves the cumulative returns of Stock IDs for the last days on one figure
+//               didPlot bool
+//               savePath string, full path
+func NewComparisonPlot(dbClient *database.DBClient, days int, stockIDs []string, tag string) (bool, string) {
+	histories, err := selectPriceHistoriesForDays(dbClient, days, stockIDs)
+	if err != nil {
+		logger.Error("[ComparisonPlot] Error: %+v", err)
+		return false, ""
+	}
+	return newComparisonPlotFromPrices(stockIDs, days, histories, tag)
+}
+
+// NewComparisonChart draws a comparison plot of Stock IDs, uploads it and returns the URL of the chart
+func NewComparisonChart(dbClient *database.DBClient, days int, stockIDs []string, tag string) (string, error) {
+	if err := MkCandlePlotDir(); err != nil && !os.IsExist(err) {
+		return "", err
+	}
+	didPlot, savePath := NewComparisonPlot(dbClient, days, stockIDs, tag)
+	if !didPlot {
+		return "", newError(fmt.Sprintf("Failed to draw comparison chart of %v", stockIDs))
+	}
+	savePath, err := uploadLocalImage(savePath)
+	if err != nil {
+		return "", err
+	}
+	return baseURL + savePath, nil
+}
+
+// selectPriceHistoriesForDays selects prices of the stocks needed to draw the last days
+func selectPriceHistoriesForDays(dbClient *database.DBClient, days int, stockIDs []string) (map[string][]structs.StockPrice, error) {
+	histories := make(map[string][]structs.StockPrice)
+	for _, stockID := range stockIDs {
+		prices, err := selectPricesForDays(dbClient, days, stockID)
+		if err != nil {
+			return nil, err
+		}
+		histories[stockID] = prices
+	}
+	return histories, nil
+}
+
+// cumulativeReturns calculates returns in percent of the prices since the first price at or after timestampFrom
+// Returns
+//     plotter.XYs   X: timestamp of the middle of the day, Y: return in percent
+func cumulativeReturns(prices []structs.StockPrice, timestampFrom int64) plotter.XYs {
+	var xys plotter.XYs
+	var base float64
+	for i := range prices {
+		if prices[i].Timestamp < timestampFrom || prices[i].Close <= 0 {
+			continue
+		}
+		if base == 0 {
+			base = float64(prices[i].Close)
+		}
+		xys = append(xys, plotter.XY{
+			X: float64(prices[i].Timestamp) + 12*60*60,
+			Y: (float64(prices[i].Close)/base - 1) * 100,
+		})
+	}
+	return xys
+}
+
+func newComparisonPlotFromPrices(stockIDs []string, days int, histories map[string][]structs.StockPrice, tag string) (bool, string) {
+	if len(stockIDs) == 0 {
+		logger.Error("[ComparisonPlot] Error: No stocks to compare")
+		return false, ""
+	}
+
+	// 모든 종목이 가격을 가진 날부터 비교한다
+	var timestampFrom int64
+	for _, stockID := range stockIDs {
+		prices := histories[stockID]
+		if len(prices) == 0 {
+			logger.Error("[ComparisonPlot] Error: No prices of %s", stockID)
+			return false, ""
+		}
+		from := prices[commons.MaxInt(0, len(prices)-days)].Timestamp
+		timestampFrom = commons.MaxInt64(timestampFrom, from)
+	}
+
+	p, err := plot.New()
+	if err != nil {
+		logger.Error("[ComparisonPlot] Error: %+v", err)
+		return false, ""
+	}
+	y, m, d := commons.Now().Date()
+	p.Title.Text = fmt.Sprintf("%4d.%02d.%02d#Compare %d days", y, m, d, days)
+	p.X.Label.Text = "Date"
+	p.X.Tick.Marker = plot.TimeTicks{Format: "2006-01-02"}
+	p.Y.Label.Text = "Return(%)"
+	p.Legend.Top = true
+	p.Legend.Left = true
+	p.Add(plotter.NewGrid())
+
+	for i, stockID := range stockIDs {
+		line, err := plotter.NewLine(cumulativeReturns(histories[stockID], timestampFrom))
+		if err != nil {
+			logger.Error("[ComparisonPlot] Error while drawing %s: %+v", stockID, err)
+			return false, ""
+		}
+		line.Color = overlayColors[i%len(overlayColors)]
+		if i >= len(overlayColors) {
+			line.Dashes = []vg.Length{vg.Points(4), vg.Points(2)}
+		}
+		p.Add(line)
+		p.Legend.Add(stockID, line)
+	}
+
+	saveDir := fmt.Sprintf(saveDirFormat, y, m, d)
+	savePath := saveDir + fmt.Sprintf(comparisonPathFormat, tag)
+	if err := p.Save(candlePlotWidth, candlePlotHeight, savePath); err != nil {
+		logger.Error("[ComparisonPlot] Error while saving: %+v", err)
+		return false, ""
+	}
+
+	wd, _ := os.Getwd()
+	if wd[len(wd)-1] != '/' {
+		wd += "/"
+	}
+	return true, wd + savePath
+}
@@ -0,0 +1,48 @@
+package analyser
+
+import (
+	"os"
+	"testing"
+
+	"github.com/helloworldpark/tickle-stock-watcher/structs"
+)
+
+func TestCumulativeReturns(t *testing.T) {
+	prices := newSinePrices("000001", 30, 0)
+	xys := cumulativeReturns(prices, prices[10].Timestamp)
+	if len(xys) != 20 {
+		t.Fatalf("Expected 20 returns, got %d", len(xys))
+	}
+	if xys[0].Y != 0 {
+		t.Errorf("Return of the first day must be 0, got %f", xys[0].Y)
+	}
+	expected := (float64(prices[29].Close)/float64(prices[10].Close) - 1) * 100
+	if xys[19].Y != expected {
+		t.Errorf("Expected %f, got %f", expected, xys[19].Y)
+	}
+}
+
+func TestComparisonPlot(t *testing.T) {
+	if err := MkCandlePlotDir(); err != nil && !os.IsExist(err) {
+		t.Fatal(err)
+	}
+	defer CleanupOldCandleplots()
+
+	stockIDs := []string{"000001", "000002", "000003"}
+	histories := map[string][]structs.StockPrice{
+		"000001": newSinePrices("000001", 80, 0),
+		"000002": newSinePrices("000002", 80, 1),
+		"000003": newSinePrices("000003", 40, 2),
+	}
+	didPlot, savePath := newComparisonPlotFromPrices(stockIDs, 60, histories, "_test")
+	if !didPlot {
+		t.Fatal("Failed to plot")
+	}
+	if _, err := os.Stat(savePath); err != nil {
+		t.Error(err)
+	}
+
+	if didPlot, _ := newComparisonPlotFromPrices(append(stockIDs, "000004"), 60, histories, "_test"); didPlot {
+		t.Error("Stock without prices must not be plotted")
+	}
+}
@@ -154,6 +154,30 @@ func (ld lagDifferenceIndicator) Calculate(index int) big.Decimal {
 	return latest.Sub(before)
 }
 
+// relativeStrengthIndicator return of the indicator over the period divided by that of the benchmark, 1 if the same
+type relativeStrengthIndicator struct {
+	indicator techan.Indicator
+	benchmark techan.Indicator
+	period    int
+}
+
+func newRelativeStrengthIndicator(indicator, benchmark techan.Indicator, period int) techan.Indicator {
+	return relativeStrengthIndicator{indicator: indicator, benchmark: benchmark, period: period}
+}
+
+func (rs relativeStrengthIndicator) Calculate(index int) big.Decimal {
+	if index < rs.period {
+		return big.ZERO
+	}
+	before := rs.indicator.Calculate(index - rs.period)
+	benchmarkBefore := rs.benchmark.Calculate(index - rs.period)
+	benchmark := rs.benchmark.Calculate(index)
+	if before.Zero() || benchmarkBefore.Zero() || benchmark.Zero() {
+		return big.ZERO
+	}
+	return rs.indicator.Calculate(index).Div(before).Div(benchmark.Div(benchmarkBefore))
+}
+
 type localExtremaIndicator struct {
 	indicator techan.Indicator
 	lag       int
@@ -520,3 +544,39 @@ func NewCustomMACDIndicator(baseIndicator techan.Indicator, shortwindow, longwin
 func NewCustomMACDHistogramIndicator(macdIdicator techan.Indicator, signalLinewindow int) techan.Indicator {
 	return techan.NewDifferenceIndicator(macdIdicator, NewCustomEMAIndicator(macdIdicator, signalLinewindow))
 }
+
+func newSMA(indicator techan.Indicator, window int) techan.Indicator {
+	return techan.NewSimpleMovingAverage(indicator, window)
+}
+
+func newEMA(indicator techan.Indicator, window int) techan.Indicator {
+	return NewCustomEMAIndicator(indicator, window)
+}
+
+// bollingerBandIndicator: moving average +- k * moving standard deviation
+type bollingerBandIndicator struct {
+	indicator techan.Indicator
+	window    int
+	k         float64
+}
+
+func newBollingerBandIndicator(indicator techan.Indicator, window int, k float64) techan.Indicator {
+	return bollingerBandIndicator{indicator: indicator, window: window, k: k}
+}
+
+func (bb bollingerBandIndicator) Calculate(index int) big.Decimal {
+	from := index - bb.window + 1
+	if from < 0 {
+		from = 0
+	}
+	n := float64(index - from + 1)
+	var sum, sumSquared float64
+	for i := from; i <= index; i++ {
+		v := bb.indicator.Calculate(i).Float()
+		sum += v
+		sumSquared += v * v
+	}
+	mean := sum / n
+	std := math.Sqrt(math.Max(0, sumSquared/n-mean*mean))
+	return big.NewDecimal(mean + bb.k*std)
+}
@@ -64,6 +64,27 @@ func makeIncrease() func(series *techan.TimeSeries, a ...interface{}) (techan.In
 	}
 }
 
+func makeRelativeStrength() func(series *techan.TimeSeries, a ...interface{}) (techan.Indicator, error) {
+	return func(series *techan.TimeSeries, a ...interface{}) (techan.Indicator, error) {
+		if len(a) != 3 {
+			return nil, newError(fmt.Sprintf("[RelativeStrength] Number of parameters incorrect: got %d, need 3", len(a)))
+		}
+		indicator, ok := a[0].(techan.Indicator)
+		if !ok {
+			return nil, newError(fmt.Sprintf("[RelativeStrength] First argument must be of type techan.Indicator, you are %v", a[0]))
+		}
+		benchmark, ok := a[1].(techan.Indicator)
+		if !ok {
+			return nil, newError(fmt.Sprintf("[RelativeStrength] Second argument must be of type techan.Indicator, you are %v", a[1]))
+		}
+		period, ok := a[2].(float64)
+		if !ok || period < 1 {
+			return nil, newError(fmt.Sprintf("[RelativeStrength] Period should be longer than 0, not %v", a[2]))
+		}
+		return newRelativeStrengthIndicator(indicator, benchmark, int(period)), nil
+	}
+}
+
 func makeExtrema() func(series *techan.TimeSeries, a ...interface{}) (techan.Indicator, error) {
 	return func(series *techan.TimeSeries, a ...interface{}) (techan.Indicator, error) {
 		if len(a) != 3 {
@@ -112,3 +133,53 @@ func makeIsZero() func(series *techan.TimeSeries, a ...interface{}) (techan.Indi
 		return newLocalZeroIndicator(indicator, lag, samples), nil
 	}
 }
+
+func makeMovingAverage(name string, ctor func(indicator techan.Indicator, window int) techan.Indicator) func(series *techan.TimeSeries, a ...interface{}) (techan.Indicator, error) {
+	return func(series *techan.TimeSeries, a ...interface{}) (techan.Indicator, error) {
+		// sma(20): 종가의 이동평균, sma(rsi(14), 20): 지표의 이동평균
+		var indicator techan.Indicator = techan.NewClosePriceIndicator(series)
+		switch len(a) {
+		case 1:
+		case 2:
+			var ok bool
+			indicator, ok = a[0].(techan.Indicator)
+			if !ok {
+				return nil, newError(fmt.Sprintf("[%s] First argument must be of type techan.Indicator, you are %v", name, a[0]))
+			}
+			a = a[1:]
+		default:
+			return nil, newError(fmt.Sprintf("[%s] Number of parameters incorrect: got %d, need 1 or 2", name, len(a)))
+		}
+		window := int(a[0].(float64))
+		if window < 1 {
+			return nil, newError(fmt.Sprintf("[%s] Window should be longer than 0, not %d", name, window))
+		}
+		return ctor(indicator, window), nil
+	}
+}
+
+func makeBollingerBand(isUpper bool) func(series *techan.TimeSeries, a ...interface{}) (techan.Indicator, error) {
+	return func(series *techan.TimeSeries, a ...interface{}) (techan.Indicator, error) {
+		if len(a) != 2 {
+			return nil, newError(fmt.Sprintf("[Bollinger] Number of parameters incorrect: got %d, need 2", len(a)))
+		}
+		window := int(a[0].(float64))
+		if window < 2 {
+			return nil, newError(fmt.Sprintf("[Bollinger] Window should be longer than 1, not %d", window))
+		}
+		k := a[1].(float64)
+		if !isUpper {
+			k = -k
+		}
+		return newBollingerBandIndicator(techan.NewClosePriceIndicator(series), window, k), nil
+	}
+}
+
+func makeVolume() func(series *techan.TimeSeries, a ...interface{}) (techan.Indicator, error) {
+	return func(series *techan.TimeSeries, a ...interface{}) (techan.Indicator, error) {
+		if len(a) != 0 {
+			return nil, newError(fmt.Sprintf("[Volume] Too many parameters: got %d, need 0", len(a)))
+		}
+		return techan.NewVolumeIndicator(series), nil
+	}
+}
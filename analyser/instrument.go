@@ -0,0 +1,261 @@
+package analyser
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/helloworldpark/govaluate"
+	"github.com/helloworldpark/tickle-stock-watcher/structs"
+)
+
+// instrumentSeparator joins a function name and the instrument it is evaluated on, i.e. close__of_kospi
+// Comes after the time frame if both are marked, i.e. rsi__w__of_kospi
+const instrumentSeparator = "__of_"
+
+var indexCall = regexp.MustCompile(`(?i)\bindex\s*\(`)
+var refCall = regexp.MustCompile(`(?i)\bref\s*\(`)
+
+// rsCall relative strength against an instrument, i.e. rs(kospi, 60)
+var rsCall = regexp.MustCompile(`(?i)\brs\s*\(\s*([^\s(),]+)\s*,\s*([0-9]+)\s*\)`)
+
+// stockCode code of a listed stock, i.e. 000660
+var stockCode = regexp.MustCompile(`^[0-9][0-9A-Z]{5}$`)
+
+// expandInstruments marks every function inside a call on another instrument with the instrument
+// ex) close() > index(kospi, sma(close(), 20)) -> close() > sma__of_kospi(close__of_kospi(), 20)
+// ex) close() / ref(000660, close()) < 0.8 -> close() / close__of_000660() < 0.8
+// ex) rs(kospi, 60) > 1 -> rs(close(), close__of_kospi(), 60) > 1
+func expandInstruments(statement string) (string, error) {
+	statement, err := expandRelativeStrength(statement)
+	if err != nil {
+		return "", err
+	}
+	statement, err = expandInstrumentCalls(statement, "index", indexCall, func(name string) (string, error) {
+		stockID, ok := structs.IndexFromName(name)
+		if !ok {
+			return "", newError(fmt.Sprintf("Unsupported index: %s", name))
+		}
+		return stockID, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return expandInstrumentCalls(statement, "ref", refCall, resolveInstrument)
+}
+
+// resolveInstrument stock ID of the instrument, either a market index or a stock code
+func resolveInstrument(name string) (string, error) {
+	if stockID, ok := structs.IndexFromName(name); ok {
+		return stockID, nil
+	}
+	stockID := strings.ToUpper(name)
+	if !stockCode.MatchString(stockID) {
+		return "", newError(fmt.Sprintf("Unsupported instrument: %s", name))
+	}
+	return stockID, nil
+}
+
+// expandRelativeStrength rewrites rs(instrument, period) into the relative strength of the close price against that of the instrument
+func expandRelativeStrength(statement string) (string, error) {
+	var err error
+	expanded := rsCall.ReplaceAllStringFunc(statement, func(call string) string {
+		groups := rsCall.FindStringSubmatch(call)
+		stockID, resolveErr := resolveInstrument(groups[1])
+		if resolveErr != nil {
+			err = resolveErr
+			return call
+		}
+		return fmt.Sprintf("rs(close(), %s(), %s)", seriesName("close", "", stockID), groups[2])
+	})
+	return expanded, err
+}
+
+// expandInstrumentCalls expands every call like name(instrument, expression) found by call.
+// The expression is wrapped by parentheses unless it is a single function call, so that a time frame can follow it.
+func expandInstrumentCalls(statement, name string, call *regexp.Regexp, resolve func(string) (string, error)) (string, error) {
+	for {
+		loc := call.FindStringIndex(statement)
+		if loc == nil {
+			return statement, nil
+		}
+		open := loc[1] - 1
+		end, err := clauseEnd(statement, open)
+		if err != nil {
+			return "", err
+		}
+		args := statement[open+1 : end]
+		comma := strings.Index(args, ",")
+		if comma < 0 {
+			return "", newError(fmt.Sprintf("%s needs an instrument and an expression: %s", name, statement[loc[0]:end+1]))
+		}
+		instrument, err := resolve(strings.TrimSpace(args[:comma]))
+		if err != nil {
+			return "", err
+		}
+		inner := strings.TrimSpace(args[comma+1:])
+		if len(inner) == 0 {
+			return "", newError(fmt.Sprintf("%s needs an expression: %s", name, statement[loc[0]:end+1]))
+		}
+		if strings.Contains(inner, instrumentSeparator) || call.MatchString(inner) {
+			return "", newError(fmt.Sprintf("%s cannot be nested: %s", name, statement[loc[0]:end+1]))
+		}
+		// 시간 단위를 먼저 붙여야 시간 단위가 함수 이름으로 오인되지 않는다
+		inner, err = expandTimeframes(inner)
+		if err != nil {
+			return "", err
+		}
+		marked := functionName.ReplaceAllStringFunc(inner, func(function string) string {
+			base, timeframe, _ := splitSeriesName(function)
+			return seriesName(base, timeframe, instrument)
+		})
+		if start, err := callStart(marked, len(marked)); err != nil || start != 0 {
+			marked = "(" + marked + ")"
+		}
+		statement = statement[:loc[0]] + marked + statement[end+1:]
+	}
+}
+
+// clauseEnd finds where the clause opened at open closes
+func clauseEnd(statement string, open int) (int, error) {
+	depth := 0
+	for i := open; i < len(statement); i++ {
+		if statement[i] == '(' {
+			depth++
+		} else if statement[i] == ')' {
+			depth--
+			if depth == 0 {
+				return i, nil
+			}
+		}
+	}
+	return 0, newError(fmt.Sprintf("Invalid pairing of clauses: %s", statement))
+}
+
+// seriesName marks the function name with the time frame and the instrument, both optional
+func seriesName(base, timeframe, instrument string) string {
+	name := base
+	if len(timeframe) > 0 {
+		name += timeframeSeparator + timeframe
+	}
+	if len(instrument) > 0 {
+		name += instrumentSeparator + strings.ToLower(instrument)
+	}
+	return name
+}
+
+// splitSeriesName splits a function name marked by expandInstruments and expandTimeframes
+// ex) rsi__w__of_kospi -> rsi, w, KOSPI
+func splitSeriesName(name string) (string, string, string) {
+	var instrument string
+	if i := strings.Index(name, instrumentSeparator); i >= 0 {
+		instrument = strings.ToUpper(name[i+len(instrumentSeparator):])
+		name = name[:i]
+	}
+	base, timeframe := splitTimeframe(name)
+	return base, timeframe, instrument
+}
+
+// referencedInstruments stock IDs of the other instruments the functions are evaluated on, sorted
+func referencedInstruments(fcns ...[]function) []string {
+	set := make(map[string]bool)
+	for _, functions := range fcns {
+		for _, f := range functions {
+			if f.t.Kind != govaluate.VARIABLE {
+				continue
+			}
+			if _, _, instrument := splitSeriesName(f.t.Value.(string)); len(instrument) > 0 {
+				set[instrument] = true
+			}
+		}
+	}
+	result := make([]string, 0, len(set))
+	for stockID := range set {
+		result = append(result, stockID)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// ReferencedInstruments stock IDs of the other instruments the strategy refers to, i.e. KOSPI of index(kospi, close())
+func ReferencedInstruments(strategy string) ([]string, error) {
+	fcns, err := parseStrategy(strategy)
+	if err != nil {
+		return nil, err
+	}
+	return referencedInstruments(fcns), nil
+}
+
+// instrumentArgument the instrument of ref() and rs(), i.e. 000660 of ref(000660, close())
+var instrumentArgument = regexp.MustCompile(`(?i)\b(ref|rs)(\s*\(\s*)([^\s(),]+)`)
+
+// ReplaceInstrument rewrites ref() and rs() of the strategy referring to the stock so that they refer to the other, i.e. when its code has changed.
+// Returns the strategy as is if it does not refer to the stock.
+func ReplaceInstrument(strategy, oldStockID, newStockID string) (string, error) {
+	replaced := instrumentArgument.ReplaceAllStringFunc(strategy, func(call string) string {
+		groups := instrumentArgument.FindStringSubmatch(call)
+		if stockID, err := resolveInstrument(groups[3]); err != nil || stockID != oldStockID {
+			return call
+		}
+		return groups[1] + groups[2] + newStockID
+	})
+	if _, err := parseStrategy(replaced); err != nil {
+		return strategy, err
+	}
+	return replaced, nil
+}
+
+// linkReference lets the strategies of this analyser be evaluated on the series of the other instrument
+func (a *Analyser) linkReference(stockID string, ref *Analyser) {
+	a.refs[stockID] = ref
+}
+
+// linkReferences links analysers of the instruments the functions refer to, filled with the prices by pricesOf
+func (a *Analyser) linkReferences(pricesOf func(stockID string) ([]structs.StockPrice, error), fcns ...[]function) error {
+	for _, stockID := range referencedInstruments(fcns...) {
+		if _, ok := a.refs[stockID]; ok || stockID == a.stockID {
+			continue
+		}
+		prices, err := pricesOf(stockID)
+		if err != nil {
+			return err
+		}
+		a.linkReference(stockID, newAnalyserWithPrices(stockID, prices))
+	}
+	return nil
+}
+
+// referencedByStrategies stock IDs of the other instruments the strategies of the analyser refer to
+func (a *Analyser) referencedByStrategies() map[string]bool {
+	result := make(map[string]bool)
+	for _, strategies := range a.userStrategy {
+		for _, wrapper := range strategies {
+			refs, err := ReferencedInstruments(wrapper.strategy.Strategy)
+			if err != nil {
+				continue
+			}
+			for _, stockID := range refs {
+				result[stockID] = true
+			}
+		}
+	}
+	return result
+}
+
+// noPrices for linking empty analysers, i.e. to check the syntax only
+func noPrices(stockID string) ([]structs.StockPrice, error) {
+	return nil, nil
+}
+
+// reference analyser of the instrument, itself if empty
+func (a *Analyser) reference(stockID string) (*Analyser, error) {
+	if len(stockID) == 0 || stockID == a.stockID {
+		return a, nil
+	}
+	ref, ok := a.refs[stockID]
+	if !ok {
+		return nil, newError(fmt.Sprintf("Prices of %s are not loaded", stockID))
+	}
+	return ref, nil
+}
@@ -0,0 +1,251 @@
+package analyser
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/helloworldpark/tickle-stock-watcher/commons"
+	"github.com/helloworldpark/tickle-stock-watcher/structs"
+)
+
+func TestExpandInstruments(t *testing.T) {
+	cases := map[string]string{
+		"close() > index(kospi, close())":              "close() > close__of_kospi()",
+		"index(KOSPI200, sma(close(), 20)) > 0":        "sma__of_kpi200(close__of_kpi200(), 20) > 0",
+		"index(kosdaq, close() - sma(close(), 5)) > 0": "(close__of_kosdaq() - sma__of_kosdaq(close__of_kosdaq(), 5)) > 0",
+		"index(kospi, rsi(14))@w < 30":                 "rsi__w__of_kospi(14) < 30",
+		"close() / ref(000660, close()) < 0.8":         "close() / close__of_000660() < 0.8",
+		"rs(kospi, 60) > 1":                            "rs(close(), close__of_kospi(), 60) > 1",
+		"rs(035720, 20) > rs(kosdaq, 20)":              "rs(close(), close__of_035720(), 20) > rs(close(), close__of_kosdaq(), 20)",
+		"index(kospi, rsi(14)@w) < 30":                 "rsi__w__of_kospi(14) < 30",
+	}
+	for statement, expected := range cases {
+		expanded, err := expandInstruments(statement)
+		if err == nil {
+			expanded, err = expandTimeframes(expanded)
+		}
+		if err != nil {
+			t.Errorf("%s: %v", statement, err)
+			continue
+		}
+		if expanded != expected {
+			t.Errorf("%s: expected %s, got %s", statement, expected, expanded)
+		}
+	}
+
+	for _, statement := range []string{"index(nasdaq, close()) > 0", "index(kospi) > 0", "index(kospi, index(kosdaq, close())) > 0", "index(kospi, close() > 0", "ref(samsung, close()) > 0", "rs(nasdaq, 60) > 1"} {
+		if _, err := expandInstruments(statement); err == nil {
+			t.Errorf("%s: expected error", statement)
+		}
+	}
+
+	refs, err := ReferencedInstruments("index(kospi, rsi(14))@w < 30 && close() > index(kosdaq, close()) && rs(000660, 5) > 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"000660", structs.IndexKOSDAQ, structs.IndexKOSPI}; !reflect.DeepEqual(refs, expected) {
+		t.Errorf("Expected %v, got %v", expected, refs)
+	}
+}
+
+func TestReplaceInstrument(t *testing.T) {
+	cases := map[string]string{
+		"close() / ref(000660, close()) < 0.8":                 "close() / ref(00066A, close()) < 0.8",
+		"rs(000660, 20) > 1 && rs(kospi, 20) > 1":              "rs(00066A, 20) > 1 && rs(kospi, 20) > 1",
+		"index(kospi, close()) > ref(035720, sma(close(), 5))": "index(kospi, close()) > ref(035720, sma(close(), 5))",
+	}
+	for strategy, expected := range cases {
+		replaced, err := ReplaceInstrument(strategy, "000660", "00066A")
+		if err != nil {
+			t.Errorf("%s: %v", strategy, err)
+			continue
+		}
+		if replaced != expected {
+			t.Errorf("%s: expected %s, got %s", strategy, expected, replaced)
+		}
+	}
+}
+
+func TestIndexStrategy(t *testing.T) {
+	ana := newAnalyserWithPrices("000001", newSinePrices("000001", 120, 0))
+	fcns, err := parseStrategy("index(kospi, close())")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ana.createIndicator(fcns); err == nil {
+		t.Error("Index must be linked before used")
+	}
+
+	// 지수는 50번째 날이 빠져 있다, 가격은 100배로 저장된다
+	index := newSinePrices(structs.IndexKOSPI, 120, 0)
+	for i := range index {
+		index[i].Close = (2000 + i) * structs.IndexPriceScale
+	}
+	index = append(index[:50], index[51:]...)
+	ana.linkReference(structs.IndexKOSPI, newAnalyserWithPrices(structs.IndexKOSPI, index))
+
+	indicator, err := ana.createIndicator(fcns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, expected := range map[int]float64{10: 2010, 50: 2049, 60: 2060, 119: 2119} {
+		if v := indicator.Calculate(i).Float(); v != expected {
+			t.Errorf("At %d: expected %v, got %v", i, expected, v)
+		}
+	}
+
+	ratio, err := ana.indicatorFromStatement("close() / index(kospi, close())")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, expected := ratio.Calculate(60).Float(), ana.timeSeries.Candles[60].ClosePrice.Float()/2060; v != expected {
+		t.Errorf("Expected ratio %v, got %v", expected, v)
+	}
+
+	fcns, err = parseStrategy("close() > 0 && index(kospi, sma(close(), 5)) > 2000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule, err := ana.createRule(fcns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule.IsSatisfied(ana.timeSeries.LastIndex(), nil)
+}
+
+func TestRelativeStrength(t *testing.T) {
+	ana := newAnalyserWithPrices("000001", newSinePrices("000001", 120, 0))
+	ref := newSinePrices("000660", 120, 0)
+	for i := range ref {
+		ref[i].Close *= 2
+	}
+	ana.linkReference("000660", newAnalyserWithPrices("000660", ref))
+
+	// 두 배로 움직여도 수익률은 같다
+	rs, err := ana.indicatorFromStatement("rs(000660, 10)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := rs.Calculate(60).Float(); math.Abs(v-1) > 1e-9 {
+		t.Errorf("Expected relative strength 1, got %v", v)
+	}
+	if v := rs.Calculate(5).Float(); v != 0 {
+		t.Errorf("Expected 0 before the period, got %v", v)
+	}
+
+	ratio, err := ana.indicatorFromStatement("close() / ref(000660, close())")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := ratio.Calculate(60).Float(); math.Abs(v-0.5) > 1e-9 {
+		t.Errorf("Expected ratio 0.5, got %v", v)
+	}
+}
+
+func TestBrokerReferences(t *testing.T) {
+	b := NewBroker(nil)
+	b.analysers["000001"] = newHolder("000001")
+	b.analysers[structs.IndexKOSPI] = newHolder(structs.IndexKOSPI)
+	var referred []string
+	b.SetReferenceHandler(func(stockID string, retained bool) {
+		referred = append(referred, fmt.Sprintf("%s:%v", stockID, retained))
+	})
+
+	strategy := structs.UserStock{UserID: 1, StockID: "000001", Strategy: "rs(kospi, 5) > 1"}
+	if _, err := b.AddStrategy(strategy, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	if count := b.analysers[structs.IndexKOSPI].analyser.Count(); count != 2 {
+		t.Errorf("Expected KOSPI referred twice, got %d", count)
+	}
+	if refs := b.ReferencedStocks(); !reflect.DeepEqual(refs, []string{structs.IndexKOSPI}) {
+		t.Errorf("Unexpected references: %v", refs)
+	}
+	if dependents := b.dependentsOf(structs.IndexKOSPI); len(dependents) != 1 || dependents[0].analyser.stockID != "000001" {
+		t.Errorf("Unexpected dependents: %v", dependents)
+	}
+
+	// 같은 전략을 참조 없이 바꾸면 놓아준다
+	strategy.Strategy = "close() > 0"
+	if _, err := b.AddStrategy(strategy, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	if count := b.analysers[structs.IndexKOSPI].analyser.Count(); count != 1 {
+		t.Errorf("Expected KOSPI referred once, got %d", count)
+	}
+	if refs := b.ReferencedStocks(); len(refs) != 0 {
+		t.Errorf("Unexpected references: %v", refs)
+	}
+	if expected := []string{"KOSPI:true", "KOSPI:false"}; !reflect.DeepEqual(referred, expected) {
+		t.Errorf("Expected %v, got %v", expected, referred)
+	}
+}
+
+// 참조하는 종목과 함께 시세를 받는 경우, go test -race 로 확인한다
+func TestFeedReferencedPrices(t *testing.T) {
+	b := NewBroker(nil)
+	b.analysers["000001"] = newHolder("000001")
+	b.analysers[structs.IndexKOSPI] = newHolder(structs.IndexKOSPI)
+
+	var mutex sync.Mutex
+	fired := 0
+	callback := func(price structs.StockPrice, orderSide int, userid int64, repeat bool) {
+		mutex.Lock()
+		fired++
+		mutex.Unlock()
+	}
+	strategy := structs.UserStock{UserID: 1, StockID: "000001", Strategy: "close() > index(kospi, close())", Repeat: true}
+	if _, err := b.AddStrategy(strategy, callback, false); err != nil {
+		t.Fatal(err)
+	}
+
+	providers := map[string]chan structs.StockPrice{
+		"000001":           make(chan structs.StockPrice),
+		structs.IndexKOSPI: make(chan structs.StockPrice),
+	}
+	bases := map[string]int{"000001": 3000, structs.IndexKOSPI: 2000}
+	for stockID, provider := range providers {
+		b.FeedPrice(stockID, provider)
+	}
+	var wg sync.WaitGroup
+	for stockID, provider := range providers {
+		wg.Add(1)
+		go func(stockID string, provider chan structs.StockPrice) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				provider <- structs.StockPrice{StockID: stockID, Close: bases[stockID] + i, Timestamp: commons.Now().Unix()}
+			}
+			close(provider)
+		}(stockID, provider)
+	}
+	wg.Wait()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !b.CanFeedPrice("000001") || !b.CanFeedPrice(structs.IndexKOSPI) {
+		if time.Now().After(deadline) {
+			t.Fatal("Feeding did not stop after the providers are closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if fired == 0 {
+		t.Error("Expected the strategy to be fired")
+	}
+}
+
+func TestIndexPriceScale(t *testing.T) {
+	ana := NewAnalyser(structs.IndexKOSPI)
+	price := structs.StockPrice{StockID: structs.IndexKOSPI, Timestamp: commons.Today().Unix(), Open: 214512, Close: 211996, High: 215094, Low: 211925, Volume: 623215}
+	ana.AppendPastPrice(price)
+	if c := ana.timeSeries.LastCandle().ClosePrice.Float(); c != 2119.96 {
+		t.Errorf("Expected the close in points, got %f", c)
+	}
+	if stored := candleToStockPrice(structs.IndexKOSPI, ana.timeSeries.LastCandle(), false); stored != price {
+		t.Errorf("Expected %+v, got %+v", price, stored)
+	}
+}
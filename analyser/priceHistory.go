@@ -0,0 +1,45 @@
+package analyser
+
+import (
+	"github.com/helloworldpark/tickle-stock-watcher/database"
+	"github.com/helloworldpark/tickle-stock-watcher/structs"
+)
+
+// loadPriceHistories loads price histories of every stock since timestampFrom in a single query, adjusted by corporate actions.
+// Returns
+//     map[string][]structs.StockPrice   Key: Stock ID, Value: prices ordered by timestamp
+func loadPriceHistories(dbClient *database.DBClient, timestampFrom int64) (map[string][]structs.StockPrice, error) {
+	var prices []structs.StockPrice
+	_, err := dbClient.Select(&prices,
+		"where Timestamp>=? order by StockID, Timestamp",
+		timestampFrom)
+	if err != nil {
+		return nil, err
+	}
+
+	actions, err := loadCorporateActions(dbClient)
+	if err != nil {
+		return nil, err
+	}
+
+	histories := make(map[string][]structs.StockPrice)
+	start := 0
+	for i := range prices {
+		if i+1 < len(prices) && prices[i+1].StockID == prices[i].StockID {
+			continue
+		}
+		stockID := prices[i].StockID
+		histories[stockID], _ = adjustPrices(prices[start:i+1], actions[stockID])
+		start = i + 1
+	}
+	return histories, nil
+}
+
+// newAnalyserWithPrices creates an Analyser whose time series is filled with the given prices
+func newAnalyserWithPrices(stockID string, prices []structs.StockPrice) *Analyser {
+	ana := NewAnalyser(stockID)
+	for i := range prices {
+		ana.AppendPastPrice(prices[i])
+	}
+	return ana
+}
@@ -0,0 +1,121 @@
+package analyser
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/helloworldpark/tickle-stock-watcher/commons"
+	"github.com/helloworldpark/tickle-stock-watcher/structs"
+)
+
+const (
+	// prospectCriteria name of the criteria used for finding prospects
+	prospectCriteria = "MACD"
+	// prospectDateFormat format of structs.Prospect.Date
+	prospectDateFormat = "2006-01-02"
+
+	// prospectAverageWindow days used for averaging volume and traded value
+	prospectAverageWindow = 20
+
+	weightSignal    = 0.5
+	weightVolume    = 0.3
+	weightLiquidity = 0.2
+)
+
+// Prospect is a stock found by the scouter, with its score
+type Prospect struct {
+	StockID  string
+	Score    float64  // 0 ~ 100
+	Reasons  []string // Human readable reasons of the score
+	ChartURL string
+}
+
+func (p Prospect) record(date string) structs.Prospect {
+	return structs.Prospect{
+		Date:     date,
+		StockID:  p.StockID,
+		Criteria: prospectCriteria,
+		Score:    p.Score,
+		Reasons:  strings.Join(p.Reasons, "\n"),
+		ChartURL: p.ChartURL,
+	}
+}
+
+func prospectFromRecord(record structs.Prospect) Prospect {
+	prospect := Prospect{
+		StockID:  record.StockID,
+		Score:    record.Score,
+		ChartURL: record.ChartURL,
+	}
+	if len(record.Reasons) > 0 {
+		prospect.Reasons = strings.Split(record.Reasons, "\n")
+	}
+	return prospect
+}
+
+// scoreProspect scores a prospect from its price history.
+// Score is a weighted sum of the following, each normalised into [0, 1]
+//     Signal strength:      slope of the smoothed MACD histogram relative to the price
+//     Volume confirmation:  volume of the last day compared to its average
+//     Liquidity:            average traded value
+func scoreProspect(stockID string, prices []structs.StockPrice) Prospect {
+	prospect := Prospect{StockID: stockID}
+	if len(prices) == 0 {
+		return prospect
+	}
+	ana := newAnalyserWithPrices(stockID, prices)
+	lastIndex := ana.timeSeries.LastIndex()
+	lastClose := ana.timeSeries.LastCandle().ClosePrice.Float()
+
+	// Signal strength
+	signal := 0.0
+	macdHist, _ := indicatorMap["macdhist"](ana.timeSeries, 12.0, 26.0, 9.0)
+	smoothSpline := newSmoothSplineCalculator(macdHist, 1, 7)
+	if g := smoothSpline.Graph(lastIndex); len(g) >= 7 && lastClose > 0 {
+		slope := (g[6] - g[4]) * 0.5
+		signal = clamp01(math.Tanh(slope / (0.002 * lastClose)))
+		prospect.Reasons = append(prospect.Reasons, fmt.Sprintf("MACD Hist 기울기 %+.2f", slope))
+	}
+
+	// Volume confirmation
+	volume := 0.0
+	from := commons.MaxInt(0, lastIndex-prospectAverageWindow)
+	var sumVolume, sumValue float64
+	for _, c := range ana.timeSeries.Candles[from:lastIndex] {
+		sumVolume += c.Volume.Float()
+		sumValue += c.Volume.Float() * c.ClosePrice.Float()
+	}
+	count := float64(lastIndex - from)
+	if count > 0 && sumVolume > 0 {
+		ratio := ana.timeSeries.LastCandle().Volume.Float() / (sumVolume / count)
+		volume = clamp01((ratio - 1) / 2)
+		prospect.Reasons = append(prospect.Reasons, fmt.Sprintf("거래량 평균 대비 %.1f배", ratio))
+	}
+
+	// Liquidity
+	liquidity := 0.0
+	if count > 0 && sumValue > 0 {
+		averageValue := sumValue / count
+		liquidity = clamp01((math.Log10(averageValue) - 8) / 3)
+		prospect.Reasons = append(prospect.Reasons, fmt.Sprintf("평균 거래대금 %.0f억원", averageValue/1e8))
+	}
+
+	prospect.Score = 100 * (weightSignal*signal + weightVolume*volume + weightLiquidity*liquidity)
+	return prospect
+}
+
+// sortProspects sorts prospects by score, and then by stock ID
+func sortProspects(prospects []Prospect) {
+	sort.Slice(prospects, func(i, j int) bool {
+		if prospects[i].Score != prospects[j].Score {
+			return prospects[i].Score > prospects[j].Score
+		}
+		return prospects[i].StockID < prospects[j].StockID
+	})
+}
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
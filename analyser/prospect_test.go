@@ -0,0 +1,66 @@
+package analyser
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/helloworldpark/tickle-stock-watcher/commons"
+)
+
+func TestScoreProspect(t *testing.T) {
+	prices := newSinePrices("000001", 120, math.Pi)
+	calm := scoreProspect("000001", prices)
+	if calm.Score < 0 || calm.Score > 100 {
+		t.Fatalf("Score out of range: %v", calm.Score)
+	}
+
+	spiked := newSinePrices("000001", 120, math.Pi)
+	spiked[len(spiked)-1].Volume = 3000
+	loud := scoreProspect("000001", spiked)
+	if loud.Score <= calm.Score {
+		t.Errorf("Volume spike must raise the score: %v <= %v", loud.Score, calm.Score)
+	}
+	if len(loud.Reasons) != 3 {
+		t.Errorf("Expected 3 reasons, got %v", loud.Reasons)
+	}
+}
+
+func TestSortProspects(t *testing.T) {
+	prospects := []Prospect{
+		{StockID: "000003", Score: 10},
+		{StockID: "000002", Score: 50},
+		{StockID: "000001", Score: 10},
+	}
+	sortProspects(prospects)
+	expected := []string{"000002", "000001", "000003"}
+	for i := range expected {
+		if prospects[i].StockID != expected[i] {
+			t.Errorf("Expected %s at %d, got %s", expected[i], i, prospects[i].StockID)
+		}
+	}
+}
+
+func TestProspectRecord(t *testing.T) {
+	prospect := Prospect{StockID: "000001", Score: 42, Reasons: []string{"a", "b"}, ChartURL: "url"}
+	record := prospect.record("2020-01-31")
+	if record.Date != "2020-01-31" || record.Criteria != prospectCriteria {
+		t.Errorf("Wrong record: %+v", record)
+	}
+	restored := prospectFromRecord(record)
+	if restored.StockID != prospect.StockID || restored.Score != prospect.Score ||
+		restored.ChartURL != prospect.ChartURL || len(restored.Reasons) != 2 {
+		t.Errorf("Expected %+v, got %+v", prospect, restored)
+	}
+}
+
+func TestProspectDate(t *testing.T) {
+	before := time.Date(2020, 1, 31, 19, 59, 0, 0, commons.AsiaSeoul)
+	if date := ProspectDate(before); date != "2020-01-30" {
+		t.Errorf("Expected 2020-01-30, got %s", date)
+	}
+	after := time.Date(2020, 1, 31, 20, 0, 0, 0, commons.AsiaSeoul)
+	if date := ProspectDate(after); date != "2020-01-31" {
+		t.Errorf("Expected 2020-01-31, got %s", date)
+	}
+}
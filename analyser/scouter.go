@@ -4,13 +4,17 @@ import (
 	"bytes"
 	"fmt"
 	"net/http"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/helloworldpark/tickle-stock-watcher/commons"
 	"github.com/helloworldpark/tickle-stock-watcher/database"
 	"github.com/helloworldpark/tickle-stock-watcher/logger"
 	"github.com/helloworldpark/tickle-stock-watcher/storage"
+	"github.com/helloworldpark/tickle-stock-watcher/structs"
 	"github.com/helloworldpark/tickle-stock-watcher/watcher"
 )
 
@@ -18,28 +22,101 @@ const days = 10
 const maxProspectsToShow = 5
 const baseURL = "https://storage.googleapis.com/ticklemeta-storage/"
 
-func findProspects(dbClient *database.DBClient, itemChecker *watcher.StockItemChecker) map[string]string {
+// prospectWorkers number of workers finding prospects concurrently
+var prospectWorkers = runtime.NumCPU()
+
+// SetProspectWorkers sets the number of workers used for finding prospects and drawing their charts
+func SetProspectWorkers(n int) {
+	if n < 1 {
+		logger.Warn("[Analyser][Prospects] Invalid number of workers: %d", n)
+		return
+	}
+	prospectWorkers = n
+}
+
+type prospectCandidate struct {
+	stock  structs.Stock
+	prices []structs.StockPrice
+}
+
+func findProspects(dbClient *database.DBClient, itemChecker *watcher.StockItemChecker) []Prospect {
 	stocks := itemChecker.AllStockID()
-	logger.Info("[Analyser][Prospects] Finding from %d stocks", len(stocks))
-
-	result := make(map[string]string)
-	for _, stockID := range stocks {
-		prospects := NewProspect(dbClient, days, stockID)
-		if len(prospects) > 0 {
-			didPlot, savePath := NewCandlePlot(dbClient, days, stockID, itemChecker)
-			result[stockID] = ""
-			if didPlot {
-				savePath, err := uploadLocalImage(savePath)
-				if err == nil {
-					result[stockID] = baseURL + savePath
+	logger.Info("[Analyser][Prospects] Finding from %d stocks with %d workers", len(stocks), prospectWorkers)
+
+	histories, err := loadPriceHistories(dbClient, priceTimestampFrom(days))
+	if err != nil {
+		logger.Error("[Analyser][Prospects] Error while loading price histories: %+v", err)
+		return nil
+	}
+
+	// 1단계: 종목별 조건 검사
+	jobs := make(chan structs.Stock)
+	candidates := make(chan prospectCandidate)
+	var evaluated int64
+	var wgEvaluate sync.WaitGroup
+	for w := 0; w < prospectWorkers; w++ {
+		wgEvaluate.Add(1)
+		commons.InvokeGoroutine(fmt.Sprintf("analyser_findProspects_evaluate%d", w), func() {
+			defer wgEvaluate.Done()
+			for stock := range jobs {
+				prices := histories[stock.StockID]
+				if len(prices) > 0 && len(newProspectFromPrices(stock.StockID, prices)) > 0 {
+					candidates <- prospectCandidate{stock: stock, prices: prices}
+				}
+				n := atomic.AddInt64(&evaluated, 1)
+				if step := int64(len(stocks)/10 + 1); n%step == 0 {
+					logger.Info("[Analyser][Prospects] Evaluated %d/%d stocks", n, len(stocks))
 				}
 			}
+		})
+	}
+	commons.InvokeGoroutine("analyser_findProspects_jobs", func() {
+		for _, stockID := range stocks {
+			stock, _ := itemChecker.StockFromID(stockID)
+			jobs <- stock
 		}
+		close(jobs)
+		wgEvaluate.Wait()
+		close(candidates)
+	})
+
+	// 2단계: 걸린 종목들의 점수를 매기고 차트를 그려서 올린다
+	scored := make(chan Prospect)
+	var wgPlot sync.WaitGroup
+	for w := 0; w < prospectWorkers; w++ {
+		wgPlot.Add(1)
+		commons.InvokeGoroutine(fmt.Sprintf("analyser_findProspects_plot%d", w), func() {
+			defer wgPlot.Done()
+			for candidate := range candidates {
+				result := scoreProspect(candidate.stock.StockID, candidate.prices)
+				didPlot, savePath := newCandlePlotFromPrices(candidate.stock, days, candidate.prices, ProspectCandlePlotOptions)
+				if didPlot {
+					savePath, err := uploadLocalImage(savePath)
+					if err == nil {
+						result.ChartURL = baseURL + savePath
+					} else {
+						logger.Error("[Analyser][Prospects] Error while uploading chart of %s: %+v", result.StockID, err)
+					}
+				}
+				scored <- result
+			}
+		})
+	}
+	commons.InvokeGoroutine("analyser_findProspects_plotWait", func() {
+		wgPlot.Wait()
+		close(scored)
+	})
+
+	var result []Prospect
+	for prospect := range scored {
+		result = append(result, prospect)
 	}
+	sortProspects(result)
+	logger.Info("[Analyser][Prospects] Found %d prospects from %d stocks", len(result), len(stocks))
 	return result
 }
 
-func runOnFind(stockID, picURL string, itemChecker *watcher.StockItemChecker, now time.Time, onFind func(msg, picURL string)) {
+func runOnFind(rank int, prospect Prospect, itemChecker *watcher.StockItemChecker, now time.Time, onFind func(msg, picURL string)) {
 	var buf bytes.Buffer
 	addLine := func(str string, args ...interface{}) {
 		if len(args) > 0 {
@@ -49,14 +126,14 @@ func runOnFind(stockID, picURL string, itemChecker *watcher.StockItemChecker, no
 		buf.WriteString("\n")
 	}
 
-	stockInfo, _ := itemChecker.StockFromID(stockID)
+	stockInfo, _ := itemChecker.StockFromID(prospect.StockID)
 	addLine("[Prospect] %v", now)
-	addLine("[Prospect] #%s: %s", stockID, stockInfo.Name)
-	if len(picURL) > 0 {
-		onFind(buf.String(), picURL)
-	} else {
-		onFind(buf.String(), "")
+	addLine("[Prospect] %d위 #%s: %s", rank, prospect.StockID, stockInfo.Name)
+	addLine("[Prospect] 점수: %.1f", prospect.Score)
+	for _, reason := range prospect.Reasons {
+		addLine("    - %s", reason)
 	}
+	onFind(buf.String(), prospect.ChartURL)
 }
 
 func cleanupLocal() {
@@ -70,88 +147,103 @@ func cleanupLocal() {
 	}
 }
 
-func cleanupGlobal(t time.Time) {
-	y, m, d := t.Date()
-	storagePath := fmt.Sprintf(saveDirFormat, y, m, d)
-	storagePath = storagePath[:len(storagePath)-1]
+// ProspectDate returns the date of prospects which are active at t.
+// Prospects are found at 20:00, so the prospects of the previous day are active before then.
+func ProspectDate(t time.Time) string {
+	t = t.In(commons.AsiaSeoul)
+	if t.Hour() < 20 {
+		t = t.AddDate(0, 0, -1)
+	}
+	return t.Format(prospectDateFormat)
+}
 
-	storage.Clean(storagePath)
+// ProspectsOfDate returns prospects recorded on date(yyyy-mm-dd), ranked by their scores
+func ProspectsOfDate(dbClient *database.DBClient, date string) ([]Prospect, error) {
+	prospects, _, err := prospectsOfDate(dbClient, date)
+	return prospects, err
 }
 
-func ActiveProspects(dbClient *database.DBClient, itemChecker *watcher.StockItemChecker) (map[string]string, time.Time) {
-	now := commons.Now()
-	hour := now.Hour()
-
-	var y, d int
-	var m time.Month
-	if hour < 20 {
-		// 당일 20:00 전
-		y, m, d = now.AddDate(0, 0, -1).Date()
-	} else {
-		// 당일 20:00 이후
-		y, m, d = now.Date()
-
-		// 전날 쌓아둔 캐시는 혹시 있으면 날린다
-		cleanupGlobal(now.AddDate(0, 0, -1))
-	}
-	storagePath := fmt.Sprintf(saveDirFormat, y, m, d)
-	storagePath = storagePath[:len(storagePath)-1]
-	filesAttrs := storage.FilesInDirectory(storagePath)
-
-	hasCache := (len(filesAttrs) > 0)
-	isCacheValid := false
-	if hasCache {
-		// 캐시가 있다
-		latest := filesAttrs[0].Updated
-		for _, attr := range filesAttrs {
-			if attr.Updated.After(latest) {
-				latest = attr.Updated
-			}
-		}
-		latest = latest.In(commons.AsiaSeoul)
-		// 유효한 캐시: referenceTime에서 24시간 이내, 20:00 기준
-		referenceTime := time.Date(y, m, d, 20, 0, 0, 0, commons.AsiaSeoul)
-		isCacheValid = latest.After(referenceTime) && latest.Before(referenceTime.AddDate(0, 0, 1))
-		if !isCacheValid {
-			// 무효한 캐시이니 날려버린다
-			cleanupGlobal(latest)
+// prospectsOfDate returns prospects recorded on date(yyyy-mm-dd), ranked by their scores,
+// and whether prospects were found on the date, even if none, i.e. marked by structs.NoProspect.
+func prospectsOfDate(dbClient *database.DBClient, date string) ([]Prospect, bool, error) {
+	var records []structs.Prospect
+	_, err := dbClient.Select(&records,
+		"where Date=? and Criteria=? order by Score desc, StockID",
+		date, prospectCriteria)
+	if err != nil {
+		return nil, false, err
+	}
+	prospects := make([]Prospect, 0, len(records))
+	for i := range records {
+		if records[i].StockID == structs.NoProspect {
+			continue
 		}
+		prospects = append(prospects, prospectFromRecord(records[i]))
 	}
+	return prospects, len(records) > 0, nil
+}
 
-	prospects := make(map[string]string)
-	if hasCache && isCacheValid {
-		logger.Warn("[Analyser][Scouter] Cache: YES, Prospect: Cache")
-		// 유효한 캐시라면 그 캐시값을 내려보낸다
-		for _, attrs := range filesAttrs {
-			paths := strings.Split(attrs.Name, "/")
-			if len(paths) >= 3 {
-				stockID := paths[len(paths)-1]
-				stockID = strings.TrimLeft(stockID, "candle")
-				stockID = strings.TrimRight(stockID, ".png")
-				savePath := strings.Join(paths[len(paths)-3:], "/")
-				prospects[stockID] = baseURL + savePath
-			}
-		}
-	} else {
-		if !hasCache {
-			logger.Warn("[Analyser][Scouter] Cache: NO, Prospect: Find")
-		} else if !isCacheValid {
-			logger.Warn("[Analyser][Scouter] Cache: INVALID, Prospect: Find")
+// ProspectsSince returns prospects recorded on or after date(yyyy-mm-dd), ranked by their scores.
+// A stock found on several days appears once, with its best score.
+func ProspectsSince(dbClient *database.DBClient, date string) ([]Prospect, error) {
+	var records []structs.Prospect
+	_, err := dbClient.Select(&records,
+		"where Date>=? and Criteria=? order by Score desc, StockID",
+		date, prospectCriteria)
+	if err != nil {
+		return nil, err
+	}
+	found := map[string]bool{structs.NoProspect: true}
+	var prospects []Prospect
+	for i := range records {
+		if found[records[i].StockID] {
+			continue
 		}
+		found[records[i].StockID] = true
+		prospects = append(prospects, prospectFromRecord(records[i]))
+	}
+	return prospects, nil
+}
 
-		// 캐시가 없다
-		// 새로 만들어서 내려보낸다
-		cleanupLocal()
-		prospects = findProspects(dbClient, itemChecker)
-		// 다 만들었으니 로컬 파일은 삭제
-		cleanupLocal()
+// ActiveProspects returns prospects of the day, ranked by their scores.
+// Prospects are found and recorded only if they are not recorded yet.
+func ActiveProspects(dbClient *database.DBClient, itemChecker *watcher.StockItemChecker) ([]Prospect, time.Time) {
+	now := commons.Now()
+	date := ProspectDate(now)
+
+	prospects, recorded, err := prospectsOfDate(dbClient, date)
+	if err != nil {
+		logger.Error("[Analyser][Scouter] Error while loading prospects of %s: %+v", date, err)
+	}
+	if recorded {
+		logger.Warn("[Analyser][Scouter] Cache: YES(%s), Prospect: Cache", date)
+		return prospects, now
 	}
+	logger.Warn("[Analyser][Scouter] Cache: NO(%s), Prospect: Find", date)
 
+	// 새로 만들어서 기록하고 내려보낸다
+	cleanupLocal()
+	prospects = findProspects(dbClient, itemChecker)
+	// 다 만들었으니 로컬 파일은 삭제
+	cleanupLocal()
+
+	records := make([]interface{}, len(prospects))
+	for i := range prospects {
+		records[i] = prospects[i].record(date)
+	}
+	// 찾은 것이 없는 날도 찾아본 날로 기록한다
+	if len(records) == 0 {
+		records = append(records, Prospect{StockID: structs.NoProspect}.record(date))
+	}
+	if _, err := dbClient.BulkUpsert(records...); err != nil {
+		logger.Error("[Analyser][Scouter] Error while recording prospects of %s: %+v", date, err)
+	}
 	return prospects, now
 }
 
 // FindProspects Find prospects using this function. This function uses cache.
-func FindProspects(dbClient *database.DBClient, itemChecker *watcher.StockItemChecker, onFind func(msg, savePath string)) {
+// Only the prospects in the sector are shown, every prospect if the sector is empty.
+func FindProspects(dbClient *database.DBClient, itemChecker *watcher.StockItemChecker, sector string, onFind func(msg, savePath string)) {
 	addLine := func(buf *bytes.Buffer, str string, args ...interface{}) {
 		if buf == nil {
 			return
@@ -163,19 +255,19 @@ func FindProspects(dbClient *database.DBClient, itemChecker *watcher.StockItemCh
 		buf.WriteString("\n")
 	}
 
-	showProspects := func(pros map[string]string, now time.Time) {
+	showProspects := func(pros []Prospect, now time.Time) {
 		var count = 0
 		var buf bytes.Buffer
-		for stockID, url := range pros {
+		for _, prospect := range pros {
 			count++
 			if count <= maxProspectsToShow {
-				runOnFind(stockID, url, itemChecker, now, onFind)
+				runOnFind(count, prospect, itemChecker, now, onFind)
 			} else {
-				stockInfo, _ := itemChecker.StockFromID(stockID)
+				stockInfo, _ := itemChecker.StockFromID(prospect.StockID)
 				if count == maxProspectsToShow+1 {
 					addLine(&buf, "[Prospect] ...and others!")
 				}
-				addLine(&buf, "    #%s: %s(%s)", stockID, stockInfo.Name, url)
+				addLine(&buf, "    %d위 #%s: %s [%.1f](%s)", count, prospect.StockID, stockInfo.Name, prospect.Score, prospect.ChartURL)
 			}
 		}
 		if count > maxProspectsToShow {
@@ -185,8 +277,22 @@ func FindProspects(dbClient *database.DBClient, itemChecker *watcher.StockItemCh
 		onFind("saveProspects 를 입력하여 이들을 전부 감시하십시오", "")
 	}
 
-	prospectMap, timeNow := ActiveProspects(dbClient, itemChecker)
-	showProspects(prospectMap, timeNow)
+	prospects, timeNow := ActiveProspects(dbClient, itemChecker)
+	showProspects(prospectsInSector(prospects, itemChecker, sector), timeNow)
+}
+
+// prospectsInSector filters the prospects by the sector, keeping the order
+func prospectsInSector(prospects []Prospect, itemChecker *watcher.StockItemChecker, sector string) []Prospect {
+	if len(sector) == 0 {
+		return prospects
+	}
+	var result []Prospect
+	for _, prospect := range prospects {
+		if stock, ok := itemChecker.StockFromID(prospect.StockID); ok && stock.InSector(sector) {
+			result = append(result, prospect)
+		}
+	}
+	return result
 }
 
 func uploadLocalImage(localPath string) (string, error) {
@@ -20,5 +20,5 @@ func TestFindProspect(t *testing.T) {
 		fmt.Println(msg, savePath)
 	}
 
-	FindProspects(dbClient, itemChecker, onFind)
+	FindProspects(dbClient, itemChecker, "", onFind)
 }
@@ -0,0 +1,163 @@
+package analyser
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/helloworldpark/tickle-stock-watcher/commons"
+	"github.com/helloworldpark/tickle-stock-watcher/database"
+	"github.com/helloworldpark/tickle-stock-watcher/logger"
+	"github.com/helloworldpark/tickle-stock-watcher/structs"
+	"github.com/helloworldpark/tickle-stock-watcher/watcher"
+)
+
+// screenLookbackDays how many calendar days of price history are used for screening
+const screenLookbackDays = 200
+
+// ScreenRequest describes an on-demand screening
+type ScreenRequest struct {
+	Strategy   string             // Rule to evaluate, written in the strategy DSL
+	Market     structs.Market     // Empty for every market
+	Instrument structs.Instrument // Empty for every type of instruments
+	Sector     string             // Empty for every sector, matched with the sector or the industry
+	SortBy     string             // Indicator to sort the result by, written in the strategy DSL
+}
+
+// ScreenResult is a stock satisfying the rule of ScreenRequest
+type ScreenResult struct {
+	StockID string
+	Name    string
+	Close   int
+	Value   float64 // Value of the indicator SortBy at the last candle
+}
+
+type screenJob struct {
+	stock  structs.Stock
+	prices []structs.StockPrice
+}
+
+// Screen evaluates the rule of the request on the last candle of every listed stock's stored history.
+// Matched stocks are sorted by SortBy in descending order, or by stock ID if SortBy is empty.
+func Screen(dbClient *database.DBClient, itemChecker *watcher.StockItemChecker, request ScreenRequest) ([]ScreenResult, error) {
+	// 문법 오류는 전 종목을 뒤지기 전에 걸러낸다
+	ruleTokens, err := parseStrategy(request.Strategy)
+	if err != nil {
+		return nil, err
+	}
+	var sortTokens []function
+	if len(request.SortBy) > 0 {
+		sortTokens, err = parseStrategy(request.SortBy)
+		if err != nil {
+			return nil, err
+		}
+	}
+	validator := NewAnalyser("")
+	validator.linkReferences(noPrices, ruleTokens, sortTokens)
+	if _, err = validator.createRule(ruleTokens); err != nil {
+		return nil, err
+	}
+	if len(sortTokens) > 0 {
+		if _, err = validator.createIndicator(sortTokens); err != nil {
+			return nil, err
+		}
+	}
+
+	timestampFrom := commons.Now().Unix() - 60*60*24*screenLookbackDays
+	histories, err := loadPriceHistories(dbClient, timestampFrom)
+	if err != nil {
+		return nil, err
+	}
+	// 지수 등 참조하는 종목은 각 종목의 분석기마다 따로 만든다
+	pricesOf := func(stockID string) ([]structs.StockPrice, error) {
+		return histories[stockID], nil
+	}
+
+	jobs := make(chan screenJob)
+	results := make(chan ScreenResult)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		commons.InvokeGoroutine(fmt.Sprintf("analyser_Screen_worker%d", w), func() {
+			defer wg.Done()
+			for job := range jobs {
+				if result, ok := screenStock(job, pricesOf, ruleTokens, sortTokens); ok {
+					results <- result
+				}
+			}
+		})
+	}
+	commons.InvokeGoroutine("analyser_Screen_jobs", func() {
+		for _, stockID := range itemChecker.AllStockID() {
+			stock, _ := itemChecker.StockFromID(stockID)
+			if len(request.Market) > 0 && stock.MarketType != request.Market {
+				continue
+			}
+			if len(request.Instrument) > 0 && stock.Instrument != request.Instrument {
+				continue
+			}
+			if !stock.InSector(request.Sector) {
+				continue
+			}
+			prices, ok := histories[stockID]
+			if !ok {
+				continue
+			}
+			jobs <- screenJob{stock: stock, prices: prices}
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	})
+
+	var matched []ScreenResult
+	for result := range results {
+		matched = append(matched, result)
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if len(sortTokens) > 0 && matched[i].Value != matched[j].Value {
+			return matched[i].Value > matched[j].Value
+		}
+		return matched[i].StockID < matched[j].StockID
+	})
+	logger.Info("[Analyser][Screen] %s: %d matched out of %d histories", request.Strategy, len(matched), len(histories))
+	return matched, nil
+}
+
+func screenStock(job screenJob, pricesOf func(string) ([]structs.StockPrice, error), ruleTokens, sortTokens []function) (result ScreenResult, matched bool) {
+	defer func() {
+		// 가격 정보가 너무 짧은 종목은 지표 계산 중에 터질 수 있다
+		if v := recover(); v != nil {
+			logger.Warn("[Analyser][Screen] Skipped %s: %v", job.stock.StockID, v)
+			matched = false
+		}
+	}()
+
+	ana := newAnalyserWithPrices(job.stock.StockID, job.prices)
+	if err := ana.linkReferences(pricesOf, ruleTokens, sortTokens); err != nil {
+		return result, false
+	}
+	rule, err := ana.createRule(ruleTokens)
+	if err != nil {
+		return result, false
+	}
+	lastIndex := ana.timeSeries.LastIndex()
+	if !rule.IsSatisfied(lastIndex, nil) {
+		return result, false
+	}
+
+	result = ScreenResult{
+		StockID: job.stock.StockID,
+		Name:    job.stock.Name,
+		Close:   int(ana.timeSeries.LastCandle().ClosePrice.Float()),
+	}
+	if len(sortTokens) > 0 {
+		indicator, err := ana.createIndicator(sortTokens)
+		if err != nil {
+			return result, false
+		}
+		result.Value = indicator.Calculate(lastIndex).Float()
+	}
+	return result, true
+}
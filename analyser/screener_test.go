@@ -0,0 +1,67 @@
+package analyser
+
+import (
+	"math"
+	"testing"
+
+	"github.com/helloworldpark/tickle-stock-watcher/structs"
+)
+
+func newSinePrices(stockID string, n int, phase float64) []structs.StockPrice {
+	prices := make([]structs.StockPrice, n)
+	for i := range prices {
+		c := int(1000 + 100*math.Sin(float64(i)/10+phase))
+		prices[i] = structs.StockPrice{
+			StockID:   stockID,
+			Timestamp: int64(1500000000 + i*24*60*60),
+			Open:      c,
+			Close:     c,
+			High:      c + 5,
+			Low:       c - 5,
+			Volume:    1000,
+		}
+	}
+	return prices
+}
+
+func TestScreenStock(t *testing.T) {
+	ruleTokens, err := parseStrategy("close() > 1000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sortTokens, err := parseStrategy("rsi(14)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	above := screenJob{stock: structs.Stock{StockID: "000001"}, prices: newSinePrices("000001", 120, math.Pi)}
+	result, ok := screenStock(above, noPrices, ruleTokens, sortTokens)
+	if !ok {
+		t.Fatalf("Expected %v to be matched", result)
+	}
+	if result.Value <= 0 || result.Value > 100 {
+		t.Errorf("RSI out of range: %v", result.Value)
+	}
+
+	below := screenJob{stock: structs.Stock{StockID: "000002"}, prices: newSinePrices("000002", 120, 0)}
+	if result, ok := screenStock(below, noPrices, ruleTokens, sortTokens); ok {
+		t.Errorf("Expected %v not to be matched", result)
+	}
+}
+
+func TestCreateIndicator(t *testing.T) {
+	ana := newAnalyserWithPrices("000001", newSinePrices("000001", 30, 0))
+	for _, expr := range []string{"close()", "close() / 2", "-close()"} {
+		tokens, err := parseStrategy(expr)
+		if err != nil {
+			t.Fatal(expr, err)
+		}
+		if _, err := ana.createIndicator(tokens); err != nil {
+			t.Errorf("%s: %v", expr, err)
+		}
+	}
+	tokens, _ := parseStrategy("close() > 3")
+	if _, err := ana.createIndicator(tokens); err == nil {
+		t.Error("Rule must not be an indicator")
+	}
+}
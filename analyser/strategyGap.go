@@ -0,0 +1,167 @@
+package analyser
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/helloworldpark/tickle-stock-watcher/database"
+	"github.com/helloworldpark/tickle-stock-watcher/structs"
+	"github.com/sdcoffey/techan"
+)
+
+// gapLookbackDays how many trading days of price history are used for measuring the gaps
+const gapLookbackDays = 120
+
+var logicalOperators = regexp.MustCompile(`&&|\|\|`)
+
+// comparators are ordered so that two letter comparators are found first
+var comparators = []string{">=", "<=", "==", ">", "<"}
+
+// ConditionGap is how far a comparison in a strategy is from being satisfied at the last candle
+type ConditionGap struct {
+	Condition   string
+	Left, Right float64
+	Satisfied   bool
+	Gap         float64 // In percent of Left, 0 if satisfied
+}
+
+// StrategyGaps measures the gaps of every comparison in the strategy from the stored prices of the stock
+func StrategyGaps(dbClient *database.DBClient, stockID, strategy string) ([]ConditionGap, error) {
+	prices, err := selectPricesForDays(dbClient, gapLookbackDays, stockID)
+	if err != nil {
+		return nil, err
+	}
+	fcns, err := parseStrategy(strategy)
+	if err != nil {
+		return nil, err
+	}
+	ana := newAnalyserWithPrices(stockID, prices)
+	err = ana.linkReferences(func(refID string) ([]structs.StockPrice, error) {
+		return selectPricesForDays(dbClient, gapLookbackDays, refID)
+	}, fcns)
+	if err != nil {
+		return nil, err
+	}
+	return strategyGapsOf(ana, strategy)
+}
+
+func strategyGapsFromPrices(stockID string, prices []structs.StockPrice, strategy string) ([]ConditionGap, error) {
+	return strategyGapsOf(newAnalyserWithPrices(stockID, prices), strategy)
+}
+
+// strategyGapsOf measures the gaps at the last candle of the analyser
+func strategyGapsOf(ana *Analyser, strategy string) ([]ConditionGap, error) {
+	if len(ana.timeSeries.Candles) == 0 {
+		return nil, newError(fmt.Sprintf("No prices of %s", ana.stockID))
+	}
+	lastIndex := ana.timeSeries.LastIndex()
+
+	var gaps []ConditionGap
+	for _, condition := range splitConditions(strategy) {
+		left, comparator, right, err := splitComparison(condition)
+		if err != nil {
+			return nil, err
+		}
+		lhs, err := ana.indicatorFromStatement(left)
+		if err != nil {
+			return nil, err
+		}
+		rhs, err := ana.indicatorFromStatement(right)
+		if err != nil {
+			return nil, err
+		}
+		gap := ConditionGap{
+			Condition: condition,
+			Left:      lhs.Calculate(lastIndex).Float(),
+			Right:     rhs.Calculate(lastIndex).Float(),
+		}
+		gap.Satisfied, gap.Gap = measureGap(gap.Left, comparator, gap.Right)
+		gaps = append(gaps, gap)
+	}
+	return gaps, nil
+}
+
+func (a *Analyser) indicatorFromStatement(statement string) (techan.Indicator, error) {
+	fcns, err := parseStrategy(statement)
+	if err != nil {
+		return nil, err
+	}
+	return a.createIndicator(fcns)
+}
+
+// splitConditions splits the strategy by logical operators, removing unpaired parentheses
+// ex) (close() > 1000) && rsi(14) < 30 -> [close() > 1000, rsi(14) < 30]
+func splitConditions(strategy string) []string {
+	var conditions []string
+	for _, condition := range logicalOperators.Split(strategy, -1) {
+		condition = strings.TrimSpace(condition)
+		for strings.HasPrefix(condition, "(") && strings.Count(condition, "(") > strings.Count(condition, ")") {
+			condition = strings.TrimSpace(condition[1:])
+		}
+		for strings.HasSuffix(condition, ")") && strings.Count(condition, ")") > strings.Count(condition, "(") {
+			condition = strings.TrimSpace(condition[:len(condition)-1])
+		}
+		for isWrapped(condition) {
+			condition = strings.TrimSpace(condition[1 : len(condition)-1])
+		}
+		if len(condition) > 0 {
+			conditions = append(conditions, condition)
+		}
+	}
+	return conditions
+}
+
+// isWrapped tells if the whole statement is wrapped by a pair of parentheses
+func isWrapped(statement string) bool {
+	if !strings.HasPrefix(statement, "(") || !strings.HasSuffix(statement, ")") {
+		return false
+	}
+	depth := 0
+	for i, c := range statement {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+		if depth == 0 {
+			return i == len(statement)-1
+		}
+	}
+	return false
+}
+
+func splitComparison(condition string) (string, string, string, error) {
+	for _, comparator := range comparators {
+		if i := strings.Index(condition, comparator); i >= 0 {
+			return condition[:i], comparator, condition[i+len(comparator):], nil
+		}
+	}
+	return "", "", "", newError(fmt.Sprintf("No comparison in %s", condition))
+}
+
+// measureGap tells if left and right satisfy the comparator, or how much left should move in percent to satisfy
+func measureGap(left float64, comparator string, right float64) (bool, float64) {
+	var satisfied bool
+	switch comparator {
+	case ">":
+		satisfied = left > right
+	case ">=":
+		satisfied = left >= right
+	case "<":
+		satisfied = left < right
+	case "<=":
+		satisfied = left <= right
+	case "==":
+		satisfied = left == right
+	}
+	if satisfied {
+		return true, 0
+	}
+	if left == 0 {
+		return false, math.Inf(1)
+	}
+	return false, math.Abs(right-left) / math.Abs(left) * 100
+}
@@ -0,0 +1,42 @@
+package analyser
+
+import "testing"
+
+func TestSplitConditions(t *testing.T) {
+	conditions := splitConditions("(close() > 1000) && (rsi(14) < 30 || sma(5) >= sma(20))")
+	expected := []string{"close() > 1000", "rsi(14) < 30", "sma(5) >= sma(20)"}
+	if len(conditions) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, conditions)
+	}
+	for i := range expected {
+		if conditions[i] != expected[i] {
+			t.Errorf("Expected %s, got %s", expected[i], conditions[i])
+		}
+	}
+}
+
+func TestStrategyGaps(t *testing.T) {
+	prices := newSinePrices("000001", 60, 0)
+	last := float64(prices[len(prices)-1].Close)
+
+	gaps, err := strategyGapsFromPrices("000001", prices, "close() > 100000 && close() >= 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gaps) != 2 {
+		t.Fatalf("Expected 2 gaps, got %d", len(gaps))
+	}
+	if gaps[0].Satisfied || gaps[0].Left != last {
+		t.Errorf("Unexpected gap: %+v", gaps[0])
+	}
+	if expected := (100000 - last) / last * 100; gaps[0].Gap != expected {
+		t.Errorf("Expected gap %f, got %f", expected, gaps[0].Gap)
+	}
+	if !gaps[1].Satisfied || gaps[1].Gap != 0 {
+		t.Errorf("Unexpected gap: %+v", gaps[1])
+	}
+
+	if _, err := strategyGapsFromPrices("000001", prices, "rsi(14)"); err == nil {
+		t.Error("Strategy without comparison must fail")
+	}
+}
@@ -0,0 +1,325 @@
+package analyser
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/helloworldpark/tickle-stock-watcher/commons"
+	"github.com/helloworldpark/tickle-stock-watcher/structs"
+	"github.com/helloworldpark/tickle-stock-watcher/watcher"
+	"github.com/sdcoffey/big"
+	"github.com/sdcoffey/techan"
+)
+
+// timeframeMark marks the time frame of a function call in strategies, i.e. rsi(14)@15m
+const timeframeMark = "@"
+
+// timeframeSeparator joins a function name and its time frame so that the tokenizer accepts it, i.e. rsi__15m
+const timeframeSeparator = "__"
+
+// maxIntradayCandles for analysers: only hold last maxIntradayCandles bars of each time frame
+const maxIntradayCandles = 3000
+
+var timeframeSuffix = regexp.MustCompile(`^@([0-9]*[a-zA-Z]+)`)
+var functionName = regexp.MustCompile(`\b[a-zA-Z][a-zA-Z0-9_.]*`)
+
+// intradayTimeframes Key: time frame used in strategies, Value: minutes of a bar
+var intradayTimeframes = make(map[string]int64)
+
+// periodicTimeframes Key: time frame used in strategies, Value: period of candles aggregated from the daily candles
+var periodicTimeframes = map[string]func(t time.Time) (time.Time, time.Time){
+	"w":  weekOf,
+	"mo": monthOf,
+}
+
+// timeframeAliases Key: alias, Value: time frame
+var timeframeAliases = map[string]string{
+	"1w":    "w",
+	"week":  "w",
+	"1mo":   "mo",
+	"month": "mo",
+}
+
+func init() {
+	for _, minutes := range watcher.IntradayBarMinutes {
+		intradayTimeframes[fmt.Sprintf("%dm", minutes)] = minutes
+	}
+}
+
+func isTimeframe(timeframe string) bool {
+	if _, ok := intradayTimeframes[timeframe]; ok {
+		return true
+	}
+	_, ok := periodicTimeframes[timeframe]
+	return ok
+}
+
+// weekOf the week from Monday containing t
+func weekOf(t time.Time) (time.Time, time.Time) {
+	y, m, d := t.In(commons.AsiaSeoul).Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, commons.AsiaSeoul)
+	start := day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	return start, start.AddDate(0, 0, 7)
+}
+
+// monthOf the month containing t
+func monthOf(t time.Time) (time.Time, time.Time) {
+	y, m, _ := t.In(commons.AsiaSeoul).Date()
+	start := time.Date(y, m, 1, 0, 0, 0, 0, commons.AsiaSeoul)
+	return start, start.AddDate(0, 1, 0)
+}
+
+// expandTimeframes marks every function inside a call followed by a time frame with it
+// ex) sma(close(), 20)@15m > 100 -> sma__15m(close__15m(), 20) > 100
+func expandTimeframes(statement string) (string, error) {
+	for {
+		at := strings.Index(statement, timeframeMark)
+		if at < 0 {
+			return statement, nil
+		}
+		suffix := timeframeSuffix.FindStringSubmatch(statement[at:])
+		if suffix == nil {
+			return "", newError(fmt.Sprintf("Invalid time frame at %d: %s", at, statement))
+		}
+		timeframe := strings.ToLower(suffix[1])
+		if alias, ok := timeframeAliases[timeframe]; ok {
+			timeframe = alias
+		}
+		if !isTimeframe(timeframe) {
+			return "", newError(fmt.Sprintf("Unsupported time frame: %s", suffix[1]))
+		}
+		start, err := callStart(statement, at)
+		if err != nil {
+			return "", err
+		}
+		call := functionName.ReplaceAllStringFunc(statement[start:at], func(name string) string {
+			base, marked, instrument := splitSeriesName(name)
+			if len(marked) > 0 {
+				return name
+			}
+			return seriesName(base, timeframe, instrument)
+		})
+		statement = statement[:start] + call + statement[at+len(suffix[0]):]
+	}
+}
+
+// callStart finds where the function call ending right before end starts
+func callStart(statement string, end int) (int, error) {
+	if end == 0 || statement[end-1] != ')' {
+		return 0, newError(fmt.Sprintf("Time frame must follow a function call: %s", statement))
+	}
+	depth := 0
+	i := end - 1
+	for ; i >= 0; i-- {
+		if statement[i] == ')' {
+			depth++
+		} else if statement[i] == '(' {
+			depth--
+		}
+		if depth == 0 {
+			break
+		}
+	}
+	if i < 0 {
+		return 0, newError(fmt.Sprintf("Invalid pairing of clauses: %s", statement))
+	}
+	nameEnd := i
+	for i > 0 && isNameCharacter(statement[i-1]) {
+		i--
+	}
+	if i == nameEnd {
+		return 0, newError(fmt.Sprintf("Time frame must follow a function call: %s", statement))
+	}
+	return i, nil
+}
+
+func isNameCharacter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') || c == '_' || c == '.'
+}
+
+// splitTimeframe splits a function name marked by expandTimeframes
+// ex) rsi__15m -> rsi, 15m
+func splitTimeframe(name string) (string, string) {
+	i := strings.Index(name, timeframeSeparator)
+	if i < 0 {
+		return name, ""
+	}
+	return name[:i], name[i+len(timeframeSeparator):]
+}
+
+// seriesOf time series of the time frame, empty for the daily series
+func (a *Analyser) seriesOf(timeframe string) (*techan.TimeSeries, error) {
+	if len(timeframe) == 0 {
+		return a.timeSeries, nil
+	}
+	if _, ok := periodicTimeframes[timeframe]; ok {
+		series, ok := a.periodic[timeframe]
+		if !ok {
+			series = techan.NewTimeSeries()
+			a.periodic[timeframe] = series
+			for _, candle := range a.timeSeries.Candles {
+				a.syncPeriodicCandle(timeframe, series, candle)
+			}
+		}
+		return series, nil
+	}
+	if !isTimeframe(timeframe) {
+		return nil, newError(fmt.Sprintf("Unsupported time frame: %s", timeframe))
+	}
+	series, ok := a.intraday[timeframe]
+	if !ok {
+		series = techan.NewTimeSeries()
+		a.intraday[timeframe] = series
+	}
+	return series, nil
+}
+
+// syncPeriodic keeps the weekly and monthly candles in sync with the daily candle, either appended or updated
+func (a *Analyser) syncPeriodic(daily *techan.Candle) {
+	for timeframe, series := range a.periodic {
+		a.syncPeriodicCandle(timeframe, series, daily)
+	}
+}
+
+// syncPeriodicCandle aggregates the daily candles of the period containing the daily candle again.
+// Periods before the last candle of the series are left as they are.
+func (a *Analyser) syncPeriodicCandle(timeframe string, series *techan.TimeSeries, daily *techan.Candle) {
+	start, end := periodicTimeframes[timeframe](daily.Period.Start)
+	var candle *techan.Candle
+	if last := series.LastCandle(); last != nil {
+		if start.Before(last.Period.Start) {
+			return
+		}
+		if start.Equal(last.Period.Start) {
+			candle = last
+		}
+	}
+	if candle == nil {
+		candle = techan.NewCandle(techan.TimePeriod{Start: start, End: end})
+		if !series.AddCandle(candle) {
+			return
+		}
+	}
+
+	// 해당 기간의 일봉들을 다시 모은다
+	candles := a.timeSeries.Candles
+	from := len(candles)
+	for from > 0 && !candles[from-1].Period.Start.Before(start) {
+		from--
+	}
+	candle.Volume = big.ZERO
+	isFirst := true
+	for _, c := range candles[from:] {
+		if !c.Period.Start.Before(end) || c.ClosePrice.Zero() {
+			continue
+		}
+		if isFirst {
+			candle.OpenPrice = c.OpenPrice
+			candle.MaxPrice = c.MaxPrice
+			candle.MinPrice = c.MinPrice
+			isFirst = false
+		}
+		if c.MaxPrice.GT(candle.MaxPrice) {
+			candle.MaxPrice = c.MaxPrice
+		}
+		if c.MinPrice.LT(candle.MinPrice) {
+			candle.MinPrice = c.MinPrice
+		}
+		candle.ClosePrice = c.ClosePrice
+		candle.Volume = candle.Volume.Add(c.Volume)
+	}
+}
+
+// intradayPriceFrom timestamp from when to load intraday prices, false if not needed
+func (a *Analyser) intradayPriceFrom() (int64, bool) {
+	if len(a.intraday) == 0 {
+		return 0, false
+	}
+	if a.lastIntraday.Timestamp > 0 {
+		return a.lastIntraday.Timestamp + 1, true
+	}
+	return commons.Today().AddDate(0, 0, -watcher.IntradayRetentionDays).Unix(), true
+}
+
+// AppendIntradayPrice aggregates the polled price into the bars of every intraday time frame in use
+func (a *Analyser) AppendIntradayPrice(price structs.IntradayPrice) {
+	if len(a.intraday) == 0 || price.Timestamp <= a.lastIntraday.Timestamp || price.Price <= 0 {
+		return
+	}
+	// 거래량은 당일 누적이므로 직전 시세와의 차이가 이번 거래량
+	volume := price.Volume
+	last := a.lastIntraday
+	if last.Timestamp > 0 && commons.Unix(last.Timestamp).YearDay() == commons.Unix(price.Timestamp).YearDay() && price.Volume >= last.Volume {
+		volume = price.Volume - last.Volume
+	}
+	a.lastIntraday = price
+
+	value := a.price(price.Price)
+	for timeframe, series := range a.intraday {
+		minutes := intradayTimeframes[timeframe]
+		start := price.Timestamp - price.Timestamp%(minutes*60)
+		lastCandle := series.LastCandle()
+		if lastCandle != nil && lastCandle.Period.Start.Unix() == start {
+			if value.GT(lastCandle.MaxPrice) {
+				lastCandle.MaxPrice = value
+			}
+			if value.LT(lastCandle.MinPrice) {
+				lastCandle.MinPrice = value
+			}
+			lastCandle.ClosePrice = value
+			lastCandle.Volume = lastCandle.Volume.Add(big.NewDecimal(volume))
+			continue
+		}
+		candle := techan.NewCandle(techan.NewTimePeriod(commons.Unix(start), time.Duration(minutes)*time.Minute))
+		candle.OpenPrice = value
+		candle.ClosePrice = value
+		candle.MaxPrice = value
+		candle.MinPrice = value
+		candle.Volume = big.NewDecimal(volume)
+		if series.AddCandle(candle) && len(series.Candles) > maxIntradayCandles {
+			series.Candles = series.Candles[len(series.Candles)-maxIntradayCandles:]
+		}
+	}
+}
+
+// timeframeIndicator evaluates an indicator of another time series at the candles of the daily series.
+// The time series may be of another instrument.
+type timeframeIndicator struct {
+	indicator  techan.Indicator
+	timeframe  string
+	instrument string
+	base       *techan.TimeSeries
+	series     *techan.TimeSeries
+}
+
+func (t timeframeIndicator) Calculate(index int) big.Decimal {
+	k := t.indexAt(index)
+	if k < 0 {
+		return big.ZERO
+	}
+	return t.indicator.Calculate(k)
+}
+
+// indexAt index of the last candle of the series at the candle of the base series at index.
+// Intraday bars started before the daily candle ends, periodic candles started until the daily candle starts.
+// Daily candles of another instrument are matched by the day, since trading days may differ.
+func (t timeframeIndicator) indexAt(index int) int {
+	if index < 0 {
+		return -1
+	}
+	if index >= t.base.LastIndex() && len(t.instrument) == 0 {
+		return t.series.LastIndex()
+	}
+	daily := t.base.Candles[commons.MinInt(index, t.base.LastIndex())].Period
+	if _, ok := periodicTimeframes[t.timeframe]; ok || len(t.timeframe) == 0 {
+		return sort.Search(len(t.series.Candles), func(i int) bool {
+			return t.series.Candles[i].Period.Start.After(daily.Start)
+		}) - 1
+	}
+	return sort.Search(len(t.series.Candles), func(i int) bool {
+		return !t.series.Candles[i].Period.Start.Before(daily.End)
+	}) - 1
+}
@@ -0,0 +1,189 @@
+package analyser
+
+import (
+	"testing"
+	"time"
+
+	"github.com/helloworldpark/tickle-stock-watcher/commons"
+	"github.com/helloworldpark/tickle-stock-watcher/structs"
+	"github.com/sdcoffey/techan"
+)
+
+func TestExpandTimeframes(t *testing.T) {
+	cases := map[string]string{
+		"rsi(14) < 30":                        "rsi(14) < 30",
+		"rsi(14)@15m < 30":                    "rsi__15m(14) < 30",
+		"sma(close(), 20)@5m > close()":       "sma__5m(close__5m(), 20) > close()",
+		"sma(rsi(14)@1m, 5)@15m > 50":         "sma__15m(rsi__1m(14), 5) > 50",
+		"macd(12,26)@15M > 0 && rsi(14) < 40": "macd__15m(12,26) > 0 && rsi(14) < 40",
+	}
+	for statement, expected := range cases {
+		expanded, err := expandTimeframes(statement)
+		if err != nil {
+			t.Errorf("%s: %v", statement, err)
+			continue
+		}
+		if expanded != expected {
+			t.Errorf("%s: expected %s, got %s", statement, expected, expanded)
+		}
+	}
+
+	for _, statement := range []string{"rsi(14)@7m < 30", "(close())@1m > 0", "30@1m < rsi(14)", "rsi(14)@ < 30"} {
+		if _, err := expandTimeframes(statement); err == nil {
+			t.Errorf("%s: expected error", statement)
+		}
+	}
+}
+
+func TestAppendIntradayPrice(t *testing.T) {
+	ana := NewAnalyser("005930")
+	series5, _ := ana.seriesOf("5m")
+	series15, _ := ana.seriesOf("15m")
+
+	open := time.Date(2020, time.January, 31, 9, 0, 0, 0, commons.AsiaSeoul).Unix()
+	for i, price := range []int{100, 105, 98, 102, 110, 107} {
+		ana.AppendIntradayPrice(structs.IntradayPrice{
+			StockID:   "005930",
+			Timestamp: open + int64(i)*3*60,
+			Price:     price,
+			Volume:    float64(10 * (i + 1)),
+		})
+	}
+	// 다음 날은 거래량이 다시 누적된다
+	ana.AppendIntradayPrice(structs.IntradayPrice{StockID: "005930", Timestamp: open + 24*60*60, Price: 111, Volume: 5})
+
+	// 09:00, 09:03 | 09:06, 09:09 | 09:12 | 09:15 | 다음 날
+	if len(series5.Candles) != 5 {
+		t.Fatalf("Expected 5 bars of 5m, got %d", len(series5.Candles))
+	}
+	expected := structs.StockPrice{StockID: "005930", Timestamp: open + 5*60, Open: 98, High: 102, Low: 98, Close: 102, Volume: 20}
+	if bar := candleToStockPrice("005930", series5.Candles[1], false); bar != expected {
+		t.Errorf("Expected %+v, got %+v", expected, bar)
+	}
+	if len(series15.Candles) != 3 {
+		t.Fatalf("Expected 3 bars of 15m, got %d", len(series15.Candles))
+	}
+	expected = structs.StockPrice{StockID: "005930", Timestamp: open, Open: 100, High: 110, Low: 98, Close: 110, Volume: 50}
+	if bar := candleToStockPrice("005930", series15.Candles[0], false); bar != expected {
+		t.Errorf("Expected %+v, got %+v", expected, bar)
+	}
+	if volume := series15.LastCandle().Volume.Float(); volume != 5 {
+		t.Errorf("Expected volume 5 of the next day, got %v", volume)
+	}
+}
+
+func TestIntradayStrategy(t *testing.T) {
+	ana := newAnalyserWithPrices("005930", newSinePrices("005930", 30, 0))
+	ana.prepareWatching(commons.Now())
+
+	fcns, err := parseStrategy("close()@5m > sma(close(), 3)@5m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule, err := ana.createRule(fcns)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := commons.Today().Add(9 * time.Hour).Unix()
+	for i, price := range []int{100, 90, 80, 120} {
+		ana.watchPrice(structs.StockPrice{StockID: "005930", Timestamp: now + int64(i)*5*60, Close: price, Volume: float64(i + 1)})
+		satisfied := rule.IsSatisfied(ana.timeSeries.LastIndex(), nil)
+		if satisfied != (price == 120) {
+			t.Errorf("Unexpected result at %d: %v", price, satisfied)
+		}
+	}
+}
+
+func newWeekdayPrices(stockID string, from time.Time, days int) []structs.StockPrice {
+	var prices []structs.StockPrice
+	for day := from; len(prices) < days; day = day.AddDate(0, 0, 1) {
+		if day.Weekday() == time.Saturday || day.Weekday() == time.Sunday {
+			continue
+		}
+		c := 1000 + 10*len(prices)
+		prices = append(prices, structs.StockPrice{
+			StockID:   stockID,
+			Timestamp: day.Unix(),
+			Open:      c - 5,
+			Close:     c,
+			High:      c + 20,
+			Low:       c - 20,
+			Volume:    100,
+		})
+	}
+	return prices
+}
+
+func TestPeriodicTimeframes(t *testing.T) {
+	// 2020-01-06 월요일부터 3주
+	monday := time.Date(2020, time.January, 6, 0, 0, 0, 0, commons.AsiaSeoul)
+	prices := newWeekdayPrices("005930", monday, 15)
+
+	incremental := NewAnalyser("005930")
+	weekly, _ := incremental.seriesOf("w")
+	monthly, _ := incremental.seriesOf("mo")
+	for i := range prices {
+		incremental.AppendPastPrice(prices[i])
+	}
+	rebuilt, _ := newAnalyserWithPrices("005930", prices).seriesOf("w")
+
+	if len(weekly.Candles) != 3 || len(rebuilt.Candles) != 3 || len(monthly.Candles) != 1 {
+		t.Fatalf("Expected 3 weeks and 1 month, got %d(rebuilt %d) weeks and %d months", len(weekly.Candles), len(rebuilt.Candles), len(monthly.Candles))
+	}
+	expected := structs.StockPrice{StockID: "005930", Timestamp: monday.AddDate(0, 0, 7).Unix(), Open: 1045, Close: 1090, High: 1110, Low: 1030, Volume: 500}
+	for _, series := range []*techan.TimeSeries{weekly, rebuilt} {
+		if week := candleToStockPrice("005930", series.Candles[1], false); week != expected {
+			t.Errorf("Expected %+v, got %+v", expected, week)
+		}
+	}
+
+	// 마지막 일봉이 바뀌면 주봉, 월봉도 따라 바뀐다
+	last := prices[len(prices)-1]
+	last.Close = 2000
+	last.High = 2000
+	incremental.AppendPastPrice(last)
+	if c := weekly.LastCandle().ClosePrice.Float(); c != 2000 {
+		t.Errorf("Expected weekly close 2000, got %v", c)
+	}
+	if h := monthly.LastCandle().MaxPrice.Float(); h != 2000 {
+		t.Errorf("Expected monthly high 2000, got %v", h)
+	}
+
+	// 장중 가격도 반영된다
+	incremental.prepareWatching(commons.Now())
+	incremental.watchPrice(structs.StockPrice{StockID: "005930", Timestamp: commons.Now().Unix(), Close: 3000})
+	if c := weekly.LastCandle().ClosePrice.Float(); c != 3000 {
+		t.Errorf("Expected weekly close 3000 while watching, got %v", c)
+	}
+}
+
+func TestPeriodicStrategy(t *testing.T) {
+	ana := newAnalyserWithPrices("005930", newSinePrices("005930", 400, 0))
+	for _, strategy := range []string{"macd(12,26)@w > 0 && rsi(14) < 40", "close()@mo > sma(close(), 3)@month"} {
+		fcns, err := parseStrategy(strategy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ana.createRule(fcns); err != nil {
+			t.Errorf("%s: %v", strategy, err)
+		}
+	}
+	if len(ana.periodic) != 2 {
+		t.Errorf("Expected weekly and monthly series, got %d", len(ana.periodic))
+	}
+
+	// 주봉 종가는 그 주 마지막 일봉의 종가
+	fcns, _ := parseStrategy("close()@w")
+	indicator, err := ana.createIndicator(fcns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, index := range []int{100, 200, ana.timeSeries.LastIndex()} {
+		daily := ana.timeSeries.Candles[index]
+		weekly := ana.periodic["w"].Candles[indicator.(timeframeIndicator).indexAt(index)]
+		if daily.Period.Start.Before(weekly.Period.Start) || !daily.Period.Start.Before(weekly.Period.End) {
+			t.Errorf("Day %v is not in the week %v", daily.Period, weekly.Period)
+		}
+	}
+}
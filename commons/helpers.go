@@ -15,22 +15,50 @@ func init() {
 	AsiaSeoul = time.FixedZone("Asia/Seoul", 9*60*60)
 }
 
+// ParseInt parses string into int
+// s: string, comma allowed
+func ParseInt(s string) (int, error) {
+	val, err := strconv.ParseInt(strings.ReplaceAll(strings.TrimSpace(s), ",", ""), 10, 32)
+	return int(val), err
+}
+
+// ParseInt64 parses string into int64
+// s: string, comma allowed
+func ParseInt64(s string) (int64, error) {
+	return strconv.ParseInt(strings.ReplaceAll(strings.TrimSpace(s), ",", ""), 10, 64)
+}
+
+// ParseDouble parses string into float64
+// s: string, comma allowed
+func ParseDouble(s string) (float64, error) {
+	return strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(s), ",", ""), 64)
+}
+
+// ParseTimestamp returns timestamp from string value given layout.
+func ParseTimestamp(layout, value string) (int64, error) {
+	t, err := time.ParseInLocation(layout, strings.TrimSpace(value), AsiaSeoul)
+	if err != nil {
+		return 0, err
+	}
+	return t.Unix(), nil
+}
+
 // GetInt parses string into int
 // s: string, comma allowed
 // if parsing fails: panics
 func GetInt(s string) int {
-	val, err := strconv.ParseInt(strings.ReplaceAll(s, ",", ""), 10, 32)
+	val, err := ParseInt(s)
 	if err != nil {
 		logger.Panic("[Helper] %s", err.Error())
 	}
-	return int(val)
+	return val
 }
 
 // GetInt64 parses string into int64
 // s: string, comma allowed
 // if parsing fails: panics
 func GetInt64(s string) int64 {
-	val, err := strconv.ParseInt(strings.ReplaceAll(s, ",", ""), 10, 64)
+	val, err := ParseInt64(s)
 	if err != nil {
 		logger.Panic("[Helper] %s", err.Error())
 	}
@@ -41,7 +69,7 @@ func GetInt64(s string) int64 {
 // s: string, comma allowed
 // if parsing fails: panics
 func GetDouble(s string) float64 {
-	val, err := strconv.ParseFloat(strings.ReplaceAll(s, ",", ""), 64)
+	val, err := ParseDouble(s)
 	if err != nil {
 		logger.Panic("[Helper] %s", err.Error())
 	}
@@ -49,12 +77,13 @@ func GetDouble(s string) float64 {
 }
 
 // GetTimestamp returns timestamp from string value given layout.
+// if parsing fails: panics
 func GetTimestamp(layout, value string) int64 {
-	t, err := time.ParseInLocation(layout, value, AsiaSeoul)
+	val, err := ParseTimestamp(layout, value)
 	if err != nil {
 		logger.Panic("[Helper] %s", err.Error())
 	}
-	return t.Unix()
+	return val
 }
 
 // Now returns time.Now() of Asia/Seoul
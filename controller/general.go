@@ -3,7 +3,6 @@ package controller
 import (
 	"bytes"
 	"fmt"
-	"math/rand"
 	"sort"
 	"strings"
 	"time"
@@ -14,6 +13,7 @@ import (
 	"github.com/helloworldpark/tickle-stock-watcher/logger"
 	"github.com/helloworldpark/tickle-stock-watcher/orders"
 	"github.com/helloworldpark/tickle-stock-watcher/push"
+	"github.com/helloworldpark/tickle-stock-watcher/report"
 	"github.com/helloworldpark/tickle-stock-watcher/scheduler"
 	"github.com/helloworldpark/tickle-stock-watcher/structs"
 	"github.com/helloworldpark/tickle-stock-watcher/watcher"
@@ -34,9 +34,16 @@ var botOrders = map[string]orders.Order{
 	"terminate":      orders.NewTerminationOrder(),
 	"prospect":       orders.NewProspectsOrder(),
 	"appendprospect": orders.NewAppendProspectOrder(),
+	"screen":         orders.NewScreenOrder(),
+	"chart":          orders.NewChartOrder(),
+	"backfill":       orders.NewBackfillOrder(),
+	"history":        orders.NewHistoryOrder(),
+	"corporate":      orders.NewCorporateActionOrder(),
 }
 var newError = commons.NewTaggedError("Controller")
 
+const maxScreenResultsToShow = 30
+
 // General is the main controller of this whole project
 // General은 다음와 같은 일들을 수행
 // 1. 파싱된 유저의 메세지를 처리
@@ -50,21 +57,44 @@ type General struct {
 	broker       *analyser.Broker
 	pushManager  *push.Manager
 	dbClient     *database.DBClient
+	replay       *watcher.ReplaySource // Not nil while replaying
 }
 
 // NewGeneral returns a new pointer to General, uninitialized
-func NewGeneral(dbClient *database.DBClient) *General {
+// While replaying, stocks are read from DB and only weekends are holidays, so that nothing is downloaded.
+func NewGeneral(dbClient *database.DBClient, source watcher.PriceSource) *General {
 	g := General{
-		priceWatcher: watcher.New(dbClient, 30*time.Second),
-		dateChecker:  watcher.NewDateChecker(),
-		itemChecker:  watcher.NewStockItemChecker(dbClient),
+		priceWatcher: watcher.New(dbClient, source, 30*time.Second),
 		broker:       analyser.NewBroker(dbClient),
 		pushManager:  push.NewManager(),
 		dbClient:     dbClient,
 	}
+	if replay, ok := source.(*watcher.ReplaySource); ok {
+		g.replay = replay
+		g.dateChecker = watcher.NewOfflineDateChecker()
+		g.itemChecker = watcher.NewOfflineStockItemChecker(dbClient)
+		g.broker.SetClock(replay.Now)
+	} else {
+		g.dateChecker = watcher.NewDateChecker()
+		g.itemChecker = watcher.NewStockItemChecker(dbClient)
+	}
 	return &g
 }
 
+// now the time of the market, i.e. the replay clock while replaying
+func (g *General) now() time.Time {
+	if g.replay != nil {
+		return g.replay.Now()
+	}
+	return commons.Now()
+}
+
+// isSessionHours checks if the market is open at the time of the day, from 09:00 until 15:30
+func isSessionHours(now time.Time) bool {
+	hour := float64(now.Hour()) + float64(now.Minute())/60
+	return 9 <= hour && hour < 15.5
+}
+
 // OnWebhook interface push.WebhookHandler
 func (g *General) OnWebhook(token int64, msg string) {
 	logger.Info("[Controller] User: %d Message: %s", token, msg)
@@ -127,9 +157,55 @@ func (g *General) Initialize() {
 	for _, u := range structs.AllUsers(g.dbClient) {
 		userIndex[u.UserID] = u
 	}
+	// 지수는 전략에서 참조할 수 있도록 항상 가격을 수집한다
+	for _, index := range structs.Indices {
+		g.priceWatcher.Register(index)
+	}
+	// 전략이 참조하는 종목도 참조되는 동안 가격을 수집한다
+	g.broker.SetReferenceHandler(func(stockID string, retained bool) {
+		stock, ok := g.itemChecker.StockFromID(stockID)
+		if !ok {
+			// 목록에서 사라진 종목도 놓아줄 수는 있어야 한다
+			if !retained {
+				g.priceWatcher.Withdraw(structs.Stock{StockID: stockID})
+				return
+			}
+			logger.Warn("[Controller] Referred to unknown stock %s", stockID)
+			return
+		}
+		if retained {
+			g.priceWatcher.Register(stock)
+		} else {
+			g.priceWatcher.Withdraw(stock)
+		}
+	})
+	// 꺼져 있는 동안 목록에서 사라지거나 돌아온 종목의 전략은 모아서 처리한다
+	var changes []watcher.ListingChange
+	unlisted := make(map[string]bool)
+	relisted := make(map[string]bool)
 	for _, v := range structs.AllStrategies(g.dbClient) {
 		stock, ok := g.itemChecker.StockFromID(v.StockID)
 		if !ok {
+			// 목록을 다 받아오지 못했다면 사라졌는지 알 수 없다
+			if g.itemChecker.IsComplete() && !unlisted[v.StockID] {
+				unlisted[v.StockID] = true
+				changes = append(changes, g.itemChecker.ChangeOfUnlisted(v.StockID))
+			}
+			continue
+		}
+		if v.Suspended {
+			if !relisted[v.StockID] {
+				relisted[v.StockID] = true
+				changes = append(changes, watcher.ListingChange{Kind: watcher.Listed, New: stock})
+			}
+			continue
+		}
+		// ref(), rs()로 참조하는 종목이 사라진 전략도 함께 처리한다
+		if ref, ok := g.unlistedReference(v); ok && g.itemChecker.IsComplete() {
+			if !unlisted[ref] {
+				unlisted[ref] = true
+				changes = append(changes, g.itemChecker.ChangeOfUnlisted(ref))
+			}
 			continue
 		}
 		shouldRetainWatcher, err := g.broker.AddStrategy(v, g.onStrategyEvent, false)
@@ -142,6 +218,8 @@ func (g *General) Initialize() {
 			logger.Error(err.Error())
 		}
 	}
+	g.onListingChanges(changes)
+	g.itemChecker.SetListingHandler(g.onListingChanges)
 
 	// 명령어들 초기화
 	botOrders["help"].SetAction(func(user structs.User, s []string) error {
@@ -195,6 +273,9 @@ func (g *General) Initialize() {
 				if strategies[i].Repeat {
 					buffer.WriteString("(반복)")
 				}
+				if strategies[i].Suspended {
+					buffer.WriteString("(정지)")
+				}
 				buffer.WriteString(": ")
 				buffer.WriteString(strategies[i].Strategy)
 			} else {
@@ -202,6 +283,10 @@ func (g *General) Initialize() {
 				buffer.WriteString("(")
 				buffer.WriteString(strategies[i].StockID)
 				buffer.WriteString(")")
+				if strategies[i].Suspended {
+					buffer.WriteString("(정지): ")
+					buffer.WriteString(strategies[i].Strategy)
+				}
 			}
 			buffer.WriteString("\n")
 		}
@@ -216,6 +301,34 @@ func (g *General) Initialize() {
 		buffer.WriteString("거래소: ")
 		buffer.WriteString(string(stock.MarketType))
 		buffer.WriteString("\n")
+		if len(stock.Instrument) > 0 {
+			buffer.WriteString("종류: ")
+			buffer.WriteString(string(stock.Instrument))
+			buffer.WriteString("\n")
+		}
+		if len(stock.Sector) > 0 {
+			buffer.WriteString("섹터: ")
+			buffer.WriteString(stock.Sector)
+			buffer.WriteString("\n")
+		}
+		if len(stock.Industry) > 0 {
+			buffer.WriteString("업종: ")
+			buffer.WriteString(stock.Industry)
+			buffer.WriteString("\n")
+		}
+		if len(stock.Products) > 0 {
+			buffer.WriteString("주요제품: ")
+			buffer.WriteString(stock.Products)
+			buffer.WriteString("\n")
+		}
+		if stock.ListingDate > 0 {
+			buffer.WriteString("상장일: ")
+			buffer.WriteString(commons.Unix(stock.ListingDate).Format("2006-01-02"))
+			buffer.WriteString("\n")
+		}
+		if stock.Shares > 0 {
+			buffer.WriteString(fmt.Sprintf("상장주식수: %d주\n", stock.Shares))
+		}
 		buffer.WriteString("종목번호: ")
 		buffer.WriteString(stock.StockID)
 
@@ -251,6 +364,52 @@ func (g *General) Initialize() {
 	}))
 	botOrders["holidays"] = botOrders["holiday"]
 
+	// 빠진 가격 정보 채우기
+	botOrders["backfill"].SetAction(orders.Backfill(g, g, g.dateChecker, func(user structs.User, results []watcher.BackfillResult) {
+		var buffer bytes.Buffer
+		buffer.WriteString(fmt.Sprintf("[Backfill] %d종목\n", len(results)))
+		for _, result := range results {
+			if result.Err == nil && result.Filled == 0 && len(result.Unfilled) == 0 {
+				continue
+			}
+			name := result.StockID
+			if stock, ok := g.AccessStockItem(result.StockID); ok {
+				name = fmt.Sprintf("%s(%s)", stock.Name, stock.StockID)
+			}
+			buffer.WriteString(fmt.Sprintf("%s: %d일 채움", name, result.Filled))
+			if result.Err != nil {
+				buffer.WriteString(fmt.Sprintf(", 에러 %s", result.Err.Error()))
+			}
+			buffer.WriteString("\n")
+			for _, gap := range result.Unfilled {
+				buffer.WriteString(fmt.Sprintf("    빈 구간 %v\n", gap))
+			}
+		}
+		g.pushManager.PushMessage(buffer.String(), user.UserID)
+		g.pushQuarantineSummary()
+	}))
+	botOrders["채우기"] = botOrders["backfill"]
+
+	// 가격 정보 보관 기간 설정 및 전체 가져오기
+	botOrders["history"].SetAction(orders.History(g, g, g, func(user structs.User, progress watcher.HistoryProgress, done, total int) {
+		msg := fmt.Sprintf("[History] (%d/%d) %v", done+1, total, progress)
+		if progress.Done {
+			msg += " 완료"
+		}
+		g.pushManager.PushMessage(msg, user.UserID)
+		if progress.Done && done+1 == total {
+			g.pushQuarantineSummary()
+		}
+	}))
+	botOrders["이력"] = botOrders["history"]
+
+	// 분할, 배당 등 가격 조정
+	botOrders["corporate"].SetAction(orders.CorporateAction(g, g, func(user structs.User, stock structs.Stock, action structs.CorporateAction) {
+		msg := fmt.Sprintf("[Corporate] %s(%s) %s %v: %v", stock.Name, stock.StockID, commons.Unix(action.Timestamp).Format("2006-01-02"), action.Kind, action.Value)
+		g.pushManager.PushMessage(msg, user.UserID)
+	}))
+	botOrders["조정"] = botOrders["corporate"]
+
 	// Terminate
 	botOrders["terminate"].SetAction(func(user structs.User, args []string) error {
 		if !user.Superuser {
@@ -268,7 +427,11 @@ func (g *General) Initialize() {
 		if !user.Superuser {
 			return newError("Only superuser can order this")
 		}
-		analyser.FindProspects(g.dbClient, g.itemChecker, func(msg, savePath string) {
+		sector, err := orders.SectorFromArgs(args)
+		if err != nil {
+			return err
+		}
+		analyser.FindProspects(g.dbClient, g.itemChecker, sector, func(msg, savePath string) {
 			if len(savePath) > 0 {
 				g.pushManager.PushPhoto(msg, savePath, user.UserID)
 			} else {
@@ -284,9 +447,26 @@ func (g *General) Initialize() {
 
 	// appendProspect
 	botOrders["appendprospect"].SetAction(func(user structs.User, args []string) error {
-		prospects, now := analyser.ActiveProspects(g.dbClient, g.itemChecker)
-		if len(prospects) == 0 {
-			return newError(fmt.Sprintf("No prospects today(%v)", now))
+		var prospects []analyser.Prospect
+		if len(args) > 0 {
+			// 특정 날짜의 기록을 가져온다: appendprospect 2020-01-31
+			if _, err := time.Parse("2006-01-02", args[0]); err != nil {
+				return newError(fmt.Sprintf("Invalid date(yyyy-mm-dd): %s", args[0]))
+			}
+			var err error
+			prospects, err = analyser.ProspectsOfDate(g.dbClient, args[0])
+			if err != nil {
+				return err
+			}
+			if len(prospects) == 0 {
+				return newError(fmt.Sprintf("No prospects on %s", args[0]))
+			}
+		} else {
+			var now time.Time
+			prospects, now = analyser.ActiveProspects(g.dbClient, g.itemChecker)
+			if len(prospects) == 0 {
+				return newError(fmt.Sprintf("No prospects today(%v)", now))
+			}
 		}
 		f := orders.Trade(commons.BUY, g, g, g, g.onStrategyEvent, tradeOnSuccess)
 		stockIDs := make(map[string]bool)
@@ -294,9 +474,9 @@ func (g *General) Initialize() {
 			stockIDs[stock.StockID] = true
 		}
 		n := 0
-		for stockID := range prospects {
-			if _, ok := stockIDs[stockID]; !ok {
-				f(user, []string{stockID, "macd(12,26)>0&&zero(macdhist(12,26,9),1,7)==1&&mflow(14)<80"})
+		for _, prospect := range prospects {
+			if _, ok := stockIDs[prospect.StockID]; !ok {
+				f(user, []string{prospect.StockID, "macd(12,26)>0&&zero(macdhist(12,26,9),1,7)==1&&mflow(14)<80"})
 				n++
 			}
 		}
@@ -309,58 +489,126 @@ func (g *General) Initialize() {
 	botOrders["saveprospect"] = botOrders["appendprospect"]
 	botOrders["saveprospects"] = botOrders["appendprospect"]
 
+	// Screen
+	botOrders["screen"].SetAction(orders.Screen(g, g.itemChecker, func(user structs.User, request analyser.ScreenRequest, results []analyser.ScreenResult) {
+		buffer := bytes.Buffer{}
+		market := "전체"
+		if len(request.Market) > 0 {
+			market = string(request.Market)
+		}
+		if len(request.Instrument) > 0 {
+			market += " " + string(request.Instrument)
+		}
+		if len(request.Sector) > 0 {
+			market += " " + request.Sector
+		}
+		buffer.WriteString(fmt.Sprintf("[Screen] %s(%s): %d 종목 부합\n", request.Strategy, market, len(results)))
+		for i := range results {
+			if i >= maxScreenResultsToShow {
+				buffer.WriteString(fmt.Sprintf("...and %d others\n", len(results)-maxScreenResultsToShow))
+				break
+			}
+			buffer.WriteString(fmt.Sprintf("%2d. %s(%s) %d원", i+1, results[i].Name, results[i].StockID, results[i].Close))
+			if len(request.SortBy) > 0 {
+				buffer.WriteString(fmt.Sprintf(" %s=%.2f", request.SortBy, results[i].Value))
+			}
+			buffer.WriteString("\n")
+		}
+		g.pushManager.PushMessage(buffer.String(), user.UserID)
+	}))
+	botOrders["screener"] = botOrders["screen"]
+
+	// Chart
+	botOrders["chart"].SetAction(orders.Chart(g, g, g.itemChecker, func(user structs.User, stocks []structs.Stock, days int, chartURL string) {
+		names := make([]string, len(stocks))
+		for i := range stocks {
+			names[i] = fmt.Sprintf("%s(%s)", stocks[i].Name, stocks[i].StockID)
+		}
+		msg := fmt.Sprintf("[Chart] %s %d일", strings.Join(names, " vs "), days)
+		g.pushManager.PushPhoto(msg, chartURL, user.UserID)
+	}))
+	botOrders["차트"] = botOrders["chart"]
+
 	// ItemChecker는 매일 05시, 현재 거래 가능한 주식들을 업데이트
 	// AnalyserBroker는 주중, 장이 열리는 날이면 08시에 과거 가격 정보를 업데이트받는다
 	// PriceWatcher는 주중, 장이 열리는 날이면 09시부터 감시 시작
 	// PriceWatcher는 주중, 15시 30분이 되면 감시 중단
-	// PriceWatcher는 주중, 장이 열리는 날이면 18시 30분부터 오늘로부터 이전의 가격 정보 수집
-	scheduler.ScheduleEveryday("StockItemUpdate", 5, func() {
-		g.itemChecker.UpdateStocks()
-	})
+	// PriceWatcher는 주중, 장이 열리는 날이면 18시 30분부터 오늘로부터 이전의 가격 정보 수집, 오래된 장중 시세는 삭제
+	if g.replay == nil {
+		scheduler.ScheduleEveryday("StockItemUpdate", 5, func() {
+			g.itemChecker.UpdateStocks()
+		})
+	}
 	scheduler.ScheduleWeekdays("UpdatePriceBroker", 8, func() {
 		g.broker.UpdatePastPrice()
 	})
 	watchPrice := func() {
 		// 오늘 장날인지 확인
-		isMarketClosed := g.dateChecker.IsHoliday(commons.Now())
-		if isMarketClosed {
-			logger.Warn("[Controller] Holiday: %s", commons.Now().String())
+		now := g.now()
+		if g.dateChecker.IsHoliday(now) {
+			logger.Warn("[Controller] Holiday: %s", now.String())
 			return
 		}
 
 		// 중복될 수 있어서 주식들의 집합을 구한 후에 감시하도록 처리
 		stocks := make(map[string]bool)
 		for _, v := range structs.AllStrategies(g.dbClient) {
-			stocks[v.StockID] = true
+			if !v.Suspended {
+				stocks[v.StockID] = true
+			}
+		}
+		// 전략이 참조하는 지수도 실시간으로 받아야 한다
+		for _, stockID := range g.broker.ReferencedStocks() {
+			stocks[stockID] = true
 		}
 		logger.Info("[Controller] Stock Set = %+v", stocks)
-		randomGen := rand.New(rand.NewSource(time.Now().UnixNano()))
+		// 장중에 시작했으면 분봉을 쓰는 종목은 놓친 분봉부터 채운다
+		isLate := isSessionHours(now) && (now.Hour() > 9 || now.Minute() > 0)
+		// 시세는 Watcher가 여러 종목을 묶어서 받아오므로 한꺼번에 시작해도 된다
 		for k := range stocks {
 			if g.broker.CanFeedPrice(k) {
+				if isLate && !structs.IsIndex(k) && g.broker.NeedsIntradayPrice(k) {
+					g.fillIntradayPrices(k, now)
+				}
 				provider := g.priceWatcher.StartWatchingStock(k)
 				g.broker.FeedPrice(k, provider)
-				sleepTime := randomGen.Float64()
-				duration := time.Duration(sleepTime * float64(time.Second))
-				time.Sleep(duration)
 			}
 		}
 	}
-	now := commons.Now()
-	nowHour := float64(now.Hour()) + float64(now.Minute())/60
-	if 9 < nowHour && nowHour < 15.5 {
-		commons.InvokeGoroutine("controller_General_Initialize_WatchPrice_daily", watchPrice)
-	}
-	scheduler.ScheduleWeekdays("WatchPrice", 9, watchPrice)
-	scheduler.ScheduleWeekdays("StopWatchPrice", 15.5, func() {
+	stopWatchPrice := func() {
 		g.broker.StopFeedingPrice()
 		g.priceWatcher.StopWatching()
-	})
+	}
+	if g.replay != nil {
+		// 재생 중에는 벽시계 대신 재생 시각으로 장을 열고 닫는다
+		isWatching := false
+		followReplay := func() {
+			if isSessionHours(g.now()) == isWatching {
+				return
+			}
+			isWatching = !isWatching
+			if isWatching {
+				watchPrice()
+			} else {
+				stopWatchPrice()
+			}
+		}
+		scheduler.SchedulePeriodic("ReplaySession", g.priceWatcher.PollInterval(), 0, followReplay)
+	} else {
+		if isSessionHours(commons.Now()) {
+			commons.InvokeGoroutine("controller_General_Initialize_WatchPrice_daily", watchPrice)
+		}
+		scheduler.ScheduleWeekdays("WatchPrice", 9, watchPrice)
+		scheduler.ScheduleWeekdays("StopWatchPrice", 15.5, stopWatchPrice)
+	}
 	scheduler.ScheduleWeekdays("CollectPrice", 18.5, func() {
 		g.priceWatcher.Collect()
+		g.priceWatcher.PruneIntradayPrices()
+		g.pushQuarantineSummary()
 	})
 	findProspect := func() {
 		users := structs.AllUsers(g.dbClient)
-		analyser.FindProspects(g.dbClient, g.itemChecker, func(msg, savePath string) {
+		analyser.FindProspects(g.dbClient, g.itemChecker, "", func(msg, savePath string) {
 			for _, u := range users {
 				if len(savePath) > 0 {
 					g.pushManager.PushPhoto(msg, savePath, u.UserID)
@@ -372,8 +620,11 @@ func (g *General) Initialize() {
 	}
 	scheduler.ScheduleEveryday("FindProspects", 20, findProspect)
 
+	// 주간 리포트는 매주 토요일 10시
+	scheduler.ScheduleWeekly("WeeklyReport", time.Saturday, 10, g.sendWeeklyReports)
+
 	// DateChecker는 매해 12월 29일 07시, 다음 해의 공휴일 정보를 갱신
-	now = commons.Now()
+	now := commons.Now()
 	dec29 := time.Date(now.Year(), time.December, 29, 7, 0, 0, 0, commons.AsiaSeoul)
 	ttl := dec29.Sub(now)
 	scheduler.SchedulePeriodic("HolidayCheck", time.Hour*24*365, ttl, func() {
@@ -391,27 +642,78 @@ func (g *General) Initialize() {
 	}
 }
 
+// fillIntradayPrices stores the minute bars of the stock missed today and loads them into its analyser
+func (g *General) fillIntradayPrices(stockID string, now time.Time) {
+	filled, err := g.priceWatcher.FillIntradayPrices(stockID, now)
+	if err != nil {
+		logger.Error("[Controller] Error while filling minute bars of %s: %+v", stockID, err)
+		return
+	}
+	if filled > 0 {
+		g.broker.UpdatePastPriceOfStock(stockID)
+	}
+}
+
+// pushQuarantineSummary sends the summary of the prices rejected by validation to the superusers
+func (g *General) pushQuarantineSummary() {
+	summary := g.priceWatcher.TakeQuarantineSummary()
+	if len(summary) == 0 {
+		return
+	}
+	var superusers []structs.User
+	if _, err := g.dbClient.Select(&superusers, "where Superuser=?", true); err != nil {
+		logger.Error("[Controller] Error while querying superusers: %+v", err)
+		return
+	}
+	for _, user := range superusers {
+		g.pushManager.PushMessage(summary, user.UserID)
+	}
+}
+
 // onStrategyEvent callback to be called when the users' strategies are fulfilled
 func (g *General) onStrategyEvent(price structs.StockPrice, orderSide int, userid int64, repeat bool) {
 	// Notify to user
-	msgFormat := "[%s] %4d년 %d월 %d일 %02d시 %02d분 %02d초\n%s의 가격, 전략에 부합: 현재가 %d원"
+	msgFormat := "[%s] %4d년 %d월 %d일 %02d시 %02d분 %02d초\n%s의 가격, 전략에 부합: 현재가 %s"
 	side := []string{"사다", "팔다"}[orderSide]
 	stock, _ := g.itemChecker.StockFromID(price.StockID)
 	currentTime := commons.Unix(price.Timestamp)
 	y, m, d := currentTime.Date()
 	h, i, s := currentTime.Clock()
+	currentPrice := fmt.Sprintf("%d원", price.Close)
+	if structs.IsIndex(price.StockID) {
+		currentPrice = fmt.Sprintf("%.2f", float64(price.Close)/structs.IndexPriceScale)
+	}
 	msg := fmt.Sprintf(msgFormat,
 		side,
 		y, m, d, h, i, s,
-		stock.Name, int(price.Close))
+		stock.Name, currentPrice)
 	g.pushManager.PushMessage(msg, userid)
 
+	// Record trigger
+	user := structs.User{UserID: userid}
+	for _, strategy := range g.broker.GetStrategy(user) {
+		if strategy.StockID != price.StockID || strategy.OrderSide != orderSide {
+			continue
+		}
+		trigger := structs.StrategyTrigger{
+			UserID:    userid,
+			StockID:   price.StockID,
+			Strategy:  strategy.Strategy,
+			OrderSide: orderSide,
+			Price:     price.Close,
+			Timestamp: price.Timestamp,
+		}
+		if _, err := g.dbClient.Upsert(&trigger); err != nil {
+			logger.Error("[Controller] Error while recording trigger: %s", err.Error())
+		}
+	}
+
 	// Handle Repeat
 	if repeat {
 		return
 	}
 	// Delete Strategy
-	err := g.broker.DeleteStrategy(structs.User{UserID: userid}, price.StockID, orderSide)
+	err := g.broker.DeleteStrategy(user, price.StockID, orderSide)
 	if err == nil {
 		logger.Info("[Controller] Deleted strategy: %d, %s, %d", userid, stock, orderSide)
 	} else {
@@ -421,6 +723,21 @@ func (g *General) onStrategyEvent(price structs.StockPrice, orderSide int, useri
 	g.priceWatcher.Withdraw(stock)
 }
 
+// sendWeeklyReports sends the weekly reports to every user
+func (g *General) sendWeeklyReports() {
+	report.CleanupOldReports()
+	market := report.NewMarket(g.dbClient, g.itemChecker, commons.Now())
+	for _, user := range structs.AllUsers(g.dbClient) {
+		weekly := report.NewWeekly(g.dbClient, g.itemChecker, user, market)
+		savePath, err := weekly.Save()
+		if err != nil {
+			logger.Error("[Controller] Error while saving weekly report of %d: %s", user.UserID, err.Error())
+			continue
+		}
+		g.pushManager.PushDocument("[Report] 주간 리포트", savePath, user.UserID)
+	}
+}
+
 // AccessDB interface database.DBAccess
 func (g *General) AccessDB() *database.DBClient {
 	return g.dbClient
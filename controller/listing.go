@@ -0,0 +1,235 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/helloworldpark/tickle-stock-watcher/analyser"
+	"github.com/helloworldpark/tickle-stock-watcher/logger"
+	"github.com/helloworldpark/tickle-stock-watcher/structs"
+	"github.com/helloworldpark/tickle-stock-watcher/watcher"
+)
+
+// onListingChanges handles the strategies of the stocks changed in the listing, and those referring to them by ref() or rs()
+// 상장폐지, 거래정지: 전략을 정지하고 감시하던 기록은 지운다
+// 다시 상장: 정지된 전략을 재개한다
+// 종목코드 변경: 전략을 새 종목코드로 옮긴다
+func (g *General) onListingChanges(changes []watcher.ListingChange) {
+	strategies := structs.AllStrategies(g.dbClient)
+	for _, change := range changes {
+		switch change.Kind {
+		case watcher.Delisted:
+			g.suspendStrategies(change.Old, strategiesOfStock(strategies, change.Old.StockID))
+			g.suspendReferringStrategies(change.Old, strategiesReferring(strategies, change.Old.StockID))
+			g.forget(change.Old.StockID)
+		case watcher.Listed:
+			g.resumeStrategies(change.New, strategiesOfStock(strategies, change.New.StockID))
+			g.resumeStrategies(change.New, strategiesReferring(strategies, change.New.StockID))
+		case watcher.CodeChanged:
+			g.migrateStrategies(change, strategiesOfStock(strategies, change.Old.StockID), strategiesOfStock(strategies, change.New.StockID))
+			g.migrateReferringStrategies(change, strategiesReferring(strategies, change.Old.StockID))
+			g.forget(change.Old.StockID)
+		}
+	}
+}
+
+func strategiesOfStock(strategies []structs.UserStock, stockID string) []structs.UserStock {
+	var result []structs.UserStock
+	for _, strategy := range strategies {
+		if strategy.StockID == stockID {
+			result = append(result, strategy)
+		}
+	}
+	return result
+}
+
+// strategiesReferring strategies of other stocks referring to the stock by ref() or rs()
+func strategiesReferring(strategies []structs.UserStock, stockID string) []structs.UserStock {
+	var result []structs.UserStock
+	for _, strategy := range strategies {
+		if strategy.StockID == stockID {
+			continue
+		}
+		refs, err := analyser.ReferencedInstruments(strategy.Strategy)
+		if err != nil {
+			continue
+		}
+		for _, ref := range refs {
+			if ref == stockID {
+				result = append(result, strategy)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// unlistedReference finds the stock not listed among those the strategy refers to
+func (g *General) unlistedReference(strategy structs.UserStock) (string, bool) {
+	refs, err := analyser.ReferencedInstruments(strategy.Strategy)
+	if err != nil {
+		return "", false
+	}
+	for _, ref := range refs {
+		if structs.IsIndex(ref) {
+			continue
+		}
+		if _, ok := g.itemChecker.StockFromID(ref); !ok {
+			return ref, true
+		}
+	}
+	return "", false
+}
+
+// forget stops collecting the stock no longer listed, unless an analyser still refers to it
+func (g *General) forget(stockID string) {
+	for _, ref := range g.broker.ReferencedStocks() {
+		if ref == stockID {
+			logger.Warn("[Controller] Cannot forget %s: still referred by strategies", stockID)
+			return
+		}
+	}
+	g.priceWatcher.Forget(stockID)
+}
+
+func (g *General) suspendStrategies(stock structs.Stock, strategies []structs.UserStock) {
+	side := []string{"사다", "팔다"}
+	for _, strategy := range strategies {
+		if strategy.Suspended {
+			continue
+		}
+		if err := g.broker.SuspendStrategy(strategy); err != nil {
+			logger.Error("[Controller] Error while suspending strategy of %s: %s", stock.StockID, err.Error())
+			continue
+		}
+		msg := fmt.Sprintf("[거래정지] 종목 %s(%s) 사라지다 목록에서. 정지되다 거래 전략: [%s] %s",
+			stock.Name, stock.StockID, side[strategy.OrderSide], strategy.Strategy)
+		g.pushManager.PushMessage(msg, strategy.UserID)
+	}
+}
+
+// suspendReferringStrategies suspends the strategies referring to the stock, releasing the references to it
+func (g *General) suspendReferringStrategies(stock structs.Stock, strategies []structs.UserStock) {
+	side := []string{"사다", "팔다"}
+	for _, strategy := range strategies {
+		if strategy.Suspended {
+			continue
+		}
+		if err := g.broker.SuspendStrategy(strategy); err != nil {
+			logger.Error("[Controller] Error while suspending strategy of %s referring to %s: %s", strategy.StockID, stock.StockID, err.Error())
+			continue
+		}
+		msg := fmt.Sprintf("[거래정지] 참조하던 종목 %s(%s) 사라지다 목록에서. 정지되다 %s의 거래 전략: [%s] %s",
+			stock.Name, stock.StockID, strategy.StockID, side[strategy.OrderSide], strategy.Strategy)
+		g.pushManager.PushMessage(msg, strategy.UserID)
+	}
+}
+
+func (g *General) resumeStrategies(stock structs.Stock, strategies []structs.UserStock) {
+	side := []string{"사다", "팔다"}
+	for _, strategy := range strategies {
+		if !strategy.Suspended {
+			continue
+		}
+		// 전략의 종목이나 참조하는 종목이 아직 목록에 없으면 정지된 채로 둔다
+		own, ok := g.itemChecker.StockFromID(strategy.StockID)
+		if !ok {
+			continue
+		}
+		if _, unlisted := g.unlistedReference(strategy); unlisted {
+			continue
+		}
+		strategy.Suspended = false
+		shouldRetainWatcher, err := g.broker.AddStrategy(strategy, g.onStrategyEvent, true)
+		if err != nil {
+			logger.Error("[Controller] Error while resuming strategy of %s: %s", strategy.StockID, err.Error())
+			continue
+		}
+		if shouldRetainWatcher {
+			g.priceWatcher.Register(own)
+		}
+		msg := fmt.Sprintf("[거래재개] 종목 %s(%s) 돌아오다 목록에. 재개되다 거래 전략: [%s] %s",
+			stock.Name, stock.StockID, side[strategy.OrderSide], strategy.Strategy)
+		g.pushManager.PushMessage(msg, strategy.UserID)
+	}
+}
+
+func (g *General) migrateStrategies(change watcher.ListingChange, strategies, existing []structs.UserStock) {
+	side := []string{"사다", "팔다"}
+	type userSide struct {
+		userID    int64
+		orderSide int
+	}
+	occupied := make(map[userSide]bool)
+	for _, strategy := range existing {
+		occupied[userSide{strategy.UserID, strategy.OrderSide}] = true
+	}
+	for _, strategy := range strategies {
+		// 옮기지 못하면 정지된 채로 남는다
+		if err := g.broker.SuspendStrategy(strategy); err != nil {
+			logger.Error("[Controller] Error while suspending strategy of %s: %s", change.Old.StockID, err.Error())
+			continue
+		}
+		format := "[종목변경] 종목 %s(%s) 바뀌다 %s(%s)로. 옮겨지다 거래 전략: [%s] %s"
+		if occupied[userSide{strategy.UserID, strategy.OrderSide}] {
+			format = "[종목변경] 종목 %s(%s) 바뀌다 %s(%s)로. 이미 있다 전략, 삭제되다: [%s] %s"
+		} else {
+			migrated := strategy
+			migrated.StockID = change.New.StockID
+			migrated.Suspended = false
+			shouldRetainWatcher, err := g.broker.AddStrategy(migrated, g.onStrategyEvent, true)
+			if err != nil {
+				logger.Error("[Controller] Error while migrating strategy to %s: %s", change.New.StockID, err.Error())
+				msg := fmt.Sprintf("[종목변경] 종목 %s(%s) 바뀌다 %s(%s)로. 옮기지 못하다, 정지되다 거래 전략: [%s] %s",
+					change.Old.Name, change.Old.StockID, change.New.Name, change.New.StockID, side[strategy.OrderSide], strategy.Strategy)
+				g.pushManager.PushMessage(msg, strategy.UserID)
+				continue
+			}
+			if shouldRetainWatcher {
+				g.priceWatcher.Register(change.New)
+			}
+		}
+		user := structs.User{UserID: strategy.UserID}
+		if err := g.broker.DeleteStrategy(user, change.Old.StockID, strategy.OrderSide); err != nil {
+			logger.Error("[Controller] Error while deleting strategy of %s: %s", change.Old.StockID, err.Error())
+		}
+		msg := fmt.Sprintf(format,
+			change.Old.Name, change.Old.StockID, change.New.Name, change.New.StockID, side[strategy.OrderSide], strategy.Strategy)
+		g.pushManager.PushMessage(msg, strategy.UserID)
+	}
+}
+
+// migrateReferringStrategies rewrites the strategies referring to the stock so that they refer to its new code.
+// Those failed to be rewritten are suspended.
+func (g *General) migrateReferringStrategies(change watcher.ListingChange, strategies []structs.UserStock) {
+	side := []string{"사다", "팔다"}
+	for _, strategy := range strategies {
+		migrated := strategy
+		rewritten, err := analyser.ReplaceInstrument(strategy.Strategy, change.Old.StockID, change.New.StockID)
+		if err == nil {
+			migrated.Strategy = rewritten
+			if migrated.Suspended {
+				// 정지된 전략은 분석기에 없으므로 기록만 고친다
+				_, err = g.dbClient.Upsert(&migrated)
+			} else {
+				var shouldRetainWatcher bool
+				shouldRetainWatcher, err = g.broker.AddStrategy(migrated, g.onStrategyEvent, true)
+				if stock, ok := g.itemChecker.StockFromID(strategy.StockID); ok && shouldRetainWatcher {
+					g.priceWatcher.Register(stock)
+				}
+			}
+		}
+		if err != nil {
+			logger.Error("[Controller] Error while migrating strategy of %s referring to %s: %s", strategy.StockID, change.Old.StockID, err.Error())
+			if suspendErr := g.broker.SuspendStrategy(strategy); suspendErr != nil {
+				logger.Error("[Controller] Error while suspending strategy of %s: %s", strategy.StockID, suspendErr.Error())
+			}
+			msg := fmt.Sprintf("[종목변경] 참조하던 종목 %s(%s) 바뀌다 %s(%s)로. 고치지 못하다, 정지되다 %s의 거래 전략: [%s] %s",
+				change.Old.Name, change.Old.StockID, change.New.Name, change.New.StockID, strategy.StockID, side[strategy.OrderSide], strategy.Strategy)
+			g.pushManager.PushMessage(msg, strategy.UserID)
+			continue
+		}
+		msg := fmt.Sprintf("[종목변경] 참조하던 종목 %s(%s) 바뀌다 %s(%s)로. 고쳐지다 %s의 거래 전략: [%s] %s",
+			change.Old.Name, change.Old.StockID, change.New.Name, change.New.StockID, strategy.StockID, side[strategy.OrderSide], migrated.Strategy)
+		g.pushManager.PushMessage(msg, strategy.UserID)
+	}
+}
@@ -191,6 +191,7 @@ func (client *DBClient) RegisterStructFromRegisterables(registerables []DBRegist
 	defer client.mutex.Unlock()
 
 	client.mutex.Lock()
+	tables := make(map[*gorp.TableMap]interface{})
 	for _, r := range registerables {
 		form := r.GetDBRegisterForm()
 		table := client.dbmap.AddTableWithName(form.BaseStruct, form.Name)
@@ -200,6 +201,7 @@ func (client *DBClient) RegisterStructFromRegisterables(registerables []DBRegist
 		if form.UniqueColumns != nil && len(form.UniqueColumns) > 1 {
 			table.SetUniqueTogether(form.UniqueColumns...)
 		}
+		tables[table] = form.BaseStruct
 	}
 	err := client.dbmap.CreateTablesIfNotExists()
 	if err != nil {
@@ -207,6 +209,61 @@ func (client *DBClient) RegisterStructFromRegisterables(registerables []DBRegist
 	} else {
 		logger.Info("[DB] Created table")
 	}
+	for table, base := range tables {
+		if err := client.addMissingColumns(table, base); err != nil {
+			logger.Error("[DB] Adding columns to %s failed: %s", table.TableName, err.Error())
+		}
+	}
+}
+
+// addMissingColumns adds columns of the fields added to the struct after its table was created.
+// Existing rows get the zero value of the field. Mutex must be locked.
+func (client *DBClient) addMissingColumns(table *gorp.TableMap, base interface{}) error {
+	var existing []string
+	_, err := client.dbmap.Select(&existing,
+		"select COLUMN_NAME from information_schema.COLUMNS where TABLE_SCHEMA=database() and TABLE_NAME=?",
+		table.TableName)
+	if err != nil {
+		return err
+	}
+	if len(existing) == 0 {
+		return nil
+	}
+	hasColumn := make(map[string]bool)
+	for _, column := range existing {
+		hasColumn[strings.ToLower(column)] = true
+	}
+
+	baseType := reflect.TypeOf(base)
+	for _, column := range table.Columns {
+		if column.Transient || hasColumn[strings.ToLower(column.ColumnName)] {
+			continue
+		}
+		field, ok := baseType.FieldByName(column.ColumnName)
+		if !ok {
+			continue
+		}
+		var zero string
+		switch field.Type.Kind() {
+		case reflect.String:
+			zero = "''"
+		case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+			zero = "0"
+		default:
+			return newError(fmt.Sprintf("Cannot add column %s of type %v", column.ColumnName, field.Type))
+		}
+		query := fmt.Sprintf("alter table %s add column %s %s not null default %s",
+			client.dbmap.Dialect.QuotedTableForQuery(table.SchemaName, table.TableName),
+			client.dbmap.Dialect.QuoteField(column.ColumnName),
+			client.dbmap.Dialect.ToSqlType(field.Type, column.MaxSize, false),
+			zero)
+		if _, err := client.dbmap.Exec(query); err != nil {
+			return err
+		}
+		logger.Info("[DB] Added column %s to %s", column.ColumnName, table.TableName)
+	}
+	return nil
 }
 
 // DropTable drops table of struct if exists
@@ -20,7 +20,7 @@ require (
 	github.com/helloworldpark/govaluate v0.0.0-20190409082332-bde2f2afa732
 	github.com/json-iterator/go v1.1.8 // indirect
 	github.com/jstemmer/go-junit-report v0.9.1 // indirect
-	github.com/jung-kurt/gofpdf v1.16.2 // indirect
+	github.com/jung-kurt/gofpdf v1.16.2
 	github.com/lib/pq v1.3.0 // indirect
 	github.com/mattn/go-isatty v0.0.10 // indirect
 	github.com/mattn/go-sqlite3 v2.0.2+incompatible // indirect
@@ -2,14 +2,20 @@ package main
 
 import (
 	"flag"
+	"math"
+	"runtime"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/helloworldpark/tickle-stock-watcher/analyser"
 	"github.com/helloworldpark/tickle-stock-watcher/controller"
 	"github.com/helloworldpark/tickle-stock-watcher/storage"
 	"github.com/helloworldpark/tickle-stock-watcher/database"
 	"github.com/helloworldpark/tickle-stock-watcher/logger"
 	"github.com/helloworldpark/tickle-stock-watcher/push"
+	"github.com/helloworldpark/tickle-stock-watcher/report"
 	"github.com/helloworldpark/tickle-stock-watcher/structs"
+	"github.com/helloworldpark/tickle-stock-watcher/watcher"
 )
 
 func main() {
@@ -17,13 +23,23 @@ func main() {
 
 	credPath := flag.String("credential", "", "Credential for DB access")
 	telegramPath := flag.String("telegram", "", "Telegram token for webhook")
+	prospectWorkers := flag.Int("workers", runtime.NumCPU(), "Number of workers finding prospects")
+	reportFont := flag.String("font", "", "UTF-8 TTF font for weekly reports")
+	replayPath := flag.String("replay", "", "Replay prices from a CSV/JSON file of ticks or a directory of fixtures instead of scraping, offline without Telegram, Cloud Storage or KRX")
+	replaySpeed := flag.Float64("replay-speed", 1, "How many times faster than the wall clock to replay")
+	crawlRate := flag.Float64("crawl-rate", 2, "Requests per second to each host while crawling")
+	historyYears := flag.Int("history-years", watcher.DefaultHistoryYears, "Years of daily prices to collect, -1 for every price since the listing date. Kept until changed by this or the history order")
+	corporateActions := flag.String("corporate-actions", "", "CSV file of corporate actions to adjust prices by: Stock ID,date,split|dividend,value")
+	quoteBudget := flag.Int("quote-budget", 60, "Requests per minute for quotes of every watched stock altogether")
 	flag.Parse()
 
 	if credPath == nil || *credPath == "" {
 		logger.Panic("No -credential provided")
 	}
 
-	if telegramPath == nil || *telegramPath == "" {
+	// 재생은 오프라인으로 돌리므로 Telegram이 없어도 된다
+	isReplaying := len(*replayPath) > 0
+	if !isReplaying && (telegramPath == nil || *telegramPath == "") {
 		logger.Panic("No -telegram provided")
 	}
 
@@ -42,16 +58,72 @@ func main() {
 		structs.UserStock{},
 		structs.WatchingStock{},
 		structs.Invitation{},
+		structs.Prospect{},
+		structs.StrategyTrigger{},
+		structs.IntradayPrice{},
+		structs.HistoryDepth{},
+		structs.QuarantinedPrice{},
+		structs.CorporateAction{},
 	})
 
-	// TelegramClient 초기화
-	push.InitTelegram(*telegramPath)
+	// 분할, 배당 등 가격 조정
+	if len(*corporateActions) > 0 {
+		count, err := analyser.ImportCorporateActions(client, *corporateActions)
+		if err != nil {
+			logger.Panic("Failed to load -corporate-actions: %+v", err)
+		}
+		logger.Info("Loaded %d corporate actions", count)
+	}
+
+	// 재생 중에는 메세지를 로그로 남기고 차트를 올리지 않는다
+	if isReplaying {
+		push.InitOffline()
+	} else {
+		// TelegramClient 초기화
+		push.InitTelegram(*telegramPath)
+
+		// Google Cloud Storage 초기화
+		storage.InitStorage()
+	}
+
+	// Scouter 초기화
+	analyser.SetProspectWorkers(*prospectWorkers)
 
-	// Google Cloud Storage 초기화
-	storage.InitStorage()
+	// Report 초기화
+	report.SetFont(*reportFont)
+
+	// 가격 정보 출처
+	watcher.SetRequestsPerSecond(*crawlRate)
+	var source watcher.PriceSource = watcher.NewNaverSource()
+	if isReplaying {
+		replaySource, err := watcher.NewReplaySourceFromPath(*replayPath, *replaySpeed)
+		if err != nil {
+			logger.Panic("Failed to load -replay: %+v", err)
+		}
+		source = replaySource
+	}
 
 	// General 생성
-	general := controller.NewGeneral(client)
+	general := controller.NewGeneral(client, source)
+	general.AccessWatcher().SetQuoteBudget(*quoteBudget)
+	if isReplaying {
+		general.AccessWatcher().SetStartJitter(0)
+		// 재생이 빠른 만큼 자주 받아야 틱을 건너뛰지 않는다
+		if *replaySpeed > 0 {
+			interval := general.AccessWatcher().PollInterval()
+			general.AccessWatcher().SetPollInterval(time.Duration(float64(interval) / *replaySpeed))
+			general.AccessWatcher().SetQuoteBudget(int(math.Ceil(float64(*quoteBudget) * *replaySpeed)))
+		}
+	}
+	// 주어졌을 때만 바꾸고, 아니면 저장해 둔 보관 기간을 따른다
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name != "history-years" {
+			return
+		}
+		if err := general.AccessWatcher().SetHistoryDepth(*historyYears); err != nil {
+			logger.Panic("Failed to set -history-years: %+v", err)
+		}
+	})
 	general.Initialize()
 
 	gin.SetMode(gin.ReleaseMode)
@@ -0,0 +1,202 @@
+package orders
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/helloworldpark/tickle-stock-watcher/analyser"
+	"github.com/helloworldpark/tickle-stock-watcher/commons"
+	"github.com/helloworldpark/tickle-stock-watcher/database"
+	"github.com/helloworldpark/tickle-stock-watcher/structs"
+	"github.com/helloworldpark/tickle-stock-watcher/watcher"
+)
+
+const defaultChartDays = 60
+const maxChartDays = 500
+const maxChartsToCompare = 8
+
+type chartOrder struct {
+	action Action
+}
+
+func (o *chartOrder) Name() string {
+	return "chart"
+}
+
+func (o *chartOrder) IsValid(args []string) error {
+	_, err := parseChartRequest(args)
+	return err
+}
+
+func (o *chartOrder) SetAction(a Action) {
+	o.action = a
+}
+
+func (o *chartOrder) OnAction(user structs.User, args []string) error {
+	err := o.IsValid(args)
+	if err != nil {
+		return err
+	}
+	return o.action(user, args)
+}
+
+func (o *chartOrder) IsAsync() bool {
+	return true
+}
+
+func (o *chartOrder) IsPublic() bool {
+	return false
+}
+
+// NewChartOrder order 'chart'
+func NewChartOrder() Order {
+	return &chartOrder{}
+}
+
+// chartRequest parsed arguments of 'chart'
+type chartRequest struct {
+	stock   string
+	days    int
+	options analyser.CandlePlotOptions
+	compare []string // Stocks to compare, empty for a candle chart
+}
+
+// parseChartDays parses the number of days to draw
+func parseChartDays(arg string) (int, bool, error) {
+	days, err := strconv.Atoi(arg)
+	if err != nil {
+		return 0, false, nil
+	}
+	if days < 1 || days > maxChartDays {
+		return 0, true, newError(fmt.Sprintf("Invalid number of days: need 1 to %d, got %d", maxChartDays, days))
+	}
+	return days, true, nil
+}
+
+// parseChartRequest parses arguments of 'chart'
+// chart <stock name|id> [days] [indicators...]
+// chart compare <stock name|id>... [days]
+func parseChartRequest(args []string) (chartRequest, error) {
+	request := chartRequest{days: defaultChartDays}
+	if len(args) == 0 {
+		return request, newError("Invalid arguments: need a stock name or ID")
+	}
+	if args[0] == "compare" || args[0] == "vs" || args[0] == "비교" {
+		return parseCompareRequest(request, args[1:])
+	}
+	request.stock = args[0]
+	args = args[1:]
+	if len(args) > 0 {
+		days, isDays, err := parseChartDays(args[0])
+		if err != nil {
+			return request, err
+		}
+		if isDays {
+			request.days = days
+			args = args[1:]
+		}
+	}
+	options, err := analyser.ParseCandlePlotOptions(joinChartSpecs(args))
+	if err != nil {
+		return request, err
+	}
+	request.options = options
+	return request, nil
+}
+
+func parseCompareRequest(request chartRequest, args []string) (chartRequest, error) {
+	if len(args) > 0 {
+		days, isDays, err := parseChartDays(args[len(args)-1])
+		if err != nil {
+			return request, err
+		}
+		if isDays {
+			request.days = days
+			args = args[:len(args)-1]
+		}
+	}
+	if len(args) < 2 || len(args) > maxChartsToCompare {
+		return request, newError(fmt.Sprintf("Invalid arguments: need 2 to %d stocks to compare, got %d", maxChartsToCompare, len(args)))
+	}
+	request.compare = args
+	return request, nil
+}
+
+// joinChartSpecs joins specs split by spaces inside parentheses
+// ex) ["bollinger(20,", "2)"] -> ["bollinger(20,2)"]
+func joinChartSpecs(args []string) []string {
+	var specs []string
+	var buffer []string
+	depth := 0
+	for _, arg := range args {
+		buffer = append(buffer, arg)
+		depth += strings.Count(arg, "(") - strings.Count(arg, ")")
+		if depth <= 0 {
+			specs = append(specs, concat(buffer))
+			buffer = nil
+			depth = 0
+		}
+	}
+	if len(buffer) > 0 {
+		specs = append(specs, concat(buffer))
+	}
+	return specs
+}
+
+// Chart implements order 'chart'
+func Chart(
+	db database.DBAccess,
+	stockinfo watcher.StockAccess,
+	itemChecker *watcher.StockItemChecker,
+	onSuccess func(user structs.User, stocks []structs.Stock, days int, chartURL string)) Action {
+	findStock := func(stockvar string) (structs.Stock, error) {
+		stock, ok := stockinfo.AccessStockItem(stockvar)
+		if !ok {
+			stock, ok = stockinfo.AccessStockItemByName(stockvar)
+			if !ok {
+				return stock, newError(fmt.Sprintf("Invalid stock: %s", stockvar))
+			}
+		}
+		return stock, nil
+	}
+	f := func(user structs.User, args []string) error {
+		request, err := parseChartRequest(args)
+		if err != nil {
+			return err
+		}
+		// 같은 종목의 다른 차트를 덮어쓰지 않도록
+		tag := fmt.Sprintf("_%d_%d", user.UserID, commons.Now().UnixNano())
+
+		if len(request.compare) > 0 {
+			stocks := make([]structs.Stock, len(request.compare))
+			stockIDs := make([]string, len(request.compare))
+			for i := range request.compare {
+				stocks[i], err = findStock(request.compare[i])
+				if err != nil {
+					return err
+				}
+				stockIDs[i] = stocks[i].StockID
+			}
+			chartURL, err := analyser.NewComparisonChart(db.AccessDB(), request.days, stockIDs, tag)
+			if err != nil {
+				return newError(err.Error())
+			}
+			onSuccess(user, stocks, request.days, chartURL)
+			return nil
+		}
+
+		stock, err := findStock(request.stock)
+		if err != nil {
+			return err
+		}
+		request.options.Tag = tag
+		chartURL, err := analyser.NewCandleChart(db.AccessDB(), request.days, stock.StockID, itemChecker, request.options)
+		if err != nil {
+			return newError(err.Error())
+		}
+		onSuccess(user, []structs.Stock{stock}, request.days, chartURL)
+		return nil
+	}
+	return f
+}
@@ -2,6 +2,7 @@ package orders
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/helloworldpark/tickle-stock-watcher/analyser"
 	"github.com/helloworldpark/tickle-stock-watcher/commons"
@@ -78,13 +79,17 @@ func DeleteOrder(
 		stock, ok := stockinfo.AccessStockItem(stockvar)
 		if !ok {
 			stock, ok = stockinfo.AccessStockItemByName(stockvar)
-			if !ok {
-				firstCharDiff := stockvar[0] - "0"[0]
-				if 0 <= firstCharDiff && firstCharDiff <= 9 {
-					return newError(fmt.Sprintf("Invalid stock ID: %s", stockvar))
-				}
-				return newError(fmt.Sprintf("Invalid stock name: %s", stockvar))
+		}
+		if !ok {
+			// 목록에서 사라진 종목의 정지된 전략도 지울 수 있다
+			stock, ok = unlistedStockOfStrategies(broker.AccessBroker().GetStrategy(user), stockvar)
+		}
+		if !ok {
+			firstCharDiff := stockvar[0] - "0"[0]
+			if 0 <= firstCharDiff && firstCharDiff <= 9 {
+				return newError(fmt.Sprintf("Invalid stock ID: %s", stockvar))
 			}
+			return newError(fmt.Sprintf("Invalid stock name: %s", stockvar))
 		}
 		deleteStrategies := func(orderside int) error {
 			err := broker.AccessBroker().DeleteStrategy(user, stock.StockID, orderside)
@@ -136,3 +141,14 @@ func DeleteOrder(
 	}
 	return f
 }
+
+// unlistedStockOfStrategies finds the stock no longer listed by its ID among the suspended strategies
+func unlistedStockOfStrategies(strategies []structs.UserStock, stockID string) (structs.Stock, bool) {
+	stockID = strings.ToUpper(stockID)
+	for _, strategy := range strategies {
+		if strategy.Suspended && strategy.StockID == stockID {
+			return structs.Stock{StockID: stockID, Name: stockID}, true
+		}
+	}
+	return structs.Stock{}, false
+}
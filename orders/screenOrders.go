@@ -0,0 +1,155 @@
+package orders
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/helloworldpark/tickle-stock-watcher/analyser"
+	"github.com/helloworldpark/tickle-stock-watcher/database"
+	"github.com/helloworldpark/tickle-stock-watcher/structs"
+	"github.com/helloworldpark/tickle-stock-watcher/watcher"
+)
+
+type screenOrder struct {
+	action Action
+}
+
+func (o *screenOrder) Name() string {
+	return "screen"
+}
+
+func (o *screenOrder) IsValid(args []string) error {
+	_, err := parseScreenRequest(args)
+	return err
+}
+
+func (o *screenOrder) SetAction(a Action) {
+	o.action = a
+}
+
+func (o *screenOrder) OnAction(user structs.User, args []string) error {
+	err := o.IsValid(args)
+	if err != nil {
+		return err
+	}
+	return o.action(user, args)
+}
+
+func (o *screenOrder) IsAsync() bool {
+	return true
+}
+
+func (o *screenOrder) IsPublic() bool {
+	return false
+}
+
+// NewScreenOrder order 'screen'
+func NewScreenOrder() Order {
+	return &screenOrder{}
+}
+
+// parseScreenRequest parses arguments of 'screen'
+// screen <dsl expression> [kospi|kosdaq|konex] [stock|preferred|etf|etn] [sector:<name>] [by <dsl expression>]
+// Options are only taken after the expression, and the indicator to sort by at the end.
+func parseScreenRequest(args []string) (analyser.ScreenRequest, error) {
+	var request analyser.ScreenRequest
+	isSortBy := false
+	for i, arg := range args {
+		if arg == "by" {
+			isSortBy = true
+			request.SortBy = concat(args[i+1:])
+			args = args[:i]
+			break
+		}
+	}
+	end := len(args)
+	for end > 0 && isScreenOption(args[end-1]) {
+		end--
+	}
+	for _, arg := range args[end:] {
+		switch {
+		case arg == structs.KOSPI || arg == structs.KOSDAQ || arg == structs.KONEX:
+			request.Market = structs.Market(arg)
+		case isSectorArg(arg):
+			sector, err := parseSectorArg(arg)
+			if err != nil {
+				return request, err
+			}
+			request.Sector = sector
+		default:
+			request.Instrument = structs.Instrument(arg)
+		}
+	}
+	request.Strategy = concat(args[:end])
+	if len(request.Strategy) == 0 {
+		return request, newError("Invalid arguments: need a rule to screen")
+	}
+	if isSortBy && len(request.SortBy) == 0 {
+		return request, newError("Invalid arguments: need an indicator after 'by'")
+	}
+	return request, nil
+}
+
+// isScreenOption checks if the argument is a market, an instrument or a sector to screen in
+func isScreenOption(arg string) bool {
+	if arg == structs.KOSPI || arg == structs.KOSDAQ || arg == structs.KONEX {
+		return true
+	}
+	return (structs.IsInstrument(arg) && arg != structs.InstrumentIndex) || isSectorArg(arg)
+}
+
+// Screen implements order 'screen'
+func Screen(
+	db database.DBAccess,
+	itemChecker *watcher.StockItemChecker,
+	onSuccess func(user structs.User, request analyser.ScreenRequest, results []analyser.ScreenResult)) Action {
+	f := func(user structs.User, args []string) error {
+		request, err := parseScreenRequest(args)
+		if err != nil {
+			return err
+		}
+		results, err := analyser.Screen(db.AccessDB(), itemChecker, request)
+		if err != nil {
+			return newError(err.Error())
+		}
+		onSuccess(user, request, results)
+		return nil
+	}
+	return f
+}
+
+// sectorPrefixes prefixes of the argument filtering by sector, i.e. sector:반도체
+var sectorPrefixes = []string{"sector:", "업종:"}
+
+func isSectorArg(arg string) bool {
+	for _, prefix := range sectorPrefixes {
+		if strings.HasPrefix(arg, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseSectorArg(arg string) (string, error) {
+	for _, prefix := range sectorPrefixes {
+		if strings.HasPrefix(arg, prefix) {
+			sector := strings.TrimPrefix(arg, prefix)
+			if len(sector) == 0 {
+				return "", newError(fmt.Sprintf("Invalid arguments: need a sector after '%s'", prefix))
+			}
+			return sector, nil
+		}
+	}
+	return "", newError(fmt.Sprintf("Invalid sector: %s", arg))
+}
+
+// SectorFromArgs finds the sector to filter by among the arguments, i.e. prospect sector:반도체
+// Returns empty if not given.
+func SectorFromArgs(args []string) (string, error) {
+	for _, arg := range args {
+		if isSectorArg(arg) {
+			return parseSectorArg(arg)
+		}
+	}
+	return "", nil
+}
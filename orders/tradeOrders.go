@@ -90,6 +90,15 @@ func Trade(
 			}
 		}
 		strategy := concat(args[1:])
+		refs, err := analyser.ReferencedInstruments(strategy)
+		if err != nil {
+			return newError(err.Error())
+		}
+		for _, stockID := range refs {
+			if _, ok := stockinfo.AccessStockItem(stockID); !ok {
+				return newError(fmt.Sprintf("Invalid stock ID referred: %s", stockID))
+			}
+		}
 
 		userStrategy := structs.UserStock{
 			UserID:    user.UserID,
@@ -112,8 +121,10 @@ func Trade(
 		now := commons.Now()
 		nowHour := float64(now.Hour()) + float64(now.Minute())/60
 		if 9 < nowHour && nowHour < 15.5 {
-			if broker.AccessBroker().CanFeedPrice(stock.StockID) {
-				broker.AccessBroker().FeedPrice(stock.StockID, price.AccessWatcher().StartWatchingStock(stock.StockID))
+			for _, stockID := range append([]string{stock.StockID}, refs...) {
+				if broker.AccessBroker().CanFeedPrice(stockID) {
+					broker.AccessBroker().FeedPrice(stockID, price.AccessWatcher().StartWatchingStock(stockID))
+				}
 			}
 		}
 		onSuccess(user, orderSide, stock.Name, stock.StockID, strategy)
@@ -1,7 +1,12 @@
 package orders
 
 import (
+	"fmt"
+	"strconv"
+	"time"
+
 	"github.com/helloworldpark/tickle-stock-watcher/analyser"
+	"github.com/helloworldpark/tickle-stock-watcher/commons"
 	"github.com/helloworldpark/tickle-stock-watcher/structs"
 	"github.com/helloworldpark/tickle-stock-watcher/watcher"
 )
@@ -88,3 +93,299 @@ func DateCheckerDescription(dateChecker *watcher.DateChecker, onSuccess func(use
 	}
 	return f
 }
+
+type backfillOrder struct {
+	action Action
+}
+
+func (o *backfillOrder) Name() string {
+	return "backfill"
+}
+
+func (o *backfillOrder) IsValid(args []string) error {
+	_, _, _, err := parseBackfillRequest(args)
+	return err
+}
+
+func (o *backfillOrder) SetAction(a Action) {
+	o.action = a
+}
+
+func (o *backfillOrder) OnAction(user structs.User, args []string) error {
+	err := o.IsValid(args)
+	if err != nil {
+		return err
+	}
+	return o.action(user, args)
+}
+
+func (o *backfillOrder) IsAsync() bool {
+	return true
+}
+
+func (o *backfillOrder) IsPublic() bool {
+	return false
+}
+
+// NewBackfillOrder order 'backfill'
+func NewBackfillOrder() Order {
+	return &backfillOrder{}
+}
+
+// parseBackfillRequest parses arguments of 'backfill'
+// backfill <stock name|id|all> [from: 2006-01-02]
+// Returns the target, and from which date if given
+func parseBackfillRequest(args []string) (string, time.Time, bool, error) {
+	if len(args) == 0 || len(args) > 2 {
+		return "", time.Time{}, false, newError("Invalid arguments: backfill <stock|all> [from]")
+	}
+	if len(args) == 1 {
+		return args[0], time.Time{}, false, nil
+	}
+	timestamp, err := commons.ParseTimestamp("2006-01-02", args[1])
+	if err != nil {
+		return "", time.Time{}, false, newError(fmt.Sprintf("Invalid date: %s, need like 2006-01-02", args[1]))
+	}
+	return args[0], commons.Unix(timestamp), true, nil
+}
+
+// Backfill implements order 'backfill'
+func Backfill(
+	watcherAccess watcher.WatcherAccess,
+	stockinfo watcher.StockAccess,
+	dateChecker *watcher.DateChecker,
+	onSuccess func(user structs.User, results []watcher.BackfillResult)) Action {
+	f := func(user structs.User, args []string) error {
+		if !user.Superuser {
+			return newError("Only superuser can order this")
+		}
+		target, from, hasFrom, err := parseBackfillRequest(args)
+		if err != nil {
+			return err
+		}
+		w := watcherAccess.AccessWatcher()
+		var stocks []structs.Stock
+		if target == "all" || target == "전체" {
+			for _, stockID := range w.WatchingStockIDs() {
+				stock, ok := stockinfo.AccessStockItem(stockID)
+				if !ok {
+					stock = structs.Stock{StockID: stockID}
+				}
+				stocks = append(stocks, stock)
+			}
+		} else {
+			stock, ok := stockinfo.AccessStockItem(target)
+			if !ok {
+				stock, ok = stockinfo.AccessStockItemByName(target)
+				if !ok {
+					return newError(fmt.Sprintf("Invalid stock: %s", target))
+				}
+			}
+			stocks = []structs.Stock{stock}
+		}
+
+		results := make([]watcher.BackfillResult, len(stocks))
+		for i, stock := range stocks {
+			// 날짜가 없으면 종목의 보관 기간만큼 채운다
+			stockFrom := from
+			if !hasFrom {
+				stockFrom, err = w.BackfillStart(stock)
+				if err != nil {
+					results[i] = watcher.BackfillResult{StockID: stock.StockID, Err: err}
+					continue
+				}
+			}
+			filled, unfilled, err := w.Backfill(stock, stockFrom, dateChecker)
+			results[i] = watcher.BackfillResult{StockID: stock.StockID, Filled: filled, Unfilled: unfilled, Err: err}
+		}
+		onSuccess(user, results)
+		return nil
+	}
+	return f
+}
+
+type historyOrder struct {
+	action Action
+}
+
+func (o *historyOrder) Name() string {
+	return "history"
+}
+
+func (o *historyOrder) IsValid(args []string) error {
+	_, _, _, err := parseHistoryRequest(args)
+	return err
+}
+
+func (o *historyOrder) SetAction(a Action) {
+	o.action = a
+}
+
+func (o *historyOrder) OnAction(user structs.User, args []string) error {
+	err := o.IsValid(args)
+	if err != nil {
+		return err
+	}
+	return o.action(user, args)
+}
+
+func (o *historyOrder) IsAsync() bool {
+	return true
+}
+
+func (o *historyOrder) IsPublic() bool {
+	return false
+}
+
+// NewHistoryOrder order 'history'
+func NewHistoryOrder() Order {
+	return &historyOrder{}
+}
+
+// parseHistoryRequest parses arguments of 'history'
+// history <stock name|id|all> [years|full]
+// Returns the target, years of the depth and whether the depth is given
+func parseHistoryRequest(args []string) (string, int, bool, error) {
+	if len(args) == 0 || len(args) > 2 {
+		return "", 0, false, newError("Invalid arguments: history <stock|all> [years|full]")
+	}
+	if len(args) == 1 {
+		return args[0], 0, false, nil
+	}
+	if args[1] == "full" || args[1] == "전체" {
+		return args[0], structs.FullHistory, true, nil
+	}
+	years, err := strconv.Atoi(args[1])
+	if err != nil || years < 1 {
+		return "", 0, false, newError(fmt.Sprintf("Invalid years: %s, need a positive number or full", args[1]))
+	}
+	return args[0], years, true, nil
+}
+
+// History implements order 'history'
+// Sets the history depth of the stock, or globally with all, and imports every price within the depth.
+func History(
+	watcherAccess watcher.WatcherAccess,
+	stockinfo watcher.StockAccess,
+	broker analyser.BrokerAccess,
+	onProgress func(user structs.User, progress watcher.HistoryProgress, done, total int)) Action {
+	f := func(user structs.User, args []string) error {
+		if !user.Superuser {
+			return newError("Only superuser can order this")
+		}
+		target, years, hasYears, err := parseHistoryRequest(args)
+		if err != nil {
+			return err
+		}
+		w := watcherAccess.AccessWatcher()
+		var stocks []structs.Stock
+		if target == "all" || target == "전체" {
+			if hasYears {
+				if err := w.SetHistoryDepth(years); err != nil {
+					return newError(err.Error())
+				}
+			}
+			for _, stockID := range w.WatchingStockIDs() {
+				stock, ok := stockinfo.AccessStockItem(stockID)
+				if !ok {
+					stock = structs.Stock{StockID: stockID}
+				}
+				stocks = append(stocks, stock)
+			}
+		} else {
+			stock, ok := stockinfo.AccessStockItem(target)
+			if !ok {
+				stock, ok = stockinfo.AccessStockItemByName(target)
+				if !ok {
+					return newError(fmt.Sprintf("Invalid stock: %s", target))
+				}
+			}
+			if hasYears {
+				if err := w.SetStockHistoryDepth(stock.StockID, years); err != nil {
+					return newError(err.Error())
+				}
+			}
+			stocks = []structs.Stock{stock}
+		}
+
+		for i, stock := range stocks {
+			_, err := w.ImportHistory(stock, func(progress watcher.HistoryProgress) {
+				onProgress(user, progress, i, len(stocks))
+			})
+			if err != nil {
+				return newError(fmt.Sprintf("Error while importing history of %s: %s", stock.StockID, err.Error()))
+			}
+			broker.AccessBroker().ReloadPastPrice(stock.StockID)
+		}
+		return nil
+	}
+	return f
+}
+
+type corporateActionOrder struct {
+	action Action
+}
+
+func (o *corporateActionOrder) Name() string {
+	return "corporate"
+}
+
+func (o *corporateActionOrder) IsValid(args []string) error {
+	if len(args) != 4 {
+		return newError("Invalid arguments: corporate <stock> <yyyy-mm-dd> <split|dividend> <value>")
+	}
+	_, err := analyser.ParseCorporateAction(args[0], args[1], args[2], args[3])
+	return err
+}
+
+func (o *corporateActionOrder) SetAction(a Action) {
+	o.action = a
+}
+
+func (o *corporateActionOrder) OnAction(user structs.User, args []string) error {
+	err := o.IsValid(args)
+	if err != nil {
+		return err
+	}
+	return o.action(user, args)
+}
+
+func (o *corporateActionOrder) IsAsync() bool {
+	return true
+}
+
+func (o *corporateActionOrder) IsPublic() bool {
+	return false
+}
+
+// NewCorporateActionOrder order 'corporate'
+func NewCorporateActionOrder() Order {
+	return &corporateActionOrder{}
+}
+
+// CorporateAction implements order 'corporate'
+// Stores a split or a dividend of the stock, like -corporate-actions, and adjusts the past prices by it.
+func CorporateAction(stockinfo watcher.StockAccess, broker analyser.BrokerAccess, onAction func(user structs.User, stock structs.Stock, action structs.CorporateAction)) Action {
+	f := func(user structs.User, args []string) error {
+		if !user.Superuser {
+			return newError("Only superuser can order this")
+		}
+		stock, ok := stockinfo.AccessStockItem(args[0])
+		if !ok {
+			stock, ok = stockinfo.AccessStockItemByName(args[0])
+			if !ok {
+				return newError(fmt.Sprintf("Invalid stock: %s", args[0]))
+			}
+		}
+		action, err := analyser.ParseCorporateAction(stock.StockID, args[1], args[2], args[3])
+		if err != nil {
+			return err
+		}
+		if err := broker.AccessBroker().AddCorporateActions([]structs.CorporateAction{action}); err != nil {
+			return newError(fmt.Sprintf("Error while storing corporate action of %s: %s", stock.StockID, err.Error()))
+		}
+		onAction(user, stock, action)
+		return nil
+	}
+	return f
+}
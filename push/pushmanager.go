@@ -102,3 +102,14 @@ func (m *Manager) PushPhoto(caption, picURL string, userid int64) {
 		SendPhotoTelegram(userid, caption, picURL)
 	})
 }
+
+// PushDocument pushes local file as a document to Telegram Bot
+func (m *Manager) PushDocument(caption, filePath string, userid int64) {
+	if len(caption) >= msgMaxLength {
+		caption = caption[:msgMaxLength]
+	}
+
+	m.pushTask(func() {
+		SendDocumentTelegram(userid, caption, filePath)
+	})
+}
@@ -4,8 +4,12 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"mime/multipart"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -15,6 +19,7 @@ import (
 )
 
 var telegramToken = ""
+var telegramOffline = false
 var telegramClient = &http.Client{Timeout: time.Second * 30}
 var newError = commons.NewTaggedError("Push")
 
@@ -86,6 +91,12 @@ func InitTelegram(filePath string) {
 	logger.Info("[Push] Initialized Telegram")
 }
 
+// InitOffline logs the messages instead of sending them to Telegram, i.e. while replaying
+func InitOffline() {
+	telegramOffline = true
+	logger.Info("[Push] Logging messages offline instead of Telegram")
+}
+
 func telegramAPI(method string) string {
 	if telegramToken == "" {
 		logger.Panic("[Push] Telegram client not initialized")
@@ -95,6 +106,10 @@ func telegramAPI(method string) string {
 }
 
 func requestTelegram(method string, body map[string]interface{}, onSuccess func(map[string]interface{}), onFailure func(error)) {
+	if telegramOffline {
+		logger.Info("[Push][Offline] %s: %v", method, body)
+		return
+	}
 	url := telegramAPI(method)
 	bodyBytes, err := json.Marshal(body)
 	if err != nil {
@@ -111,8 +126,61 @@ func requestTelegram(method string, body map[string]interface{}, onSuccess func(
 		}
 		return
 	}
+	handleTelegramResponse(resp, onSuccess, onFailure)
+}
 
+// requestTelegramFile uploads a local file with the fields, as multipart/form-data
+func requestTelegramFile(method string, fields map[string]string, fileField, filePath string, onSuccess func(map[string]interface{}), onFailure func(error)) {
+	if telegramOffline {
+		logger.Info("[Push][Offline] %s: %v %s", method, fields, filePath)
+		return
+	}
+	url := telegramAPI(method)
+	fail := func(err error) {
+		if onFailure != nil {
+			onFailure(err)
+		}
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		fail(err)
+		return
+	}
+	defer file.Close()
+
+	bodyBuffer := &bytes.Buffer{}
+	writer := multipart.NewWriter(bodyBuffer)
+	for k, v := range fields {
+		if err := writer.WriteField(k, v); err != nil {
+			fail(err)
+			return
+		}
+	}
+	part, err := writer.CreateFormFile(fileField, filepath.Base(filePath))
+	if err != nil {
+		fail(err)
+		return
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		fail(err)
+		return
+	}
+	if err := writer.Close(); err != nil {
+		fail(err)
+		return
+	}
+
+	resp, err := telegramClient.Post(url, writer.FormDataContentType(), bodyBuffer)
+	if err != nil {
+		fail(err)
+		return
+	}
+	handleTelegramResponse(resp, onSuccess, onFailure)
+}
+
+func handleTelegramResponse(resp *http.Response, onSuccess func(map[string]interface{}), onFailure func(error)) {
 	if onSuccess == nil {
+		resp.Body.Close()
 		return
 	}
 
@@ -230,6 +298,21 @@ func SendPhotoTelegram(id int64, caption, picURL string) {
 	requestTelegram("sendPhoto", body, onSuccess, onFailure)
 }
 
+// SendDocumentTelegram send local file to telegram as a document
+func SendDocumentTelegram(id int64, caption, filePath string) {
+	fields := map[string]string{
+		"chat_id": fmt.Sprintf("%d", id),
+		"caption": caption,
+	}
+	onSuccess := func(result map[string]interface{}) {
+		logger.Info("[Push] Sent document to: %d \n message: %s \n document: %s", id, caption, filePath)
+	}
+	onFailure := func(err error) {
+		logger.Error(newError(err.Error()).Error())
+	}
+	requestTelegramFile("sendDocument", fields, "document", filePath, onSuccess, onFailure)
+}
+
 // URLTelegramUpdate uri where telegram webhook comes
 func URLTelegramUpdate() string {
 	return fmt.Sprintf("/api/telegram/%s", GetTelegramTokenForURL())
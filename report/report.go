@@ -0,0 +1,287 @@
+package report
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/helloworldpark/tickle-stock-watcher/analyser"
+	"github.com/helloworldpark/tickle-stock-watcher/commons"
+	"github.com/helloworldpark/tickle-stock-watcher/database"
+	"github.com/helloworldpark/tickle-stock-watcher/logger"
+	"github.com/helloworldpark/tickle-stock-watcher/structs"
+	"github.com/helloworldpark/tickle-stock-watcher/watcher"
+	"github.com/jung-kurt/gofpdf"
+)
+
+const reportDirFormat = "tmpreport%04d%02d%02d/"
+const reportPathFormat = "weekly%d.pdf"
+const chartDays = 20
+const maxProspects = 5
+
+var newError = commons.NewTaggedError("Report")
+
+// fontPath TTF font which can write Hangul. Core font is used if empty.
+var fontPath = ""
+
+// SetFont sets the UTF-8 TTF font of the reports, needed for writing stock names
+func SetFont(path string) {
+	fontPath = path
+}
+
+// ProspectEntry is a prospect of the week with its chart drawn locally
+type ProspectEntry struct {
+	Prospect  analyser.Prospect
+	Stock     structs.Stock
+	ChartPath string // Empty if failed to draw
+}
+
+// Market is the part of the report common to every user
+type Market struct {
+	From, To  time.Time
+	Breadth   analyser.MarketBreadth
+	Prospects []ProspectEntry
+}
+
+// StrategyStatus is a strategy of the user and its distance to triggering
+type StrategyStatus struct {
+	Strategy structs.UserStock
+	Stock    structs.Stock
+	Gaps     []analyser.ConditionGap
+	Err      error
+}
+
+// Weekly is a weekly report of a user
+type Weekly struct {
+	User       structs.User
+	Market     Market
+	Strategies []StrategyStatus
+	Triggers   []structs.StrategyTrigger
+}
+
+func reportDir(date time.Time) string {
+	y, m, d := date.Date()
+	return fmt.Sprintf(reportDirFormat, y, m, d)
+}
+
+// CleanupOldReports rm -rf reports of the last week
+func CleanupOldReports() {
+	now := commons.Now()
+	for t := 7; t >= 1; t-- {
+		if err := os.RemoveAll(reportDir(now.AddDate(0, 0, -t))); err != nil {
+			logger.Error("[Report] CleanupOldReports: %+v", err)
+		}
+	}
+}
+
+// NewMarket collects the market breadth and the top prospects of the week ending at now
+func NewMarket(dbClient *database.DBClient, itemChecker *watcher.StockItemChecker, now time.Time) Market {
+	market := Market{From: now.AddDate(0, 0, -7), To: now}
+
+	breadth, err := analyser.MarketBreadthSince(dbClient, market.From.Unix())
+	if err != nil {
+		logger.Error("[Report] Error while calculating market breadth: %+v", err)
+	}
+	market.Breadth = breadth
+
+	prospects, err := analyser.ProspectsSince(dbClient, analyser.ProspectDate(market.From))
+	if err != nil {
+		logger.Error("[Report] Error while loading prospects: %+v", err)
+	}
+	if err := analyser.MkCandlePlotDir(); err != nil && !os.IsExist(err) {
+		logger.Error("[Report] Error while making directory for candleplot: %+v", err)
+	}
+	options := analyser.ProspectCandlePlotOptions
+	options.Tag = "_report"
+	for i := 0; i < len(prospects) && i < maxProspects; i++ {
+		entry := ProspectEntry{Prospect: prospects[i]}
+		entry.Stock, _ = itemChecker.StockFromID(prospects[i].StockID)
+		if didPlot, savePath := analyser.NewCandlePlot(dbClient, chartDays, prospects[i].StockID, itemChecker, options); didPlot {
+			entry.ChartPath = savePath
+		}
+		market.Prospects = append(market.Prospects, entry)
+	}
+	return market
+}
+
+// NewWeekly collects the strategies of the user and their triggers during the week of the market
+func NewWeekly(dbClient *database.DBClient, itemChecker *watcher.StockItemChecker, user structs.User, market Market) Weekly {
+	weekly := Weekly{User: user, Market: market}
+
+	var strategies []structs.UserStock
+	if _, err := dbClient.Select(&strategies, "where UserID=? order by OrderSide, StockID", user.UserID); err != nil {
+		logger.Error("[Report] Error while selecting strategies of %d: %+v", user.UserID, err)
+	}
+	for _, strategy := range strategies {
+		status := StrategyStatus{Strategy: strategy}
+		status.Stock, _ = itemChecker.StockFromID(strategy.StockID)
+		status.Gaps, status.Err = analyser.StrategyGaps(dbClient, strategy.StockID, strategy.Strategy)
+		weekly.Strategies = append(weekly.Strategies, status)
+	}
+	weekly.Triggers = structs.TriggersOfUserSince(dbClient, user.UserID, market.From.Unix())
+	return weekly
+}
+
+// Save writes the report as a PDF
+//               savePath string, full path
+func (w Weekly) Save() (string, error) {
+	dir := reportDir(w.Market.To)
+	if err := os.Mkdir(dir, 0755); err != nil && !os.IsExist(err) {
+		return "", err
+	}
+	savePath := dir + fmt.Sprintf(reportPathFormat, w.User.UserID)
+	if err := w.writePDF(savePath); err != nil {
+		return "", err
+	}
+
+	wd, _ := os.Getwd()
+	if wd[len(wd)-1] != '/' {
+		wd += "/"
+	}
+	return wd + savePath, nil
+}
+
+func (w Weekly) writePDF(savePath string) error {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	family := "Helvetica"
+	if len(fontPath) > 0 {
+		family = "report"
+		pdf.AddUTF8Font(family, "", fontPath)
+		pdf.AddUTF8Font(family, "B", fontPath)
+	}
+	pageWidth, _ := pdf.GetPageSize()
+	left, _, right, _ := pdf.GetMargins()
+	width := pageWidth - left - right
+
+	heading := func(text string) {
+		pdf.Ln(4)
+		pdf.SetFont(family, "B", 13)
+		pdf.CellFormat(width, 8, text, "B", 1, "L", false, 0, "")
+		pdf.Ln(2)
+		pdf.SetFont(family, "", 10)
+	}
+	line := func(format string, args ...interface{}) {
+		pdf.MultiCell(width, 5, fmt.Sprintf(format, args...), "", "L", false)
+	}
+
+	pdf.AddPage()
+	pdf.SetFont(family, "B", 18)
+	pdf.CellFormat(width, 10, "Weekly Report", "", 1, "L", false, 0, "")
+	pdf.SetFont(family, "", 10)
+	line("%s ~ %s", w.Market.From.Format("2006-01-02"), w.Market.To.Format("2006-01-02"))
+
+	// 시장
+	heading("Market Breadth")
+	breadth := w.Market.Breadth
+	total := breadth.Advancing + breadth.Declining + breadth.Unchanged
+	if total == 0 {
+		line("No prices collected this week")
+	} else {
+		line("Advancing %d, Declining %d, Unchanged %d", breadth.Advancing, breadth.Declining, breadth.Unchanged)
+		x, y := pdf.GetXY()
+		for _, bar := range []struct {
+			count   int
+			r, g, b int
+		}{
+			{breadth.Advancing, 200, 60, 60},
+			{breadth.Unchanged, 160, 160, 160},
+			{breadth.Declining, 60, 60, 200},
+		} {
+			barWidth := width * float64(bar.count) / float64(total)
+			pdf.SetFillColor(bar.r, bar.g, bar.b)
+			pdf.Rect(x, y+1, barWidth, 4, "F")
+			x += barWidth
+		}
+		pdf.Ln(7)
+	}
+
+	// 전략
+	heading("Strategies")
+	if len(w.Strategies) == 0 {
+		line("No strategies")
+	}
+	for _, status := range w.Strategies {
+		pdf.SetFont(family, "B", 10)
+		line("[%s] %s: %s", orderSideName(status.Strategy.OrderSide), w.stockName(status.Stock, status.Strategy.StockID), status.Strategy.Strategy)
+		pdf.SetFont(family, "", 10)
+		if status.Err != nil {
+			line("    Cannot measure: %s", status.Err.Error())
+			continue
+		}
+		for _, gap := range status.Gaps {
+			if gap.Satisfied {
+				line("    %s: %.2f vs %.2f, satisfied", gap.Condition, gap.Left, gap.Right)
+			} else if math.IsInf(gap.Gap, 0) {
+				line("    %s: %.2f vs %.2f", gap.Condition, gap.Left, gap.Right)
+			} else {
+				line("    %s: %.2f vs %.2f, %.2f%% to go", gap.Condition, gap.Left, gap.Right, gap.Gap)
+			}
+		}
+	}
+
+	// 이번 주에 발동된 전략
+	heading("Triggers")
+	if len(w.Triggers) == 0 {
+		line("No triggers this week")
+	}
+	for _, trigger := range w.Triggers {
+		line("%s [%s] %s at %d: %s",
+			commons.Unix(trigger.Timestamp).Format("2006-01-02 15:04"),
+			orderSideName(trigger.OrderSide),
+			trigger.StockID,
+			trigger.Price,
+			trigger.Strategy)
+	}
+
+	// 유망주
+	heading("Top Prospects")
+	if len(w.Market.Prospects) == 0 {
+		line("No prospects this week")
+	}
+	for i, entry := range w.Market.Prospects {
+		pdf.SetFont(family, "B", 10)
+		line("%d. %s: %.1f", i+1, w.stockName(entry.Stock, entry.Prospect.StockID), entry.Prospect.Score)
+		pdf.SetFont(family, "", 10)
+		for _, reason := range entry.Prospect.Reasons {
+			// 이유는 한글로 기록되므로 글꼴이 있을 때만 쓴다
+			if len(fontPath) > 0 {
+				line("    - %s", reason)
+			}
+		}
+		if len(entry.ChartPath) > 0 {
+			imageWidth := width * 0.8
+			options := gofpdf.ImageOptions{ImageType: "PNG", ReadDpi: true}
+			info := pdf.RegisterImageOptions(entry.ChartPath, options)
+			if info == nil {
+				continue
+			}
+			imageHeight := imageWidth * info.Height() / info.Width()
+			_, pageHeight := pdf.GetPageSize()
+			_, _, _, bottom := pdf.GetMargins()
+			if pdf.GetY()+imageHeight > pageHeight-bottom {
+				pdf.AddPage()
+			}
+			pdf.ImageOptions(entry.ChartPath, left, pdf.GetY(), imageWidth, imageHeight, true, options, 0, "")
+		}
+	}
+
+	if pdf.Err() {
+		return newError(pdf.Error().Error())
+	}
+	return pdf.OutputFileAndClose(savePath)
+}
+
+func (w Weekly) stockName(stock structs.Stock, stockID string) string {
+	if len(fontPath) > 0 && len(stock.Name) > 0 {
+		return fmt.Sprintf("%s(%s)", stock.Name, stockID)
+	}
+	return stockID
+}
+
+func orderSideName(orderSide int) string {
+	if orderSide == commons.BUY {
+		return "BUY"
+	}
+	return "SELL"
+}
@@ -0,0 +1,48 @@
+package report
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/helloworldpark/tickle-stock-watcher/analyser"
+	"github.com/helloworldpark/tickle-stock-watcher/commons"
+	"github.com/helloworldpark/tickle-stock-watcher/structs"
+)
+
+func TestWeeklySave(t *testing.T) {
+	now := time.Date(2020, time.February, 1, 10, 0, 0, 0, commons.AsiaSeoul)
+	weekly := Weekly{
+		User: structs.User{UserID: 1},
+		Market: Market{
+			From:    now.AddDate(0, 0, -7),
+			To:      now,
+			Breadth: analyser.MarketBreadth{Advancing: 10, Declining: 5, Unchanged: 1},
+			Prospects: []ProspectEntry{
+				{Prospect: analyser.Prospect{StockID: "005930", Score: 80}},
+			},
+		},
+		Strategies: []StrategyStatus{
+			{
+				Strategy: structs.UserStock{UserID: 1, StockID: "005930", Strategy: "close() > 1000", OrderSide: commons.BUY},
+				Gaps:     []analyser.ConditionGap{{Condition: "close() > 1000", Left: 900, Right: 1000, Gap: 11.1}},
+			},
+		},
+		Triggers: []structs.StrategyTrigger{
+			{UserID: 1, StockID: "000660", Strategy: "close() < 500", OrderSide: commons.SELL, Price: 490, Timestamp: now.Unix()},
+		},
+	}
+	defer os.RemoveAll(reportDir(now))
+
+	savePath, err := weekly.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(savePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() == 0 {
+		t.Error("Empty report")
+	}
+}
@@ -149,6 +149,17 @@ func ScheduleWeekdays(tag string, startHour float64, todo func()) {
 	})
 }
 
+// ScheduleWeekly runs a task every week on a given weekday at a given hour.
+func ScheduleWeekly(tag string, weekday time.Weekday, startHour float64, todo func()) {
+	_, timeLeft := startingDate(startHour)
+	SchedulePeriodic(tag, 24*time.Hour, time.Duration(timeLeft), func() {
+		if commons.Now().Weekday() != weekday {
+			return
+		}
+		todo()
+	})
+}
+
 func startingDate(startHour float64) (time.Time, int64) {
 	now := commons.Now()
 	var refDate time.Time
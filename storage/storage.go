@@ -8,12 +8,14 @@ import (
 	"strings"
 
 	"cloud.google.com/go/storage"
+	"github.com/helloworldpark/tickle-stock-watcher/commons"
 	"github.com/helloworldpark/tickle-stock-watcher/logger"
 	"google.golang.org/api/iterator"
 )
 
 var client *storage.Client
 var bucket *storage.BucketHandle
+var newError = commons.NewTaggedError("Storage")
 
 // ObjectAttrs alias of storage.ObjectAttrs
 type ObjectAttrs storage.ObjectAttrs
@@ -79,7 +81,11 @@ func FilesInDirectory(dirname string) []storage.ObjectAttrs {
 }
 
 // Write writes []byte to filename in GCS
+// Fails if not initialized, i.e. while replaying offline
 func Write(contents []byte, filename string) (string, error) {
+	if bucket == nil {
+		return "", newError("Storage not initialized")
+	}
 	ctx := context.Background()
 	filePath := "tickle-stock-watcher/" + filename
 	writer := bucket.Object(filePath).NewWriter(ctx)
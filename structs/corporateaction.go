@@ -0,0 +1,30 @@
+package structs
+
+import "github.com/helloworldpark/tickle-stock-watcher/database"
+
+// Kinds of CorporateAction
+const (
+	// ActionSplit Value: shares after the split per share, i.e. 50 for 1:50, 0.2 for a 5:1 reverse split
+	ActionSplit = "split"
+	// ActionDividend Value: cash dividend per share in won
+	ActionDividend = "dividend"
+	// ActionDetected Value: ratio of the base price on the ex-date to the previous close, detected from the prices
+	ActionDetected = "detected"
+)
+
+// CorporateAction is an event which makes prices before Timestamp(the ex-date) incomparable with prices after it
+type CorporateAction struct {
+	StockID   string
+	Timestamp int64
+	Kind      string
+	Value     float64
+}
+
+// GetDBRegisterForm is just an implementation
+func (s CorporateAction) GetDBRegisterForm() database.DBRegisterForm {
+	form := database.DBRegisterForm{
+		BaseStruct:    CorporateAction{},
+		UniqueColumns: []string{"StockID", "Timestamp", "Kind"},
+	}
+	return form
+}
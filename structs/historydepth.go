@@ -0,0 +1,24 @@
+package structs
+
+import "github.com/helloworldpark/tickle-stock-watcher/database"
+
+// FullHistory years of HistoryDepth for collecting every price since the listing date
+const FullHistory = -1
+
+// HistoryDepthOfAll Stock ID of the HistoryDepth for every stock without its own depth
+const HistoryDepthOfAll = "*"
+
+// HistoryDepth is how many years of daily prices to collect for the stock
+type HistoryDepth struct {
+	StockID string
+	Years   int // FullHistory for every price since the listing date
+}
+
+// GetDBRegisterForm is just an implementation
+func (s HistoryDepth) GetDBRegisterForm() database.DBRegisterForm {
+	form := database.DBRegisterForm{
+		BaseStruct: HistoryDepth{},
+		KeyColumns: []string{"StockID"},
+	}
+	return form
+}
@@ -0,0 +1,30 @@
+package structs
+
+import "github.com/helloworldpark/tickle-stock-watcher/database"
+
+// IntradayPrice is a quote of the stock polled during the market hours
+type IntradayPrice struct {
+	StockID   string
+	Timestamp int64
+	Price     int
+	Volume    float64 // Accumulated volume of the day
+}
+
+// GetDBRegisterForm is just an implementation
+func (s IntradayPrice) GetDBRegisterForm() database.DBRegisterForm {
+	form := database.DBRegisterForm{
+		BaseStruct:    IntradayPrice{},
+		UniqueColumns: []string{"StockID", "Timestamp"},
+	}
+	return form
+}
+
+// NewIntradayPrice intraday price from a polled quote
+func NewIntradayPrice(quote StockPrice) IntradayPrice {
+	return IntradayPrice{
+		StockID:   quote.StockID,
+		Timestamp: quote.Timestamp,
+		Price:     quote.Close,
+		Volume:    quote.Volume,
+	}
+}
@@ -0,0 +1,25 @@
+package structs
+
+import "github.com/helloworldpark/tickle-stock-watcher/database"
+
+// NoProspect Stock ID of the Prospect marking a day on which no prospect was found
+const NoProspect = "-"
+
+// Prospect is a struct recording a stock found by the scouter on a day
+type Prospect struct {
+	Date     string // yyyy-mm-dd, Asia/Seoul
+	StockID  string
+	Criteria string
+	Score    float64
+	Reasons  string // Separated by new line
+	ChartURL string
+}
+
+// GetDBRegisterForm is just an implementation
+func (s Prospect) GetDBRegisterForm() database.DBRegisterForm {
+	form := database.DBRegisterForm{
+		BaseStruct:    Prospect{},
+		UniqueColumns: []string{"Date", "StockID", "Criteria"},
+	}
+	return form
+}
@@ -0,0 +1,40 @@
+package structs
+
+import "github.com/helloworldpark/tickle-stock-watcher/database"
+
+// QuarantinedPrice is a collected daily price rejected by validation, kept for inspection instead of StockPrice
+type QuarantinedPrice struct {
+	StockID       string
+	Timestamp     int64
+	Open          int
+	Close         int
+	High          int
+	Low           int
+	Volume        float64
+	Reason        string
+	QuarantinedAt int64
+}
+
+// GetDBRegisterForm is just an implementation
+func (s QuarantinedPrice) GetDBRegisterForm() database.DBRegisterForm {
+	form := database.DBRegisterForm{
+		BaseStruct:    QuarantinedPrice{},
+		UniqueColumns: []string{"StockID", "Timestamp"},
+	}
+	return form
+}
+
+// NewQuarantinedPrice quarantines the price with the reason
+func NewQuarantinedPrice(price StockPrice, reason string, timestamp int64) QuarantinedPrice {
+	return QuarantinedPrice{
+		StockID:       price.StockID,
+		Timestamp:     price.Timestamp,
+		Open:          price.Open,
+		Close:         price.Close,
+		High:          price.High,
+		Low:           price.Low,
+		Volume:        price.Volume,
+		Reason:        reason,
+		QuarantinedAt: timestamp,
+	}
+}
@@ -1,6 +1,10 @@
 package structs
 
-import "github.com/helloworldpark/tickle-stock-watcher/database"
+import (
+	"strings"
+
+	"github.com/helloworldpark/tickle-stock-watcher/database"
+)
 
 // Market is an enum type representing the type of the stock market
 type Market string
@@ -10,13 +14,115 @@ const (
 	KOSPI = "kospi"
 	// KOSDAQ market
 	KOSDAQ = "kosdaq"
+	// KONEX market
+	KONEX = "konex"
+	// INDEX market indices, not tradable but watched like stocks
+	INDEX = "index"
+)
+
+// Instrument is an enum type representing the type of the listed instrument
+type Instrument string
+
+const (
+	// InstrumentStock common shares
+	InstrumentStock = "stock"
+	// InstrumentPreferred preferred shares
+	InstrumentPreferred = "preferred"
+	// InstrumentETF exchange traded funds
+	InstrumentETF = "etf"
+	// InstrumentETN exchange traded notes
+	InstrumentETN = "etn"
+	// InstrumentIndex market indices
+	InstrumentIndex = "index"
 )
 
+// IsInstrument checks if the name is of an instrument type, i.e. etf
+func IsInstrument(name string) bool {
+	switch name {
+	case InstrumentStock, InstrumentPreferred, InstrumentETF, InstrumentETN, InstrumentIndex:
+		return true
+	}
+	return false
+}
+
+// Stock IDs of the market indices, the same as the symbols of finance.naver.com
+const (
+	IndexKOSPI    = "KOSPI"
+	IndexKOSDAQ   = "KOSDAQ"
+	IndexKOSPI200 = "KPI200"
+)
+
+// IndexPriceScale prices of indices are stored in hundredths of a point
+const IndexPriceScale = 100
+
+// Indices market indices tracked as stocks of the INDEX market
+// Prices of indices are stored scaled by IndexPriceScale.
+var Indices = []Stock{
+	{Name: "코스피", StockID: IndexKOSPI, MarketType: INDEX, Instrument: InstrumentIndex},
+	{Name: "코스닥", StockID: IndexKOSDAQ, MarketType: INDEX, Instrument: InstrumentIndex},
+	{Name: "코스피200", StockID: IndexKOSPI200, MarketType: INDEX, Instrument: InstrumentIndex},
+}
+
+// indexAliases Key: name of an index used in orders and strategies, Value: Stock ID
+var indexAliases = map[string]string{
+	"kospi":    IndexKOSPI,
+	"kosdaq":   IndexKOSDAQ,
+	"kospi200": IndexKOSPI200,
+	"kpi200":   IndexKOSPI200,
+	"코스피":      IndexKOSPI,
+	"코스닥":      IndexKOSDAQ,
+	"코스피200":   IndexKOSPI200,
+}
+
+// IsIndex checks if the stock ID is of a market index
+func IsIndex(stockID string) bool {
+	for _, index := range Indices {
+		if index.StockID == stockID {
+			return true
+		}
+	}
+	return false
+}
+
+// PriceScale how many times the stored prices of the stock are scaled, IndexPriceScale for indices
+func PriceScale(stockID string) float64 {
+	if IsIndex(stockID) {
+		return IndexPriceScale
+	}
+	return 1
+}
+
+// IndexFromName finds the stock ID of the market index by its name, i.e. kospi
+func IndexFromName(name string) (string, bool) {
+	stockID, ok := indexAliases[strings.ToLower(strings.TrimSpace(name))]
+	return stockID, ok
+}
+
 // Stock is a struct describing each stock item
 type Stock struct {
-	Name       string
-	StockID    string
-	MarketType Market
+	Name        string
+	StockID     string
+	MarketType  Market
+	Instrument  Instrument
+	Sector      string // 업종 of KRX, i.e. 전기전자
+	Industry    string // 업종 of KIND, i.e. 반도체 제조업
+	Products    string // 주요제품
+	ListingDate int64  // Timestamp of the listing date, 0 if unknown
+	Shares      int64  // Number of the listed shares, 0 if unknown
+}
+
+// InSector checks if the stock belongs to the sector, either by its sector or its industry.
+// Case and spaces are ignored, and every stock is in an empty sector.
+func (s Stock) InSector(sector string) bool {
+	sector = normalizeSector(sector)
+	if len(sector) == 0 {
+		return true
+	}
+	return strings.Contains(normalizeSector(s.Sector), sector) || strings.Contains(normalizeSector(s.Industry), sector)
+}
+
+func normalizeSector(sector string) string {
+	return strings.ToLower(strings.ReplaceAll(sector, " ", ""))
 }
 
 // GetDBRegisterForm is just an implementation
@@ -11,6 +11,7 @@ type StockPrice struct {
 	High      int
 	Low       int
 	Volume    float64
+	Change    int `db:"-"` // Change from the previous close, only for live quotes
 }
 
 // GetDBRegisterForm is just an implementation
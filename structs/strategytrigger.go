@@ -0,0 +1,35 @@
+package structs
+
+import (
+	"github.com/helloworldpark/tickle-stock-watcher/database"
+	"github.com/helloworldpark/tickle-stock-watcher/logger"
+)
+
+// StrategyTrigger is a struct recording a user's strategy fulfilled by the price
+type StrategyTrigger struct {
+	UserID    int64
+	StockID   string
+	Strategy  string
+	OrderSide int
+	Price     int
+	Timestamp int64
+}
+
+// GetDBRegisterForm is just an implementation
+func (s StrategyTrigger) GetDBRegisterForm() database.DBRegisterForm {
+	form := database.DBRegisterForm{
+		BaseStruct:    StrategyTrigger{},
+		UniqueColumns: []string{"UserID", "StockID", "OrderSide", "Timestamp"},
+	}
+	return form
+}
+
+// TriggersOfUserSince returns the triggers of the user since timestamp, ordered by time
+func TriggersOfUserSince(client *database.DBClient, userID int64, timestamp int64) []StrategyTrigger {
+	var triggers []StrategyTrigger
+	_, err := client.Select(&triggers, "where UserID=? and Timestamp>=? order by Timestamp", userID, timestamp)
+	if err != nil {
+		logger.Error("[Structs] Error while selecting strategy triggers: %s", err.Error())
+	}
+	return triggers
+}
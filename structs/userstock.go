@@ -10,6 +10,7 @@ type UserStock struct {
 	Strategy  string
 	OrderSide int
 	Repeat    bool `db:"RepeatStrategy"`
+	Suspended bool // Kept while the stock is not listed, i.e. delisted or halted
 }
 
 // GetDBRegisterForm is just an implementation
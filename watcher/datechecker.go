@@ -4,11 +4,10 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"net/http"
 	"net/url"
 	"sort"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/helloworldpark/tickle-stock-watcher/commons"
@@ -18,18 +17,35 @@ import (
 // DateChecker is a struct holding holidays as a map
 type DateChecker struct {
 	holidays map[int64]bool
+	years    map[int]bool // Years whose holidays are updated
+	mutex    sync.RWMutex // Backfill updates the years while the scheduler checks holidays
+	offline  bool         // Never downloads holidays, so that only weekends are holidays
 }
 
+// holidayDownloader downloads the holidays of a year, replaced in tests
+var holidayDownloader = downloadHolidays
+
 // NewDateChecker returns a new DateChecker with holidays unfilled.
 // Holidays are updated
 func NewDateChecker() *DateChecker {
 	checker := DateChecker{
 		holidays: make(map[int64]bool),
+		years:    make(map[int]bool),
 	}
 	checker.UpdateHolidays(commons.Now().Year())
 	return &checker
 }
 
+// NewOfflineDateChecker returns a new DateChecker which never downloads holidays, i.e. while replaying.
+// Only weekends are holidays.
+func NewOfflineDateChecker() *DateChecker {
+	return &DateChecker{
+		holidays: make(map[int64]bool),
+		years:    make(map[int]bool),
+		offline:  true,
+	}
+}
+
 // Year returns the current year.
 func (c *DateChecker) Year() int {
 	return commons.Now().Year()
@@ -44,41 +60,67 @@ func (c *DateChecker) IsHoliday(day time.Time) bool {
 	// 공휴일 체크
 	y, m, d := day.Date()
 	zeroDay := time.Date(y, m, d, 0, 0, 0, 0, commons.AsiaSeoul)
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
 	_, ok := c.holidays[zeroDay.Unix()]
 	return ok
 }
 
 // UpdateHolidays updates the holidays of the given year.
 func (c *DateChecker) UpdateHolidays(year int) {
-	holidays := downloadHolidays(year)
+	if c.offline {
+		return
+	}
+	holidays, err := holidayDownloader(year)
+	if err != nil {
+		logger.Error("[Watcher] Error while downloading holidays: %s", err.Error())
+		return
+	}
 	if len(holidays) == 0 {
 		return
 	}
+	c.mutex.Lock()
 	for _, v := range holidays {
 		c.holidays[v] = true
 	}
+	c.years[year] = true
+	c.mutex.Unlock()
 	logger.Info("[Watcher] Updated holidays")
 }
 
-func downloadHolidays(year int) []int64 {
-	u := "http://marketdata.krx.co.kr/contents/COM/GenerateOTP.jspx?bld=MKD%2F01%2F0110%2F01100305%2Fmkd01100305_01&name=form&_="
-	u += strconv.FormatInt(commons.Now().UnixNano()/1000000, 10)
+// PrepareYears updates the holidays of the years between from and to, if not updated yet.
+func (c *DateChecker) PrepareYears(from, to time.Time) {
+	for year := from.Year(); year <= to.Year(); year++ {
+		c.mutex.RLock()
+		updated := c.years[year]
+		c.mutex.RUnlock()
+		if !updated {
+			c.UpdateHolidays(year)
+		}
+	}
+}
 
-	resOTP, err := http.Get(u)
-	if err != nil {
-		logger.Error("[Watcher] Error while getting OTP code for holiday checking: %s", err.Error())
-		return nil
+// TradingDays trading days from the day of from until the day of to, at midnight
+func (c *DateChecker) TradingDays(from, to time.Time) []time.Time {
+	var days []time.Time
+	y, m, d := from.In(commons.AsiaSeoul).Date()
+	for day := time.Date(y, m, d, 0, 0, 0, 0, commons.AsiaSeoul); !day.After(to); day = day.AddDate(0, 0, 1) {
+		if !c.IsHoliday(day) {
+			days = append(days, day)
+		}
 	}
+	return days
+}
+
+func downloadHolidays(year int) ([]int64, error) {
+	u := "http://marketdata.krx.co.kr/contents/COM/GenerateOTP.jspx?bld=MKD%2F01%2F0110%2F01100305%2Fmkd01100305_01&name=form&_="
+	u += strconv.FormatInt(commons.Now().UnixNano()/1000000, 10)
 
-	defer resOTP.Body.Close()
-	byteOTP, err := ioutil.ReadAll(resOTP.Body)
+	otp, err := defaultFetcher.get(u)
 	if err != nil {
-		logger.Error("[Watcher] Error while reading OTP code for holiday checking: %s", err.Error())
-		return nil
+		return nil, err
 	}
 
-	otp := string(byteOTP)
-
 	formData := url.Values{
 		"code":          {otp},
 		"search_bas_yy": {strconv.FormatInt(int64(year), 10)},
@@ -86,30 +128,33 @@ func downloadHolidays(year int) []int64 {
 		"pagePath":      {"/contents/MKD/01/0110/01100305/MKD01100305.jsp"},
 		"pageFirstCall": {"Y"},
 	}
-	respHoliday, err := http.PostForm("http://marketdata.krx.co.kr/contents/MKD/99/MKD99000001.jspx", formData)
+	holidayURL := "http://marketdata.krx.co.kr/contents/MKD/99/MKD99000001.jspx"
+	byteHoliday, err := defaultFetcher.postForm(holidayURL, formData)
 	if err != nil {
-		logger.Error("[Watcher] Error while requesting holidays: %s", err.Error())
-		return nil
+		return nil, err
 	}
+	result, err := parseHolidays(byteHoliday)
+	return result, withURL(err, holidayURL)
+}
 
-	defer respHoliday.Body.Close()
-	byteHoliday, err := ioutil.ReadAll(respHoliday.Body)
-	if err != nil {
-		logger.Error("[Watcher] Error while reading holiday bytes: %s", err.Error())
-		return nil
-	}
-
-	var downloaded map[string]interface{}
-	json.Unmarshal(byteHoliday, &downloaded)
-	holidays := downloaded["block1"].([]interface{})
-	result := make([]int64, len(holidays))
-	for i, v := range holidays {
-		h := v.(map[string]interface{})
-		dateString := (h["calnd_dd"]).(string)
-		dateTimestamp := commons.GetTimestamp("2006-01-02", dateString)
+func parseHolidays(raw []byte) ([]int64, error) {
+	var downloaded struct {
+		Block1 []struct {
+			Date string `json:"calnd_dd"`
+		} `json:"block1"`
+	}
+	if err := json.Unmarshal(raw, &downloaded); err != nil {
+		return nil, newParseError("Invalid holidays: %v", err)
+	}
+	result := make([]int64, len(downloaded.Block1))
+	for i, v := range downloaded.Block1 {
+		dateTimestamp, err := commons.ParseTimestamp("2006-01-02", v.Date)
+		if err != nil {
+			return nil, newParseError("Invalid holiday: %v", err)
+		}
 		result[i] = dateTimestamp
 	}
-	return result
+	return result, nil
 }
 
 func (d *DateChecker) Description() string {
@@ -137,12 +182,14 @@ func (d *DateChecker) Description() string {
 	addLine("List")
 	i := 1
 	var holidayTimestamp []int64
+	d.mutex.RLock()
 	for timestamp := range d.holidays {
 		if timestamp < currentYear {
 			continue
 		}
 		holidayTimestamp = append(holidayTimestamp, timestamp)
 	}
+	d.mutex.RUnlock()
 	sort.Slice(holidayTimestamp, func(i, j int) bool {
 		return holidayTimestamp[i] < holidayTimestamp[j]
 	})
@@ -2,6 +2,7 @@ package watcher
 
 import (
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -33,3 +34,49 @@ func TestDateChecker(t *testing.T) {
 	holiday = commons.Now()
 	fmt.Printf("Is %v Holiday: %v\n", holiday, checker.IsHoliday(holiday))
 }
+
+func TestDateCheckerConcurrentYears(t *testing.T) {
+	downloader := holidayDownloader
+	defer func() { holidayDownloader = downloader }()
+	holidayDownloader = func(year int) ([]int64, error) {
+		return []int64{time.Date(year, 1, 1, 0, 0, 0, 0, commons.AsiaSeoul).Unix()}, nil
+	}
+
+	// 백필이 연도를 준비하는 동안 스케줄러가 휴일을 확인한다
+	checker := &DateChecker{holidays: make(map[int64]bool), years: make(map[int]bool)}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for year := 1990; year < 2020; year++ {
+			checker.PrepareYears(time.Date(year, 1, 1, 0, 0, 0, 0, commons.AsiaSeoul), time.Date(year, 12, 31, 0, 0, 0, 0, commons.AsiaSeoul))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			checker.IsHoliday(time.Date(2000+i%20, 1, 1, 0, 0, 0, 0, commons.AsiaSeoul))
+		}
+	}()
+	wg.Wait()
+
+	if !checker.IsHoliday(time.Date(2019, 1, 1, 0, 0, 0, 0, commons.AsiaSeoul)) || len(checker.TradingDays(time.Date(2019, 1, 1, 0, 0, 0, 0, commons.AsiaSeoul), time.Date(2019, 1, 4, 0, 0, 0, 0, commons.AsiaSeoul))) != 3 {
+		t.Errorf("Expected the prepared holidays")
+	}
+}
+
+func TestOfflineDateChecker(t *testing.T) {
+	downloader := holidayDownloader
+	defer func() { holidayDownloader = downloader }()
+	holidayDownloader = func(year int) ([]int64, error) {
+		t.Errorf("Downloaded holidays of %d offline", year)
+		return nil, nil
+	}
+
+	// 재생 중에는 주말만 쉰다
+	checker := NewOfflineDateChecker()
+	checker.PrepareYears(time.Date(2019, 1, 1, 0, 0, 0, 0, commons.AsiaSeoul), time.Date(2020, 1, 1, 0, 0, 0, 0, commons.AsiaSeoul))
+	if checker.IsHoliday(time.Date(2020, 1, 1, 0, 0, 0, 0, commons.AsiaSeoul)) || !checker.IsHoliday(time.Date(2020, 1, 4, 0, 0, 0, 0, commons.AsiaSeoul)) {
+		t.Errorf("Expected only weekends to be holidays")
+	}
+}
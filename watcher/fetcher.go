@@ -0,0 +1,230 @@
+package watcher
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/helloworldpark/tickle-stock-watcher/logger"
+)
+
+// ScrapeErrorKind is the kind of a scraping failure
+type ScrapeErrorKind int
+
+const (
+	// ScrapeNetwork request failed or timed out
+	ScrapeNetwork ScrapeErrorKind = iota
+	// ScrapeStatus server responded with a non 2xx status
+	ScrapeStatus
+	// ScrapeParse response could not be parsed, i.e. the page has changed
+	ScrapeParse
+	// ScrapeCircuitOpen request was not sent since the host has been failing
+	ScrapeCircuitOpen
+)
+
+var scrapeErrorKindNames = map[ScrapeErrorKind]string{
+	ScrapeNetwork:     "network",
+	ScrapeStatus:      "status",
+	ScrapeParse:       "parse",
+	ScrapeCircuitOpen: "circuit open",
+}
+
+// ScrapeError is an error from scraping
+type ScrapeError struct {
+	Kind       ScrapeErrorKind
+	URL        string
+	StatusCode int // Only for ScrapeStatus
+	Err        error
+}
+
+func (e *ScrapeError) Error() string {
+	msg := fmt.Sprintf("[Watcher][Scrape][%s]", scrapeErrorKindNames[e.Kind])
+	if len(e.URL) > 0 {
+		msg += " " + e.URL
+	}
+	if e.StatusCode != 0 {
+		msg += fmt.Sprintf(" %d", e.StatusCode)
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Temporary tells if retrying may succeed
+func (e *ScrapeError) Temporary() bool {
+	switch e.Kind {
+	case ScrapeNetwork:
+		return true
+	case ScrapeStatus:
+		return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+func newParseError(format string, args ...interface{}) error {
+	return &ScrapeError{Kind: ScrapeParse, Err: fmt.Errorf(format, args...)}
+}
+
+// withURL fills the URL of the scraping error
+func withURL(err error, u string) error {
+	if scrapeErr, ok := err.(*ScrapeError); ok && len(scrapeErr.URL) == 0 {
+		scrapeErr.URL = u
+	}
+	return err
+}
+
+// circuitBreaker stops requesting a host for a while after consecutive failures
+type circuitBreaker struct {
+	failures  int
+	openUntil time.Time
+}
+
+// fetcher requests pages, retrying temporary failures with exponential backoff and jitter.
+// Each host has its own circuit breaker, and requests to a host are spaced by the rate limiter.
+type fetcher struct {
+	client      *http.Client
+	maxRetries  int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	maxFailures int           // Consecutive failures opening the circuit
+	cooldown    time.Duration // How long the circuit stays open
+	breakers    map[string]*circuitBreaker
+	limiter     *rateLimiter
+	now         func() time.Time
+	sleep       func(time.Duration)
+	mutex       *sync.Mutex
+}
+
+func newFetcher(timeout time.Duration) *fetcher {
+	return &fetcher{
+		client:      &http.Client{Timeout: timeout},
+		maxRetries:  3,
+		baseDelay:   500 * time.Millisecond,
+		maxDelay:    8 * time.Second,
+		maxFailures: 5,
+		cooldown:    time.Minute,
+		breakers:    make(map[string]*circuitBreaker),
+		limiter:     newRateLimiter(defaultRequestsPerSecond),
+		now:         time.Now,
+		sleep:       time.Sleep,
+		mutex:       &sync.Mutex{},
+	}
+}
+
+// defaultFetcher fetcher shared by every scraper, so that failures and requests of a host are counted together
+var defaultFetcher = newFetcher(5 * time.Second)
+
+// get requests the page of the URL
+func (f *fetcher) get(u string) (string, error) {
+	body, err := f.do(u, func() (*http.Response, error) {
+		return f.client.Get(u)
+	})
+	return string(body), err
+}
+
+// postForm posts the form to the URL
+func (f *fetcher) postForm(u string, data url.Values) ([]byte, error) {
+	return f.do(u, func() (*http.Response, error) {
+		return f.client.PostForm(u, data)
+	})
+}
+
+func (f *fetcher) do(u string, request func() (*http.Response, error)) ([]byte, error) {
+	host := u
+	if parsed, err := url.Parse(u); err == nil {
+		host = parsed.Host
+	}
+
+	var lastErr error
+	attempts := 0
+	for attempt := 0; attempt <= f.maxRetries; attempt++ {
+		if attempt > 0 {
+			f.sleep(f.backoff(attempt))
+		}
+		if !f.allow(host) {
+			return nil, &ScrapeError{Kind: ScrapeCircuitOpen, URL: u, Err: lastErr}
+		}
+		f.limiter.wait(host)
+		body, err := f.attempt(u, request)
+		attempts++
+		f.record(host, err)
+		if err == nil {
+			return body, nil
+		}
+		lastErr = err
+		if scrapeErr, ok := err.(*ScrapeError); ok && !scrapeErr.Temporary() {
+			break
+		}
+		if attempt < f.maxRetries {
+			logger.Warn("[Watcher] Retrying(%d/%d): %s", attempt+1, f.maxRetries, err.Error())
+		}
+	}
+	logger.Warn("[Watcher] Giving up after %d attempts: %s", attempts, lastErr.Error())
+	return nil, lastErr
+}
+
+func (f *fetcher) attempt(u string, request func() (*http.Response, error)) ([]byte, error) {
+	response, err := request()
+	if err != nil {
+		return nil, &ScrapeError{Kind: ScrapeNetwork, URL: u, Err: err}
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		io.Copy(ioutil.Discard, response.Body)
+		return nil, &ScrapeError{Kind: ScrapeStatus, URL: u, StatusCode: response.StatusCode}
+	}
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, &ScrapeError{Kind: ScrapeNetwork, URL: u, Err: err}
+	}
+	return body, nil
+}
+
+// backoff exponential delay of the attempt, randomised between its half and itself
+func (f *fetcher) backoff(attempt int) time.Duration {
+	delay := f.baseDelay << uint(attempt-1)
+	if delay <= 0 || delay > f.maxDelay {
+		delay = f.maxDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// allow tells if the host can be requested, letting a trial through after the cooldown
+func (f *fetcher) allow(host string) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	breaker, ok := f.breakers[host]
+	if !ok {
+		return true
+	}
+	return !f.now().Before(breaker.openUntil)
+}
+
+func (f *fetcher) record(host string, err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	breaker, ok := f.breakers[host]
+	if !ok {
+		breaker = &circuitBreaker{}
+		f.breakers[host] = breaker
+	}
+	if err == nil {
+		breaker.failures = 0
+		breaker.openUntil = time.Time{}
+		return
+	}
+	if scrapeErr, ok := err.(*ScrapeError); ok && !scrapeErr.Temporary() {
+		return
+	}
+	breaker.failures++
+	if breaker.failures >= f.maxFailures {
+		breaker.openUntil = f.now().Add(f.cooldown)
+		logger.Error("[Watcher] Circuit open for %s until %v: %s", host, breaker.openUntil, err.Error())
+	}
+}
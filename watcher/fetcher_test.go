@@ -0,0 +1,110 @@
+package watcher
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestFetcher() *fetcher {
+	f := newFetcher(time.Second)
+	f.sleep = func(time.Duration) {}
+	f.limiter = newRateLimiter(0)
+	return f
+}
+
+func TestFetcherRetriesServerErrors(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	body, err := newTestFetcher().get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "ok" || requests != 3 {
+		t.Fatalf("Expected ok after 3 requests, got %q after %d", body, requests)
+	}
+}
+
+func TestFetcherDoesNotRetryClientErrors(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	_, err := newTestFetcher().get(server.URL)
+	scrapeErr, ok := err.(*ScrapeError)
+	if !ok || scrapeErr.Kind != ScrapeStatus || scrapeErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("Expected status error 404, got %v", err)
+	}
+	if requests != 1 {
+		t.Fatalf("Expected 1 request, got %d", requests)
+	}
+}
+
+func TestFetcherCircuitBreaker(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	now := time.Date(2020, 1, 2, 9, 0, 0, 0, time.UTC)
+	f := newTestFetcher()
+	f.now = func() time.Time { return now }
+
+	// 4번 시도 후 실패, 다음 요청에서 회로가 열린다
+	if _, err := f.get(server.URL + "/fail"); err == nil {
+		t.Fatal("Expected error")
+	}
+	_, err := f.get(server.URL + "/fail")
+	if scrapeErr, ok := err.(*ScrapeError); !ok || scrapeErr.Kind != ScrapeCircuitOpen {
+		t.Fatalf("Expected circuit open, got %v", err)
+	}
+	if requests != f.maxFailures {
+		t.Fatalf("Expected %d requests, got %d", f.maxFailures, requests)
+	}
+
+	// 열려 있는 동안은 다른 경로도 요청하지 않는다
+	if _, err := f.get(server.URL + "/ok"); err == nil {
+		t.Fatal("Expected circuit open")
+	}
+	if requests != f.maxFailures {
+		t.Fatalf("Expected no requests while open, got %d", requests-f.maxFailures)
+	}
+
+	// 쿨다운이 지나면 다시 요청하고, 성공하면 닫힌다
+	now = now.Add(f.cooldown)
+	body, err := f.get(server.URL + "/ok")
+	if err != nil || body != "ok" {
+		t.Fatalf("Expected ok after cooldown, got %q, %v", body, err)
+	}
+	if _, err := f.get(server.URL + "/ok"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseErrorIsNotTemporary(t *testing.T) {
+	_, err := parseNaverQuote("005930", "<html></html>", 0)
+	scrapeErr, ok := err.(*ScrapeError)
+	if !ok || scrapeErr.Kind != ScrapeParse || scrapeErr.Temporary() {
+		t.Fatalf("Expected parse error, got %v", err)
+	}
+}
@@ -0,0 +1,232 @@
+package watcher
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/helloworldpark/tickle-stock-watcher/commons"
+	"github.com/helloworldpark/tickle-stock-watcher/logger"
+	"github.com/helloworldpark/tickle-stock-watcher/structs"
+)
+
+// pricesPerPage daily prices in a page of DailyHistory
+const pricesPerPage = 10
+
+// PriceGap trading days without stored prices, From and To inclusive
+type PriceGap struct {
+	StockID string
+	From    time.Time
+	To      time.Time
+	Days    int
+}
+
+func (g PriceGap) String() string {
+	if g.Days == 1 {
+		return g.From.Format("2006-01-02")
+	}
+	return fmt.Sprintf("%s~%s(%d days)", g.From.Format("2006-01-02"), g.To.Format("2006-01-02"), g.Days)
+}
+
+// dayOf midnight of the day of the timestamp
+func dayOf(timestamp int64) int64 {
+	y, m, d := commons.Unix(timestamp).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, commons.AsiaSeoul).Unix()
+}
+
+// findGaps groups the trading days without stored prices into consecutive ranges, most recent first
+func findGaps(stockID string, tradingDays []time.Time, stored []int64) []PriceGap {
+	storedDays := make(map[int64]bool)
+	for _, timestamp := range stored {
+		storedDays[dayOf(timestamp)] = true
+	}
+	var gaps []PriceGap
+	var gap *PriceGap
+	for _, day := range tradingDays {
+		if storedDays[day.Unix()] {
+			gap = nil
+			continue
+		}
+		if gap == nil {
+			gaps = append(gaps, PriceGap{StockID: stockID, From: day})
+			gap = &gaps[len(gaps)-1]
+		}
+		gap.To = day
+		gap.Days++
+	}
+	sort.Slice(gaps, func(i, j int) bool {
+		return gaps[i].From.After(gaps[j].From)
+	})
+	return gaps
+}
+
+// BackfillStart since when to find the gaps of the stock unless given: its history start, or its listing date if later.
+// For the full history of a stock whose listing date is unknown, since the oldest stored price.
+func (w *Watcher) BackfillStart(stock Stock) (time.Time, error) {
+	start := w.HistoryStart(stock.StockID)
+	if stock.ListingDate > start {
+		start = stock.ListingDate
+	}
+	if start > 0 {
+		return commons.Unix(start), nil
+	}
+	var oldest []structs.StockPrice
+	if _, err := w.dbClient.Select(&oldest, "where StockID=? order by Timestamp limit 1", stock.StockID); err != nil {
+		return time.Time{}, err
+	}
+	if len(oldest) == 0 {
+		return commons.Today(), nil
+	}
+	return commons.Unix(oldest[0].Timestamp), nil
+}
+
+// FindPriceGaps trading days since from until yesterday without stored daily prices of the stock, most recent first
+func (w *Watcher) FindPriceGaps(stockID string, from time.Time, calendar *DateChecker) ([]PriceGap, error) {
+	to := commons.Today().AddDate(0, 0, -1)
+	calendar.PrepareYears(from, to)
+
+	var prices []structs.StockPrice
+	_, err := w.dbClient.Select(&prices, "where StockID=? and Timestamp>=? and Timestamp<?", stockID, from.Unix(), commons.Today().Unix())
+	if err != nil {
+		return nil, err
+	}
+	stored := make([]int64, len(prices))
+	for i := range prices {
+		stored[i] = prices[i].Timestamp
+	}
+	return findGaps(stockID, calendar.TradingDays(from, to), stored), nil
+}
+
+// Backfill collects daily prices of the stock only on the trading days missing since from, or since its listing date if later.
+// Returns the number of prices stored and the gaps which could not be filled, i.e. trading halts.
+func (w *Watcher) Backfill(stock Stock, from time.Time, calendar *DateChecker) (int, []PriceGap, error) {
+	stockID := stock.StockID
+	if stock.ListingDate > from.Unix() {
+		from = commons.Unix(stock.ListingDate)
+	}
+	gaps, err := w.FindPriceGaps(stockID, from, calendar)
+	if err != nil || len(gaps) == 0 {
+		return 0, gaps, err
+	}
+	fetched, err := w.fetchGaps(stockID, gaps, calendar)
+	var prices []StockPrice
+	if len(fetched) > 0 {
+		var insertErr error
+		if prices, insertErr = w.insertPrices(fetched); insertErr != nil {
+			return 0, gaps, insertErr
+		}
+	}
+	if err != nil {
+		return len(prices), gaps, err
+	}
+
+	// 채우지 못한 날들은 거래정지 등으로 가격이 없거나 격리된 날
+	gapDays := make(map[int64]bool)
+	for _, gap := range gaps {
+		for _, day := range calendar.TradingDays(gap.From, gap.To) {
+			gapDays[day.Unix()] = true
+		}
+	}
+	tradingDays := calendar.TradingDays(gaps[len(gaps)-1].From, gaps[0].To)
+	var stored []int64
+	for _, day := range tradingDays {
+		if !gapDays[day.Unix()] {
+			stored = append(stored, day.Unix())
+		}
+	}
+	for i := range prices {
+		stored = append(stored, prices[i].Timestamp)
+	}
+	unfilled := findGaps(stockID, tradingDays, stored)
+	logger.Info("[Watcher] Backfilled %d prices of %s, %d gaps left", len(prices), stockID, len(unfilled))
+	return len(prices), unfilled, nil
+}
+
+// fetchGaps fetches the daily prices on the gaps, most recent first.
+// Since DailyHistory pages from the most recent, it jumps to the page estimated from the trading days since the gap.
+func (w *Watcher) fetchGaps(stockID string, gaps []PriceGap, calendar *DateChecker) ([]StockPrice, error) {
+	pages := make(map[int][]StockPrice)
+	fetch := func(page int) ([]StockPrice, error) {
+		if prices, ok := pages[page]; ok {
+			return prices, nil
+		}
+		prices, err := w.source.DailyHistory(stockID, page)
+		if err == nil {
+			pages[page] = prices
+		}
+		return prices, err
+	}
+
+	var result []StockPrice
+	page := 1
+	for _, gap := range gaps {
+		if estimated := len(calendar.TradingDays(gap.To, commons.Today()))/pricesPerPage + 1; estimated > page {
+			page = estimated
+		}
+		if page > maxHistoryPages {
+			page = maxHistoryPages
+		}
+		// 추정이 지나쳤으면 앞 페이지로
+		for page > 1 {
+			prices, err := fetch(page)
+			if err != nil {
+				return result, err
+			}
+			if len(prices) > 0 && dayOf(prices[0].Timestamp) >= gap.To.Unix() {
+				break
+			}
+			page--
+		}
+		// pageHistory처럼 반복되는 페이지와 페이지 수 한도에서 멈춘다
+		var previousOldest int64
+		for first := page; ; page++ {
+			if page > maxHistoryPages {
+				logger.Warn("[Watcher] Stopped paging gaps of %s at %d pages", stockID, maxHistoryPages)
+				page = maxHistoryPages
+				break
+			}
+			prices, err := fetch(page)
+			if err != nil {
+				return result, err
+			}
+			if len(prices) == 0 {
+				break
+			}
+			oldest := oldestTimestamp(prices)
+			if page > first && oldest >= previousOldest {
+				break
+			}
+			previousOldest = oldest
+			for _, price := range prices {
+				day := dayOf(price.Timestamp)
+				if gap.From.Unix() <= day && day <= gap.To.Unix() {
+					result = append(result, price)
+				}
+			}
+			if dayOf(oldest) <= gap.From.Unix() {
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// BackfillResult result of Backfill of a stock
+type BackfillResult struct {
+	StockID  string
+	Filled   int
+	Unfilled []PriceGap
+	Err      error
+}
+
+// WatchingStockIDs IDs of the stocks registered to watch
+func (w *Watcher) WatchingStockIDs() []string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	stockIDs := make([]string, 0, len(w.crawlers))
+	for stockID := range w.crawlers {
+		stockIDs = append(stockIDs, stockID)
+	}
+	sort.Strings(stockIDs)
+	return stockIDs
+}
@@ -0,0 +1,90 @@
+package watcher
+
+import (
+	"testing"
+
+	"github.com/helloworldpark/tickle-stock-watcher/commons"
+)
+
+// pageCountingSource counts the pages of DailyHistory requested
+type pageCountingSource struct {
+	*ReplaySource
+	pages []int
+}
+
+func (s *pageCountingSource) DailyHistory(stockID string, page int) ([]StockPrice, error) {
+	s.pages = append(s.pages, page)
+	return s.ReplaySource.DailyHistory(stockID, page)
+}
+
+func TestPriceGaps(t *testing.T) {
+	today := commons.Today()
+	calendar := &DateChecker{holidays: make(map[int64]bool), years: make(map[int]bool)}
+	calendar.holidays[calendar.TradingDays(today.AddDate(0, 0, -30), today)[0].Unix()] = true
+	days := calendar.TradingDays(today.AddDate(0, 0, -200), today.AddDate(0, 0, -1))
+
+	source := &pageCountingSource{ReplaySource: NewReplaySource(1)}
+	var stored []int64
+	for i, day := range days {
+		source.AddDailyPrices(StockPrice{StockID: "005930", Timestamp: day.Unix(), Close: 1000 + i})
+		if (100 <= i && i < 103) || i == 130 {
+			continue
+		}
+		stored = append(stored, day.Unix())
+	}
+
+	gaps := findGaps("005930", days, stored)
+	if len(gaps) != 2 || gaps[0].From != days[130] || gaps[0].Days != 1 || gaps[1].From != days[100] || gaps[1].To != days[102] || gaps[1].Days != 3 {
+		t.Fatalf("Unexpected gaps: %v", gaps)
+	}
+
+	w := New(nil, source, 0)
+	prices, err := w.fetchGaps("005930", gaps, calendar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prices) != 4 || prices[0].Close != 1130 || prices[3].Close != 1100 {
+		t.Fatalf("Unexpected prices: %+v", prices)
+	}
+	// 처음부터 넘기지 않고 빈 구간이 있는 페이지만 받는다
+	if len(source.pages) > 4 {
+		t.Errorf("Expected only pages around the gaps, got %v", source.pages)
+	}
+}
+
+func TestBackfillStart(t *testing.T) {
+	w := New(nil, NewReplaySource(1), 0)
+	year := commons.Now().Year()
+	if from, err := w.BackfillStart(Stock{StockID: "005930"}); err != nil || !from.Equal(GetCollectionStartingDate(year-DefaultHistoryYears)) {
+		t.Errorf("Expected the history start, got %v: %v", from, err)
+	}
+
+	// 보관 기간보다 늦게 상장했으면 상장일부터
+	listed := commons.Today().AddDate(0, -1, 0)
+	if from, err := w.BackfillStart(Stock{StockID: "005930", ListingDate: listed.Unix()}); err != nil || !from.Equal(listed) {
+		t.Errorf("Expected the listing date, got %v: %v", from, err)
+	}
+}
+
+func TestFetchGapsBeforeListing(t *testing.T) {
+	today := commons.Today()
+	calendar := &DateChecker{holidays: make(map[int64]bool), years: make(map[int]bool)}
+	days := calendar.TradingDays(today.AddDate(0, 0, -200), today.AddDate(0, 0, -1))
+	listed := days[len(days)-3*replayPageSize:]
+
+	source := &repeatingSource{ReplaySource: NewReplaySource(1), lastPage: 3}
+	for i := len(listed) - 1; i >= 0; i-- {
+		source.AddDailyPrices(StockPrice{StockID: "005930", Timestamp: listed[i].Unix(), Close: 1000 + i})
+	}
+
+	// 상장 전부터의 빈 구간은 반복되는 마지막 페이지에서 멈춘다
+	gaps := []PriceGap{{StockID: "005930", From: days[0], To: listed[replayPageSize]}}
+	w := New(nil, source, 0)
+	prices, err := w.fetchGaps("005930", gaps, calendar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prices) != replayPageSize+1 {
+		t.Errorf("Expected %d prices since the listing, got %d", replayPageSize+1, len(prices))
+	}
+}
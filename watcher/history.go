@@ -0,0 +1,219 @@
+package watcher
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/helloworldpark/tickle-stock-watcher/commons"
+	"github.com/helloworldpark/tickle-stock-watcher/logger"
+	"github.com/helloworldpark/tickle-stock-watcher/structs"
+)
+
+// DefaultHistoryYears years of daily prices to collect unless configured
+const DefaultHistoryYears = 2
+
+// historyProgressPages pages of DailyHistory between progress reports of ImportHistory
+const historyProgressPages = 50
+
+// HistoryProgress progress of ImportHistory of a stock
+type HistoryProgress struct {
+	StockID string
+	Pages   int
+	Prices  int
+	Oldest  time.Time // Oldest date imported so far
+	Done    bool
+}
+
+func (p HistoryProgress) String() string {
+	oldest := "-"
+	if !p.Oldest.IsZero() {
+		oldest = p.Oldest.Format("2006-01-02")
+	}
+	return fmt.Sprintf("%s: %d pages, %d prices since %s", p.StockID, p.Pages, p.Prices, oldest)
+}
+
+// SetHistoryDepth sets years of daily prices to collect for every stock without its own depth, kept in DB across restarts.
+// structs.FullHistory for every price since the listing date.
+func (w *Watcher) SetHistoryDepth(years int) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.loadHistoryDepths()
+	if w.dbClient != nil {
+		if _, err := w.dbClient.Upsert(&structs.HistoryDepth{StockID: structs.HistoryDepthOfAll, Years: years}); err != nil {
+			return err
+		}
+	}
+	w.historyYears = years
+	return nil
+}
+
+// SetStockHistoryDepth sets years of daily prices to collect for the stock, 0 to follow the global depth
+func (w *Watcher) SetStockHistoryDepth(stockID string, years int) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.loadHistoryDepths()
+	var err error
+	if years == 0 {
+		_, err = w.dbClient.Delete(structs.HistoryDepth{}, "where StockID=?", stockID)
+	} else {
+		_, err = w.dbClient.Upsert(&structs.HistoryDepth{StockID: stockID, Years: years})
+	}
+	if err != nil {
+		return err
+	}
+	if years == 0 {
+		delete(w.historyDepths, stockID)
+	} else {
+		w.historyDepths[stockID] = years
+	}
+	return nil
+}
+
+// loadHistoryDepths loads the depths of stocks and the depth of every other stock from DB, only once
+func (w *Watcher) loadHistoryDepths() {
+	if w.historyDepths != nil {
+		return
+	}
+	w.historyDepths = make(map[string]int)
+	if w.dbClient == nil {
+		return
+	}
+	var depths []structs.HistoryDepth
+	if _, err := w.dbClient.Select(&depths, "where true"); err != nil {
+		logger.Error("[Watcher] Error while loading history depths: %+v", err)
+		return
+	}
+	for _, depth := range depths {
+		if depth.StockID == structs.HistoryDepthOfAll {
+			w.historyYears = depth.Years
+			continue
+		}
+		w.historyDepths[depth.StockID] = depth.Years
+	}
+}
+
+// HistoryStart timestamp since when to collect daily prices of the stock, 0 for the full history
+func (w *Watcher) HistoryStart(stockID string) int64 {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.historyStart(stockID)
+}
+
+func (w *Watcher) historyStart(stockID string) int64 {
+	w.loadHistoryDepths()
+	years, ok := w.historyDepths[stockID]
+	if !ok {
+		years = w.historyYears
+	}
+	if years < 0 {
+		return 0
+	}
+	return GetCollectionStartingDate(commons.Now().Year() - years).Unix()
+}
+
+// oldestTimestamp the earliest timestamp of the prices
+func oldestTimestamp(prices []StockPrice) int64 {
+	oldest := prices[0].Timestamp
+	for i := range prices {
+		if prices[i].Timestamp < oldest {
+			oldest = prices[i].Timestamp
+		}
+	}
+	return oldest
+}
+
+// maxHistoryPages pages of DailyHistory that ImportHistory reads at most, about 40 years of sise_day.nhn
+const maxHistoryPages = 1000
+
+// pageHistory calls onPage with each page of DailyHistory of the stock, most recent first, until it reaches start.
+// Naver repeats the last page past the listing date, so it also stops when a page is not older than the previous one,
+// and after maxHistoryPages pages in any case.
+// onPage receives the prices since start and whether the page is the last.
+func (w *Watcher) pageHistory(stockID string, start int64, onPage func(page int, prices []StockPrice, last bool) error) error {
+	var previousOldest int64
+	for page := 1; page <= maxHistoryPages; page++ {
+		prices, err := w.source.DailyHistory(stockID, page)
+		if err != nil {
+			return err
+		}
+		if len(prices) == 0 {
+			return nil
+		}
+		oldest := oldestTimestamp(prices)
+		if page > 1 && oldest >= previousOldest {
+			return nil
+		}
+		previousOldest = oldest
+
+		inRange := make([]StockPrice, 0, len(prices))
+		for i := range prices {
+			if prices[i].Timestamp >= start {
+				inRange = append(inRange, prices[i])
+			}
+		}
+		last := oldest < start || page == maxHistoryPages
+		if err := onPage(page, inRange, last); err != nil {
+			return err
+		}
+		if last {
+			if oldest >= start {
+				logger.Warn("[Watcher] Stopped paging history of %s at %d pages", stockID, maxHistoryPages)
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// ImportHistory collects every daily price of the stock within its history depth, paging back to the listing date for the full history.
+// Unlike Collect, it does not stop at the last collected price, so that deepened history is filled.
+// onProgress is called every historyProgressPages pages and when done.
+func (w *Watcher) ImportHistory(stock structs.Stock, onProgress func(progress HistoryProgress)) (HistoryProgress, error) {
+	start := w.HistoryStart(stock.StockID)
+	if stock.ListingDate > start {
+		start = stock.ListingDate
+	}
+	progress := HistoryProgress{StockID: stock.StockID}
+
+	bucketSize := 200
+	bucket := make([]StockPrice, 0, bucketSize)
+	flush := func() error {
+		if len(bucket) == 0 {
+			return nil
+		}
+		_, err := w.insertPrices(bucket)
+		bucket = bucket[:0]
+		return err
+	}
+
+	err := w.pageHistory(stock.StockID, start, func(page int, prices []StockPrice, last bool) error {
+		progress.Pages = page
+		for i := range prices {
+			bucket = append(bucket, prices[i])
+			progress.Prices++
+			progress.Oldest = commons.Unix(prices[i].Timestamp)
+		}
+		if len(bucket) >= bucketSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if !last && page%historyProgressPages == 0 && onProgress != nil {
+			onProgress(progress)
+		}
+		return nil
+	})
+	if err != nil {
+		flush()
+		return progress, err
+	}
+	if err := flush(); err != nil {
+		return progress, err
+	}
+	progress.Done = true
+	if onProgress != nil {
+		onProgress(progress)
+	}
+	logger.Info("[Watcher] Imported history of %s", progress.String())
+	return progress, nil
+}
@@ -0,0 +1,76 @@
+package watcher
+
+import (
+	"testing"
+
+	"github.com/helloworldpark/tickle-stock-watcher/commons"
+	"github.com/helloworldpark/tickle-stock-watcher/structs"
+)
+
+func TestHistoryStart(t *testing.T) {
+	w := New(nil, NewReplaySource(1), 0)
+	year := commons.Now().Year()
+	if start := w.HistoryStart("005930"); start != GetCollectionStartingDate(year-DefaultHistoryYears).Unix() {
+		t.Errorf("Expected the default depth, got %v", commons.Unix(start))
+	}
+
+	w.SetHistoryDepth(10)
+	if start := w.HistoryStart("005930"); start != GetCollectionStartingDate(year-10).Unix() {
+		t.Errorf("Expected 10 years, got %v", commons.Unix(start))
+	}
+
+	w.historyDepths["005930"] = structs.FullHistory
+	if start := w.HistoryStart("005930"); start != 0 {
+		t.Errorf("Expected the full history, got %v", commons.Unix(start))
+	}
+	if start := w.HistoryStart("000660"); start != GetCollectionStartingDate(year-10).Unix() {
+		t.Errorf("Expected the global depth for other stocks, got %v", commons.Unix(start))
+	}
+}
+
+// repeatingSource repeats the last page of DailyHistory like sise_day.nhn past the listing date
+type repeatingSource struct {
+	*ReplaySource
+	lastPage int
+}
+
+func (s *repeatingSource) DailyHistory(stockID string, page int) ([]StockPrice, error) {
+	if page > s.lastPage {
+		page = s.lastPage
+	}
+	return s.ReplaySource.DailyHistory(stockID, page)
+}
+
+func TestPageHistory(t *testing.T) {
+	source := &repeatingSource{ReplaySource: NewReplaySource(1), lastPage: 3}
+	today := commons.Today()
+	for i := 0; i < 3*replayPageSize; i++ {
+		source.AddDailyPrices(StockPrice{StockID: "005930", Timestamp: today.AddDate(0, 0, -i).Unix(), Close: 1000})
+	}
+	w := New(nil, source, 0)
+
+	count := 0
+	pages := 0
+	err := w.pageHistory("005930", 0, func(page int, prices []StockPrice, last bool) error {
+		pages = page
+		count += len(prices)
+		return nil
+	})
+	if err != nil || pages != 3 || count != 3*replayPageSize {
+		t.Errorf("Expected to stop at the repeated page, got %d pages and %d prices: %v", pages, count, err)
+	}
+
+	start := today.AddDate(0, 0, -replayPageSize-5).Unix()
+	count, pages = 0, 0
+	w.pageHistory("005930", start, func(page int, prices []StockPrice, last bool) error {
+		pages = page
+		count += len(prices)
+		if page == 2 && !last {
+			t.Errorf("Expected the page reaching start to be the last")
+		}
+		return nil
+	})
+	if pages != 2 || count != replayPageSize+6 {
+		t.Errorf("Expected to stop at start, got %d pages and %d prices", pages, count)
+	}
+}
@@ -0,0 +1,268 @@
+package watcher
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/helloworldpark/tickle-stock-watcher/commons"
+	"github.com/helloworldpark/tickle-stock-watcher/structs"
+)
+
+const krxListingURL = "http://data.krx.co.kr/comm/bldAttendant/getJsonData.cmd"
+
+// KRX data of every listed issue
+const (
+	krxStocks  = "dbms/MDC/STAT/standard/MDCSTAT01901" // 전종목 기본정보
+	krxETFs    = "dbms/MDC/STAT/standard/MDCSTAT04601" // ETF 전종목 기본정보
+	krxETNs    = "dbms/MDC/STAT/standard/MDCSTAT06701" // ETN 전종목 기본정보
+	krxSectors = "dbms/MDC/STAT/standard/MDCSTAT03901" // 업종분류 현황
+)
+
+// krxSectorMarkets markets classified by the sectors of KRX: KOSPI, KOSDAQ
+var krxSectorMarkets = []string{"STK", "KSQ"}
+
+// krxSectorLookbackDays how many days to look back for the last trading day with the sectors
+const krxSectorLookbackDays = 7
+
+// krxDateLayout layout of the listing date of KRX
+const krxDateLayout = "2006/01/02"
+
+// listingSource downloads the stocks of a kind
+type listingSource struct {
+	name     string
+	download func() ([]structs.Stock, error)
+}
+
+// listingSources every source of the stocks, common shares last so that they are found first by name
+var listingSources = []listingSource{
+	{name: "etf", download: func() ([]structs.Stock, error) {
+		return downloadKRXListing(krxETFs, structs.InstrumentETF)
+	}},
+	{name: "etn", download: func() ([]structs.Stock, error) {
+		return downloadKRXListing(krxETNs, structs.InstrumentETN)
+	}},
+	{name: "preferred", download: func() ([]structs.Stock, error) {
+		return downloadKRXListing(krxStocks, structs.InstrumentPreferred)
+	}},
+	{name: structs.KOSPI, download: func() ([]structs.Stock, error) {
+		return downloadStockSymbols(structs.KOSPI)
+	}},
+	{name: structs.KOSDAQ, download: func() ([]structs.Stock, error) {
+		return downloadStockSymbols(structs.KOSDAQ)
+	}},
+	{name: structs.KONEX, download: func() ([]structs.Stock, error) {
+		return downloadStockSymbols(structs.KONEX)
+	}},
+}
+
+// downloadKRXListing downloads the issues of the instrument type listed in every market from data.krx.co.kr
+func downloadKRXListing(bld string, instrument structs.Instrument) ([]structs.Stock, error) {
+	raw, err := downloadKRX(bld, url.Values{"mktId": {"ALL"}})
+	if err != nil {
+		return nil, err
+	}
+	stocks, err := parseKRXListing(raw, instrument)
+	return stocks, withURL(err, krxListingURL+"?bld="+bld)
+}
+
+// downloadKRX posts the query of the bld to data.krx.co.kr
+func downloadKRX(bld string, query url.Values) ([]byte, error) {
+	formData := url.Values{
+		"bld":         {bld},
+		"share":       {"1"},
+		"csvxls_isNo": {"false"},
+	}
+	for k, v := range query {
+		formData[k] = v
+	}
+	return defaultFetcher.postForm(krxListingURL, formData)
+}
+
+// krxIssue an issue of the KRX data.
+// ISU_SRT_CD: 단축코드, ISU_ABBRV: 종목명, MKT_TP_NM: 시장구분, KIND_STKCERT_TP_NM: 주식종류,
+// LIST_DD: 상장일, LIST_SHRS: 상장주식수, IDX_IND_NM: 업종명
+type krxIssue struct {
+	Code        string `json:"ISU_SRT_CD"`
+	Name        string `json:"ISU_ABBRV"`
+	Market      string `json:"MKT_TP_NM"`
+	Kind        string `json:"KIND_STKCERT_TP_NM"`
+	ListingDate string `json:"LIST_DD"`
+	Shares      string `json:"LIST_SHRS"`
+	Sector      string `json:"IDX_IND_NM"`
+}
+
+// parseKRXIssues parses the issues from the KRX data, whose list is named differently by the bld
+func parseKRXIssues(raw []byte) ([]krxIssue, error) {
+	var downloaded struct {
+		OutBlock []krxIssue `json:"OutBlock_1"`
+		Output   []krxIssue `json:"output"`
+		Block    []krxIssue `json:"block1"`
+	}
+	if err := json.Unmarshal(raw, &downloaded); err != nil {
+		return nil, newParseError("Invalid listing: %v", err)
+	}
+	issues := append(append(downloaded.OutBlock, downloaded.Output...), downloaded.Block...)
+	if len(issues) == 0 {
+		return nil, newParseError("No issues in listing")
+	}
+	for _, v := range issues {
+		if len(v.Code) == 0 || len(v.Name) == 0 {
+			return nil, newParseError("Invalid issue: %+v", v)
+		}
+	}
+	return issues, nil
+}
+
+// parseKRXListing parses the issues from the KRX data.
+// Only preferred shares are taken from the list of every stock, since common shares are listed by KIND.
+func parseKRXListing(raw []byte, instrument structs.Instrument) ([]structs.Stock, error) {
+	issues, err := parseKRXIssues(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]structs.Stock, 0, len(issues))
+	for _, v := range issues {
+		if instrument == structs.InstrumentPreferred && !strings.Contains(v.Kind, "우선주") {
+			continue
+		}
+		result = append(result, structs.Stock{
+			StockID:     v.Code,
+			Name:        strings.TrimSpace(v.Name),
+			MarketType:  krxMarket(v.Market),
+			Instrument:  instrument,
+			ListingDate: krxListingDate(v.ListingDate),
+			Shares:      krxShares(v.Shares),
+		})
+	}
+	return result, nil
+}
+
+// krxListingDate timestamp of the listing date, 0 if unknown
+func krxListingDate(date string) int64 {
+	if len(date) == 0 {
+		return 0
+	}
+	timestamp, err := commons.ParseTimestamp(krxDateLayout, date)
+	if err != nil {
+		return 0
+	}
+	return timestamp
+}
+
+// krxShares number of the listed shares, 0 if unknown
+func krxShares(shares string) int64 {
+	if len(shares) == 0 {
+		return 0
+	}
+	n, err := commons.ParseInt64(shares)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// stockDetails details of the stocks missing in the list of KIND, Key: Stock ID
+type stockDetails map[string]structs.Stock
+
+// downloadStockDetails downloads the number of shares and the sectors of every stock from data.krx.co.kr.
+// Details downloaded so far are returned with the error.
+func downloadStockDetails() (stockDetails, error) {
+	details := make(stockDetails)
+	raw, err := downloadKRX(krxStocks, url.Values{"mktId": {"ALL"}})
+	if err == nil {
+		err = withURL(details.parseListing(raw), krxListingURL+"?bld="+krxStocks)
+	}
+	if err != nil {
+		return details, err
+	}
+	for _, market := range krxSectorMarkets {
+		if err := details.downloadSectors(market); err != nil {
+			return details, err
+		}
+	}
+	return details, nil
+}
+
+// downloadSectors downloads the sectors of the market on the last trading day
+func (details stockDetails) downloadSectors(market string) error {
+	var lastErr error
+	day := commons.Now()
+	for i := 0; i < krxSectorLookbackDays; i++ {
+		if day.Weekday() != time.Saturday && day.Weekday() != time.Sunday {
+			raw, err := downloadKRX(krxSectors, url.Values{"mktId": {market}, "trdDd": {day.Format("20060102")}})
+			if err == nil {
+				err = details.parseSectors(raw)
+			}
+			if err == nil {
+				return nil
+			}
+			// 휴장일에는 빈 목록이 내려온다
+			lastErr = withURL(err, krxListingURL+"?bld="+krxSectors)
+		}
+		day = day.AddDate(0, 0, -1)
+	}
+	return lastErr
+}
+
+// parseListing takes the listing date and the number of shares from the list of every stock
+func (details stockDetails) parseListing(raw []byte) error {
+	issues, err := parseKRXIssues(raw)
+	if err != nil {
+		return err
+	}
+	for _, v := range issues {
+		stock := details[v.Code]
+		stock.ListingDate = krxListingDate(v.ListingDate)
+		stock.Shares = krxShares(v.Shares)
+		details[v.Code] = stock
+	}
+	return nil
+}
+
+// parseSectors takes the sectors from the list of the sectors
+func (details stockDetails) parseSectors(raw []byte) error {
+	issues, err := parseKRXIssues(raw)
+	if err != nil {
+		return err
+	}
+	for _, v := range issues {
+		stock := details[v.Code]
+		stock.Sector = strings.TrimSpace(v.Sector)
+		details[v.Code] = stock
+	}
+	return nil
+}
+
+// fill fills the details of the stock missing in its listing
+func (details stockDetails) fill(stock structs.Stock) structs.Stock {
+	detail, ok := details[stock.StockID]
+	if !ok {
+		return stock
+	}
+	if len(stock.Sector) == 0 {
+		stock.Sector = detail.Sector
+	}
+	if stock.ListingDate == 0 {
+		stock.ListingDate = detail.ListingDate
+	}
+	if stock.Shares == 0 {
+		stock.Shares = detail.Shares
+	}
+	return stock
+}
+
+// krxMarket market of the KRX market name, i.e. KOSDAQ GLOBAL. ETFs and ETNs are listed in KOSPI.
+func krxMarket(name string) structs.Market {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasPrefix(name, structs.KOSDAQ):
+		return structs.KOSDAQ
+	case strings.HasPrefix(name, structs.KONEX):
+		return structs.KONEX
+	default:
+		return structs.KOSPI
+	}
+}
@@ -0,0 +1,102 @@
+package watcher
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/helloworldpark/tickle-stock-watcher/logger"
+	"github.com/helloworldpark/tickle-stock-watcher/structs"
+)
+
+// ListingChangeKind is an enum type representing how a stock has changed between the listings
+type ListingChangeKind int
+
+const (
+	// Delisted disappeared from the listing, either delisted or halted
+	Delisted ListingChangeKind = iota
+	// Listed appeared in the listing, either newly listed or back from a halt
+	Listed
+	// CodeChanged listed again by another stock ID, i.e. after mergers
+	CodeChanged
+)
+
+// ListingChange is a stock changed between the listings
+// Old is empty if listed, New is empty if delisted.
+type ListingChange struct {
+	Kind ListingChangeKind
+	Old  Stock
+	New  Stock
+}
+
+func (c ListingChange) String() string {
+	switch c.Kind {
+	case Delisted:
+		return fmt.Sprintf("Delisted %s(%s)", c.Old.Name, c.Old.StockID)
+	case Listed:
+		return fmt.Sprintf("Listed %s(%s)", c.New.Name, c.New.StockID)
+	default:
+		return fmt.Sprintf("Code changed %s(%s) -> %s(%s)", c.Old.Name, c.Old.StockID, c.New.Name, c.New.StockID)
+	}
+}
+
+// diffListings finds the stocks changed from the old listing to the new one, sorted by stock ID.
+// A stock delisted is regarded as moved to another stock ID if newly listed by the same name, and the same type.
+// Market indices are not compared.
+func diffListings(old, new map[string]Stock) []ListingChange {
+	added := make(map[string]Stock)       // Key: Stock ID
+	addedByKey := make(map[string]string) // Key: listingKey, Value: Stock ID
+	for stockID, stock := range new {
+		if _, ok := old[stockID]; !ok && stock.MarketType != structs.INDEX {
+			added[stockID] = stock
+			addedByKey[listingKey(stock)] = stockID
+		}
+	}
+
+	var result []ListingChange
+	for stockID, stock := range old {
+		if _, ok := new[stockID]; ok || stock.MarketType == structs.INDEX {
+			continue
+		}
+		if movedID, ok := addedByKey[listingKey(stock)]; ok {
+			result = append(result, ListingChange{Kind: CodeChanged, Old: stock, New: added[movedID]})
+			delete(addedByKey, listingKey(stock))
+			delete(added, movedID)
+			continue
+		}
+		result = append(result, ListingChange{Kind: Delisted, Old: stock})
+	}
+	for _, stock := range added {
+		result = append(result, ListingChange{Kind: Listed, New: stock})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Old.StockID+result[i].New.StockID < result[j].Old.StockID+result[j].New.StockID
+	})
+	return result
+}
+
+func listingKey(stock Stock) string {
+	return string(stock.Instrument) + "/" + trimLowerReplace(stock.Name)
+}
+
+// SetListingHandler sets the handler called with the changes of the listing whenever stock info is updated
+func (checker *StockItemChecker) SetListingHandler(handler func(changes []ListingChange)) {
+	checker.onChange = handler
+}
+
+// ChangeOfUnlisted finds how the stock not in the current listing has changed, using the stock info stored before.
+// Used for the stocks which have changed while not updating, i.e. before restarting.
+func (checker *StockItemChecker) ChangeOfUnlisted(stockID string) ListingChange {
+	old := Stock{StockID: stockID, Name: stockID}
+	var stored []Stock
+	if _, err := checker.dbClient.Select(&stored, "where StockID=?", stockID); err != nil {
+		logger.Error("[Watcher] Error while querying stock info of %s: %s", stockID, err.Error())
+	}
+	if len(stored) == 0 {
+		return ListingChange{Kind: Delisted, Old: old}
+	}
+	old = stored[0]
+	if stock, ok := checker.StockFromName(old.Name); ok && stock.StockID != stockID && listingKey(stock) == listingKey(old) {
+		return ListingChange{Kind: CodeChanged, Old: old, New: stock}
+	}
+	return ListingChange{Kind: Delisted, Old: old}
+}
@@ -0,0 +1,49 @@
+package watcher
+
+import (
+	"testing"
+
+	"github.com/helloworldpark/tickle-stock-watcher/structs"
+)
+
+func TestDiffListings(t *testing.T) {
+	samsung := structs.Stock{StockID: "005930", Name: "삼성전자", MarketType: structs.KOSPI, Instrument: structs.InstrumentStock}
+	halted := structs.Stock{StockID: "000001", Name: "정지종목", MarketType: structs.KOSDAQ, Instrument: structs.InstrumentStock}
+	merged := structs.Stock{StockID: "000002", Name: "합병 종목", MarketType: structs.KOSPI, Instrument: structs.InstrumentStock}
+	renamed := structs.Stock{StockID: "000003", Name: "합병종목", MarketType: structs.KOSPI, Instrument: structs.InstrumentStock}
+	etf := structs.Stock{StockID: "000004", Name: "정지종목", MarketType: structs.KOSPI, Instrument: structs.InstrumentETF}
+	ipo := structs.Stock{StockID: "000005", Name: "신규상장", MarketType: structs.KONEX, Instrument: structs.InstrumentStock}
+	kospi := structs.Indices[0]
+
+	old := map[string]structs.Stock{
+		samsung.StockID: samsung,
+		halted.StockID:  halted,
+		merged.StockID:  merged,
+		kospi.StockID:   kospi,
+	}
+	new := map[string]structs.Stock{
+		samsung.StockID: samsung,
+		renamed.StockID: renamed,
+		etf.StockID:     etf,
+		ipo.StockID:     ipo,
+	}
+	expected := []ListingChange{
+		{Kind: Delisted, Old: halted},
+		{Kind: CodeChanged, Old: merged, New: renamed},
+		{Kind: Listed, New: etf},
+		{Kind: Listed, New: ipo},
+	}
+	changes := diffListings(old, new)
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected[i], changes[i])
+		}
+	}
+
+	if changes := diffListings(old, old); len(changes) != 0 {
+		t.Errorf("Expected no changes, got %v", changes)
+	}
+}
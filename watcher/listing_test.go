@@ -0,0 +1,96 @@
+package watcher
+
+import (
+	"testing"
+
+	"github.com/helloworldpark/tickle-stock-watcher/structs"
+)
+
+const krxStocksFixture = `{"OutBlock_1":[
+{"ISU_CD":"KR7005930003","ISU_SRT_CD":"005930","ISU_NM":"삼성전자보통주","ISU_ABBRV":"삼성전자","MKT_TP_NM":"KOSPI","SECUGRP_NM":"주권","KIND_STKCERT_TP_NM":"보통주"},
+{"ISU_CD":"KR7005931001","ISU_SRT_CD":"005935","ISU_NM":"삼성전자1우선주","ISU_ABBRV":"삼성전자우","MKT_TP_NM":"KOSPI","SECUGRP_NM":"주권","KIND_STKCERT_TP_NM":"구형우선주"},
+{"ISU_CD":"KR7000000000","ISU_SRT_CD":"000005","ISU_NM":"테스트2우선주","ISU_ABBRV":"테스트2우B","MKT_TP_NM":"KOSDAQ GLOBAL","SECUGRP_NM":"주권","KIND_STKCERT_TP_NM":"신형우선주"}
+],"CURRENT_DATETIME":"2020.01.31 PM 06:00:00"}`
+
+const krxETFsFixture = `{"output":[
+{"ISU_CD":"KR7069500007","ISU_SRT_CD":"069500","ISU_NM":"KODEX 200증권상장지수투자신탁(주식)","ISU_ABBRV":"KODEX 200 ","ETF_OBJ_IDX_NM":"코스피 200"}
+]}`
+
+func TestParseKRXListing(t *testing.T) {
+	preferred, err := parseKRXListing([]byte(krxStocksFixture), structs.InstrumentPreferred)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []structs.Stock{
+		{StockID: "005935", Name: "삼성전자우", MarketType: structs.KOSPI, Instrument: structs.InstrumentPreferred},
+		{StockID: "000005", Name: "테스트2우B", MarketType: structs.KOSDAQ, Instrument: structs.InstrumentPreferred},
+	}
+	if len(preferred) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, preferred)
+	}
+	for i := range expected {
+		if preferred[i] != expected[i] {
+			t.Errorf("Expected %+v, got %+v", expected[i], preferred[i])
+		}
+	}
+
+	etfs, err := parseKRXListing([]byte(krxETFsFixture), structs.InstrumentETF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	etf := structs.Stock{StockID: "069500", Name: "KODEX 200", MarketType: structs.KOSPI, Instrument: structs.InstrumentETF}
+	if len(etfs) != 1 || etfs[0] != etf {
+		t.Errorf("Expected %+v, got %+v", etf, etfs)
+	}
+
+	for _, raw := range []string{`{"OutBlock_1":[]}`, `<html></html>`, `{"output":[{"ISU_SRT_CD":"069500"}]}`} {
+		_, err := parseKRXListing([]byte(raw), structs.InstrumentETF)
+		if scrapeErr, ok := err.(*ScrapeError); !ok || scrapeErr.Kind != ScrapeParse {
+			t.Errorf("%s: expected parse error, got %v", raw, err)
+		}
+	}
+}
+
+const krxStockDetailsFixture = `{"OutBlock_1":[
+{"ISU_SRT_CD":"005930","ISU_ABBRV":"삼성전자","MKT_TP_NM":"KOSPI","KIND_STKCERT_TP_NM":"보통주","LIST_DD":"1975/06/11","LIST_SHRS":"5,969,782,550"},
+{"ISU_SRT_CD":"005935","ISU_ABBRV":"삼성전자우","MKT_TP_NM":"KOSPI","KIND_STKCERT_TP_NM":"구형우선주","LIST_DD":"1989/09/25","LIST_SHRS":"822,886,700"}
+]}`
+
+const krxSectorsFixture = `{"block1":[
+{"ISU_SRT_CD":"005930","ISU_ABBRV":"삼성전자","MKT_TP_NM":"KOSPI","IDX_IND_NM":"전기전자 ","TDD_CLSPRC":"56,400"}
+]}`
+
+func TestParseStockDetails(t *testing.T) {
+	details := make(stockDetails)
+	if err := details.parseListing([]byte(krxStockDetailsFixture)); err != nil {
+		t.Fatal(err)
+	}
+	if err := details.parseSectors([]byte(krxSectorsFixture)); err != nil {
+		t.Fatal(err)
+	}
+
+	kind := structs.Stock{StockID: "005930", Name: "삼성전자", MarketType: structs.KOSPI, Instrument: structs.InstrumentStock, Industry: "통신 및 방송 장비 제조업", ListingDate: 171644400}
+	filled := details.fill(kind)
+	expected := kind
+	expected.Sector = "전기전자"
+	expected.Shares = 5969782550
+	if filled != expected {
+		t.Errorf("Expected %+v, got %+v", expected, filled)
+	}
+
+	preferred, err := parseKRXListing([]byte(krxStockDetailsFixture), structs.InstrumentPreferred)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(preferred) != 1 || preferred[0].Shares != 822886700 || preferred[0].ListingDate != 622652400 {
+		t.Errorf("Expected details of preferred shares, got %+v", preferred)
+	}
+	if filled := details.fill(preferred[0]); filled != preferred[0] {
+		t.Errorf("Expected %+v, got %+v", preferred[0], filled)
+	}
+
+	unknown := structs.Stock{StockID: "069500", Name: "KODEX 200"}
+	if filled := details.fill(unknown); filled != unknown {
+		t.Errorf("Expected %+v, got %+v", unknown, filled)
+	}
+}
@@ -0,0 +1,465 @@
+package watcher
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/transform"
+
+	"github.com/anaskhan96/soup"
+	"github.com/helloworldpark/tickle-stock-watcher/commons"
+	"github.com/helloworldpark/tickle-stock-watcher/structs"
+)
+
+const (
+	dateFormat         = "2006.01.02"
+	intradayTimeFormat = "15:04"
+	pastURLFormat      = "https://finance.naver.com/item/sise_day.nhn?code=%s&page=%d"
+	nowURLFormat       = "https://finance.naver.com/item/main.nhn?code=%s"
+	intradayURLFormat  = "https://finance.naver.com/item/sise_time.nhn?code=%s&thistime=%s&page=%d"
+	maxIntradayPages   = 40
+	pollingURLFormat   = "https://polling.finance.naver.com/api/realtime?query=%s"
+	pollingItems       = "SERVICE_ITEM"
+	pollingIndices     = "SERVICE_INDEX"
+	pollingIndexScale  = 100 // Indices are polled in hundredths of a point
+	maxPollingStocks   = 50
+	indexChartURL      = "https://fchart.stock.naver.com/sise.nhn?symbol=%s&timeframe=day&count=%d&requestType=0"
+	indexChartChunk    = 500 // Daily prices of indices are requested by this many
+	indexChartTTL      = 10 * time.Minute
+)
+
+// indexChart daily prices of an index from the chart API, most recent first
+type indexChart struct {
+	prices    []StockPrice
+	count     int // Number of prices requested
+	fetchedAt time.Time
+}
+
+// naverSource scrapes prices from finance.naver.com
+type naverSource struct {
+	fetcher     *fetcher
+	indexCharts map[string]indexChart // Key: Stock ID of the index
+	mutex       *sync.Mutex
+}
+
+// NewNaverSource creates a PriceSource scraping finance.naver.com
+func NewNaverSource() PriceSource {
+	return &naverSource{
+		fetcher:     defaultFetcher,
+		indexCharts: make(map[string]indexChart),
+		mutex:       &sync.Mutex{},
+	}
+}
+
+func (s *naverSource) Name() string {
+	return "naver"
+}
+
+func (s *naverSource) Quote(stockID string) (StockPrice, error) {
+	if structs.IsIndex(stockID) {
+		quotes, err := s.Quotes([]string{stockID})
+		if err != nil {
+			return StockPrice{}, err
+		}
+		quote, ok := quotes[stockID]
+		if !ok {
+			return StockPrice{}, newParseError("No quote of %s", stockID)
+		}
+		return quote, nil
+	}
+	u := fmt.Sprintf(nowURLFormat, stockID)
+	response, err := s.fetcher.get(u)
+	if err != nil {
+		return StockPrice{}, err
+	}
+	price, err := parseNaverQuote(stockID, response, commons.Now().Unix())
+	return price, withURL(err, u)
+}
+
+func (s *naverSource) MaxBatchSize() int {
+	return maxPollingStocks
+}
+
+// Quotes intraday snapshots of many stocks at once from the realtime polling API
+// Stocks and indices are queried together, i.e. SERVICE_ITEM:005930|SERVICE_INDEX:KOSPI
+func (s *naverSource) Quotes(stockIDs []string) (map[string]StockPrice, error) {
+	var items, indices []string
+	for _, stockID := range stockIDs {
+		if structs.IsIndex(stockID) {
+			indices = append(indices, stockID)
+		} else {
+			items = append(items, stockID)
+		}
+	}
+	var queries []string
+	if len(items) > 0 {
+		queries = append(queries, pollingItems+":"+strings.Join(items, ","))
+	}
+	if len(indices) > 0 {
+		queries = append(queries, pollingIndices+":"+strings.Join(indices, ","))
+	}
+	u := fmt.Sprintf(pollingURLFormat, strings.Join(queries, "|"))
+	response, err := s.fetcher.get(u)
+	if err != nil {
+		return nil, err
+	}
+	quotes, err := parseNaverPolling([]byte(response))
+	return quotes, withURL(err, u)
+}
+
+func (s *naverSource) DailyHistory(stockID string, page int) ([]StockPrice, error) {
+	if structs.IsIndex(stockID) {
+		return s.indexDailyHistory(stockID, page)
+	}
+	u := fmt.Sprintf(pastURLFormat, stockID, page)
+	response, err := s.fetcher.get(u)
+	if err != nil {
+		return nil, err
+	}
+	prices, err := parseNaverDailyHistory(stockID, response)
+	return prices, withURL(err, u)
+}
+
+func (s *naverSource) IntradayBars(stockID string, day time.Time) ([]StockPrice, error) {
+	if structs.IsIndex(stockID) {
+		return nil, newParseError("Minute bars of index %s are not supported", stockID)
+	}
+	day = day.In(commons.AsiaSeoul)
+	y, m, d := day.Date()
+	thisTime := fmt.Sprintf("%04d%02d%02d153000", y, m, d)
+
+	// sise_time.nhn도 마지막 페이지를 넘어가면 그 페이지를 반복한다
+	var bars []StockPrice
+	var previousOldest int64
+	for page := 1; page <= maxIntradayPages; page++ {
+		u := fmt.Sprintf(intradayURLFormat, stockID, thisTime, page)
+		response, err := s.fetcher.get(u)
+		if err != nil {
+			return nil, err
+		}
+		pageBars, err := parseNaverIntraday(stockID, day, response)
+		if err != nil {
+			return nil, withURL(err, u)
+		}
+		if len(pageBars) == 0 {
+			break
+		}
+		oldest := oldestTimestamp(pageBars)
+		if page > 1 && oldest >= previousOldest {
+			break
+		}
+		previousOldest = oldest
+		bars = append(bars, pageBars...)
+	}
+	sort.Slice(bars, func(i, j int) bool {
+		return bars[i].Timestamp < bars[j].Timestamp
+	})
+	return bars, nil
+}
+
+// indexDailyHistory daily prices of the index on page, paged like sise_day.nhn.
+// The chart API has no pages but the number of prices, so the prices are requested by chunks and cached for a while.
+func (s *naverSource) indexDailyHistory(stockID string, page int) ([]StockPrice, error) {
+	if page < 1 {
+		return nil, nil
+	}
+	need := page * pricesPerPage
+	s.mutex.Lock()
+	chart, ok := s.indexCharts[stockID]
+	s.mutex.Unlock()
+	if !ok || chart.count < need || time.Since(chart.fetchedAt) > indexChartTTL {
+		count := (need/indexChartChunk + 1) * indexChartChunk
+		u := fmt.Sprintf(indexChartURL, stockID, count)
+		response, err := s.fetcher.get(u)
+		if err != nil {
+			return nil, err
+		}
+		prices, err := parseNaverIndexChart(stockID, response)
+		if err != nil {
+			return nil, withURL(err, u)
+		}
+		chart = indexChart{prices: prices, count: count, fetchedAt: time.Now()}
+		s.mutex.Lock()
+		s.indexCharts[stockID] = chart
+		s.mutex.Unlock()
+	}
+	from := (page - 1) * pricesPerPage
+	if from >= len(chart.prices) {
+		return nil, nil
+	}
+	return chart.prices[from:commons.MinInt(need, len(chart.prices))], nil
+}
+
+// findSoup finds the child element, or returns an error describing what was missing
+func findSoup(r soup.Root, args ...string) (soup.Root, error) {
+	child := r.Find(args...)
+	if child.Pointer == nil {
+		return child, newParseError("Cannot find %s: %+v", strings.Join(args, " "), child.Error)
+	}
+	return child, nil
+}
+
+// parseNaverQuote parses the intraday snapshot from main.nhn
+// Current price from the today div, 전일, 고가, 거래량, 시가, 저가 from the no_info table.
+// Volume is the accumulated volume of the day.
+func parseNaverQuote(stockID, html string, timestamp int64) (StockPrice, error) {
+	root := soup.HTMLParse(html)
+	if root.Pointer == nil {
+		return StockPrice{}, newParseError("Invalid HTML of %s: %+v", stockID, root.Error)
+	}
+	today := root
+	var err error
+	for _, args := range [][]string{
+		{"div", "class", "today"},
+		{"em"},
+		{"span", "class", "blind"},
+	} {
+		today, err = findSoup(today, args...)
+		if err != nil {
+			return StockPrice{}, err
+		}
+	}
+	price := structs.StockPrice{StockID: stockID, Timestamp: timestamp}
+	price.Close, err = commons.ParseInt(today.Text())
+	if err != nil {
+		return StockPrice{}, newParseError("Invalid price of %s: %v", stockID, err)
+	}
+
+	info, err := findSoup(root, "table", "class", "no_info")
+	if err != nil {
+		return StockPrice{}, err
+	}
+	var prevClose int
+	fields := map[string]*int{
+		"전일": &prevClose,
+		"고가": &price.High,
+		"시가": &price.Open,
+		"저가": &price.Low,
+	}
+	for _, td := range info.FindAll("td") {
+		label := td.Find("span", "class", "sptxt")
+		value := td.Find("span", "class", "blind")
+		if label.Pointer == nil || value.Pointer == nil {
+			continue
+		}
+		name := strings.TrimSpace(label.Text())
+		if name == "거래량" {
+			if price.Volume, err = commons.ParseDouble(value.Text()); err != nil {
+				return StockPrice{}, newParseError("Invalid %s of %s: %v", name, stockID, err)
+			}
+			continue
+		}
+		if field, ok := fields[name]; ok {
+			if *field, err = commons.ParseInt(value.Text()); err != nil {
+				return StockPrice{}, newParseError("Invalid %s of %s: %v", name, stockID, err)
+			}
+			delete(fields, name)
+		}
+	}
+	for name := range fields {
+		return StockPrice{}, newParseError("Cannot find %s of %s", name, stockID)
+	}
+	price.Change = price.Close - prevClose
+	return price, nil
+}
+
+// parseNaverPolling parses the intraday snapshots from the realtime polling API
+// nv: 현재가, sv: 전일, ov: 시가, hv: 고가, lv: 저가, aq: 누적 거래량
+// Indices are in hundredths of a point, and stored scaled by structs.IndexPriceScale.
+func parseNaverPolling(raw []byte) (map[string]StockPrice, error) {
+	var polled struct {
+		ResultCode string `json:"resultCode"`
+		Result     struct {
+			Areas []struct {
+				Name  string `json:"name"`
+				Datas []struct {
+					Code      string  `json:"cd"`
+					Now       float64 `json:"nv"`
+					PrevClose float64 `json:"sv"`
+					Open      float64 `json:"ov"`
+					High      float64 `json:"hv"`
+					Low       float64 `json:"lv"`
+					Volume    float64 `json:"aq"`
+				} `json:"datas"`
+			} `json:"areas"`
+			Time int64 `json:"time"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(raw, &polled); err != nil {
+		return nil, newParseError("Invalid polling response: %v", err)
+	}
+	if polled.ResultCode != "success" {
+		return nil, newParseError("Polling failed: %s", polled.ResultCode)
+	}
+	timestamp := polled.Result.Time / 1000
+	if timestamp == 0 {
+		timestamp = commons.Now().Unix()
+	}
+	quotes := make(map[string]StockPrice)
+	for _, area := range polled.Result.Areas {
+		scale := 1.0
+		if area.Name == pollingIndices {
+			scale = structs.IndexPriceScale / pollingIndexScale
+		}
+		value := func(v float64) int {
+			return int(math.Round(v * scale))
+		}
+		for _, data := range area.Datas {
+			if len(data.Code) == 0 || data.Now <= 0 {
+				continue
+			}
+			quotes[data.Code] = StockPrice{
+				StockID:   data.Code,
+				Timestamp: timestamp,
+				Open:      value(data.Open),
+				High:      value(data.High),
+				Low:       value(data.Low),
+				Close:     value(data.Now),
+				Volume:    data.Volume,
+				Change:    value(data.Now) - value(data.PrevClose),
+			}
+		}
+	}
+	return quotes, nil
+}
+
+// parseNaverDailyHistory parses the daily prices from sise_day.nhn
+func parseNaverDailyHistory(stockID, html string) ([]StockPrice, error) {
+	root := soup.HTMLParse(html)
+	if root.Pointer == nil {
+		return nil, newParseError("Invalid HTML of %s: %+v", stockID, root.Error)
+	}
+	table, err := findSoup(root, "table", "class", "type2")
+	if err != nil {
+		return nil, err
+	}
+	if tbody := table.Find("tbody"); tbody.Pointer != nil {
+		table = tbody
+	}
+
+	priceContents := table.FindAll("tr", "onmouseover", "mouseOver(this)")
+	if len(priceContents) == 0 {
+		return nil, nil
+	}
+	result := make([]structs.StockPrice, 0, len(priceContents))
+	for _, row := range priceContents {
+		rowContents := row.FindAll("span")
+		if len(rowContents) < 7 {
+			return nil, newParseError("Invalid row of %s: %d columns", stockID, len(rowContents))
+		}
+		price := structs.StockPrice{StockID: stockID}
+		var errs [6]error
+		price.Timestamp, errs[0] = commons.ParseTimestamp(dateFormat, rowContents[0].Text())
+		price.Close, errs[1] = commons.ParseInt(rowContents[1].Text())
+		price.Open, errs[2] = commons.ParseInt(rowContents[3].Text())
+		price.High, errs[3] = commons.ParseInt(rowContents[4].Text())
+		price.Low, errs[4] = commons.ParseInt(rowContents[5].Text())
+		price.Volume, errs[5] = commons.ParseDouble(rowContents[6].Text())
+		for _, err := range errs {
+			if err != nil {
+				return nil, newParseError("Invalid row of %s: %v", stockID, err)
+			}
+		}
+		result = append(result, price)
+	}
+	return result, nil
+}
+
+// parseNaverIndexChart parses the daily prices of the index from the chart API, most recent first
+// Each item is like <item data="20200102|2201.21|2202.32|2171.84|2175.17|494692" />: 날짜, 시가, 고가, 저가, 종가, 거래량
+func parseNaverIndexChart(stockID, raw string) ([]StockPrice, error) {
+	var chart struct {
+		Items []struct {
+			Data string `xml:"data,attr"`
+		} `xml:"chartdata>item"`
+	}
+	decoder := xml.NewDecoder(strings.NewReader(raw))
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		if strings.EqualFold(charset, "euc-kr") {
+			return transform.NewReader(input, korean.EUCKR.NewDecoder()), nil
+		}
+		return input, nil
+	}
+	if err := decoder.Decode(&chart); err != nil {
+		return nil, newParseError("Invalid chart of %s: %v", stockID, err)
+	}
+	result := make([]StockPrice, 0, len(chart.Items))
+	for i := len(chart.Items) - 1; i >= 0; i-- {
+		fields := strings.Split(chart.Items[i].Data, "|")
+		if len(fields) < 6 {
+			return nil, newParseError("Invalid item of %s: %s", stockID, chart.Items[i].Data)
+		}
+		price := structs.StockPrice{StockID: stockID}
+		var values [4]float64
+		var errs [6]error
+		price.Timestamp, errs[0] = commons.ParseTimestamp("20060102", fields[0])
+		for k := range values {
+			values[k], errs[k+1] = commons.ParseDouble(fields[k+1])
+		}
+		price.Volume, errs[5] = commons.ParseDouble(fields[5])
+		for _, err := range errs {
+			if err != nil {
+				return nil, newParseError("Invalid item of %s: %v", stockID, err)
+			}
+		}
+		price.Open = int(math.Round(values[0] * structs.IndexPriceScale))
+		price.High = int(math.Round(values[1] * structs.IndexPriceScale))
+		price.Low = int(math.Round(values[2] * structs.IndexPriceScale))
+		price.Close = int(math.Round(values[3] * structs.IndexPriceScale))
+		result = append(result, price)
+	}
+	return result, nil
+}
+
+// parseNaverIntraday parses the minute prices of the day from sise_time.nhn
+// Columns: 체결시각, 체결가, 전일비, 매도, 매수, 거래량, 변동량
+func parseNaverIntraday(stockID string, day time.Time, html string) ([]StockPrice, error) {
+	root := soup.HTMLParse(html)
+	if root.Pointer == nil {
+		return nil, newParseError("Invalid HTML of %s: %+v", stockID, root.Error)
+	}
+	table, err := findSoup(root, "table", "class", "type2")
+	if err != nil {
+		return nil, err
+	}
+
+	y, m, d := day.Date()
+	var result []StockPrice
+	for _, row := range table.FindAll("tr", "onmouseover", "mouseOver(this)") {
+		rowContents := row.FindAll("span")
+		if len(rowContents) < 7 {
+			continue
+		}
+		clock, err := time.Parse(intradayTimeFormat, strings.TrimSpace(rowContents[0].Text()))
+		if err != nil {
+			continue
+		}
+		price, err := commons.ParseInt(rowContents[1].Text())
+		if err != nil {
+			return nil, newParseError("Invalid price of %s: %v", stockID, err)
+		}
+		// 변동량이 아니라 당일 누적 거래량
+		volume, err := commons.ParseDouble(rowContents[5].Text())
+		if err != nil {
+			return nil, newParseError("Invalid volume of %s: %v", stockID, err)
+		}
+		result = append(result, structs.StockPrice{
+			StockID:   stockID,
+			Timestamp: time.Date(y, m, d, clock.Hour(), clock.Minute(), 0, 0, commons.AsiaSeoul).Unix(),
+			Open:      price,
+			Close:     price,
+			High:      price,
+			Low:       price,
+			Volume:    volume,
+		})
+	}
+	return result, nil
+}
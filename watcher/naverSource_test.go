@@ -0,0 +1,218 @@
+package watcher
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/helloworldpark/tickle-stock-watcher/commons"
+)
+
+const naverQuoteFixture = `<html><body><div id="chart_area"><div class="rate_info"><div class="today">
+<p class="no_today"><em class="no_up"><span class="blind">56,300</span></em></p>
+</div>
+<table class="no_info"><tbody>
+<tr><td class="first"><span class="sptxt sp_txt2">전일</span><em class="no_up"><span class="blind">54,500</span></em></td>
+<td><span class="sptxt sp_txt4">고가</span><em class="no_up"><span class="blind">56,800</span></em>
+<span class="sptxt sp_txt5">상한가</span><em><span class="blind">70,800</span></em></td>
+<td><span class="sptxt sp_txt9">거래량</span><em><span class="blind">19,749,457</span></em></td></tr>
+<tr><td class="first"><span class="sptxt sp_txt3">시가</span><em><span class="blind">55,000</span></em></td>
+<td><span class="sptxt sp_txt5">저가</span><em><span class="blind">54,900</span></em>
+<span class="sptxt sp_txt6">하한가</span><em><span class="blind">38,200</span></em></td>
+<td><span class="sptxt sp_txt10">거래대금</span><em><span class="blind">1,108,127</span></em></td></tr>
+</tbody></table>
+</div></div></body></html>`
+
+const naverDailyFixture = `<html><body><table class="type2"><tbody>
+<tr><th>날짜</th><th>종가</th></tr>
+<tr onmouseover="mouseOver(this)"><td><span>2020.01.31</span></td><td><span>56,400</span></td><td><span>1,800</span></td>
+<td><span>57,800</span></td><td><span>58,400</span></td><td><span>56,400</span></td><td><span>19,749,457</span></td></tr>
+<tr onmouseover="mouseOver(this)"><td><span>2020.01.30</span></td><td><span>58,200</span></td><td><span>1,600</span></td>
+<td><span>58,800</span></td><td><span>58,800</span></td><td><span>56,800</span></td><td><span>20,880,351</span></td></tr>
+</tbody></table></body></html>`
+
+const naverIntradayFixture = `<html><body><table class="type2">
+<tr onmouseover="mouseOver(this)"><td><span>15:30</span></td><td><span>56,400</span></td><td><span>1,800</span></td>
+<td><span>56,400</span></td><td><span>56,300</span></td><td><span>19,749,457</span></td><td><span>1,215</span></td></tr>
+<tr onmouseover="mouseOver(this)"><td><span>15:19</span></td><td><span>56,300</span></td><td><span>1,900</span></td>
+<td><span>56,400</span></td><td><span>56,300</span></td><td><span>18,749,457</span></td><td><span>3,000</span></td></tr>
+</table></body></html>`
+
+func TestParseNaverQuote(t *testing.T) {
+	price, err := parseNaverQuote("005930", naverQuoteFixture, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := StockPrice{
+		StockID:   "005930",
+		Timestamp: 100,
+		Open:      55000,
+		Close:     56300,
+		High:      56800,
+		Low:       54900,
+		Volume:    19749457,
+		Change:    1800,
+	}
+	if price != expected {
+		t.Errorf("Unexpected quote: %+v", price)
+	}
+
+	if _, err := parseNaverQuote("005930", "<html><body></body></html>", 100); err == nil {
+		t.Error("Quote without price must fail")
+	}
+}
+
+const naverPollingFixture = `{"resultCode":"success","result":{"pollingInterval":7000,"areas":[{"name":"SERVICE_ITEM","datas":[
+{"cd":"005930","nm":"삼성전자","sv":54500,"nv":56300,"cv":1800,"cr":3.3,"rf":"2","ov":55000,"hv":56800,"lv":54900,"aq":19749457},
+{"cd":"000660","nm":"SK하이닉스","sv":99000,"nv":98000,"cv":1000,"cr":1.01,"rf":"5","ov":99500,"hv":100000,"lv":97500,"aq":3126452}
+]}],"time":1580454000000}}`
+
+func TestParseNaverPolling(t *testing.T) {
+	quotes, err := parseNaverPolling([]byte(naverPollingFixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := StockPrice{
+		StockID:   "005930",
+		Timestamp: 1580454000,
+		Open:      55000,
+		Close:     56300,
+		High:      56800,
+		Low:       54900,
+		Volume:    19749457,
+		Change:    1800,
+	}
+	if len(quotes) != 2 || quotes["005930"] != expected {
+		t.Errorf("Unexpected quotes: %+v", quotes)
+	}
+	if change := quotes["000660"].Change; change != -1000 {
+		t.Errorf("Expected change -1000, got %d", change)
+	}
+
+	if _, err := parseNaverPolling([]byte(`{"resultCode":"fail"}`)); err == nil {
+		t.Error("Failed polling must fail")
+	}
+}
+
+func TestParseNaverDailyHistory(t *testing.T) {
+	prices, err := parseNaverDailyHistory("005930", naverDailyFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prices) != 2 {
+		t.Fatalf("Expected 2 prices, got %d", len(prices))
+	}
+	expected := StockPrice{
+		StockID:   "005930",
+		Timestamp: commons.GetTimestamp(dateFormat, "2020.01.31"),
+		Open:      57800,
+		Close:     56400,
+		High:      58400,
+		Low:       56400,
+		Volume:    19749457,
+	}
+	if prices[0] != expected {
+		t.Errorf("Expected %+v, got %+v", expected, prices[0])
+	}
+}
+
+func TestParseNaverIntraday(t *testing.T) {
+	day := time.Date(2020, time.January, 31, 0, 0, 0, 0, commons.AsiaSeoul)
+	bars, err := parseNaverIntraday("005930", day, naverIntradayFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bars) != 2 {
+		t.Fatalf("Expected 2 bars, got %d", len(bars))
+	}
+	if expected := time.Date(2020, time.January, 31, 15, 19, 0, 0, commons.AsiaSeoul).Unix(); bars[1].Timestamp != expected {
+		t.Errorf("Expected timestamp %d, got %d", expected, bars[1].Timestamp)
+	}
+	if bars[1].Close != 56300 || bars[1].Volume != 18749457 {
+		t.Errorf("Unexpected bar: %+v", bars[1])
+	}
+}
+
+// fixtureTransport answers every request with the same page, like Naver past the last page
+type fixtureTransport struct {
+	body     string
+	requests int
+}
+
+func (t *fixtureTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.requests++
+	return &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Body: ioutil.NopCloser(strings.NewReader(t.body)), Request: r}, nil
+}
+
+func TestNaverIntradayBarsRepeatedPage(t *testing.T) {
+	transport := &fixtureTransport{body: naverIntradayFixture}
+	f := newTestFetcher()
+	f.client = &http.Client{Transport: transport}
+	source := &naverSource{fetcher: f, indexCharts: make(map[string]indexChart), mutex: &sync.Mutex{}}
+
+	bars, err := source.IntradayBars("005930", time.Date(2020, time.January, 31, 0, 0, 0, 0, commons.AsiaSeoul))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bars) != 2 || transport.requests != 2 {
+		t.Errorf("Expected to stop at the repeated page, got %d bars after %d requests", len(bars), transport.requests)
+	}
+}
+
+const naverIndexPollingFixture = `{"resultCode":"success","result":{"pollingInterval":7000,"areas":[{"name":"SERVICE_INDEX","datas":[
+{"cd":"KOSPI","nm":"코스피","sv":214871,"nv":211996,"cv":-2875,"cr":-1.34,"rf":"5","ov":214512,"hv":215094,"lv":211925,"aq":623215}
+]}],"time":1580454000000}}`
+
+const naverIndexChartFixture = `<?xml version="1.0" encoding="EUC-KR" ?>
+<protocol>
+	<chartdata symbol="KOSPI" name="KOSPI" count="2" timeframe="day" precision="2" origintime="19900103">
+		<item data="20200130|2148.71|2152.38|2139.21|2148.00|663024" />
+		<item data="20200131|2145.12|2150.94|2119.25|2119.01|623215" />
+	</chartdata>
+</protocol>`
+
+func TestParseNaverIndex(t *testing.T) {
+	quotes, err := parseNaverPolling([]byte(naverIndexPollingFixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := StockPrice{
+		StockID:   "KOSPI",
+		Timestamp: 1580454000,
+		Open:      214512,
+		Close:     211996,
+		High:      215094,
+		Low:       211925,
+		Volume:    623215,
+		Change:    -2875,
+	}
+	if quotes["KOSPI"] != expected {
+		t.Errorf("Expected %+v, got %+v", expected, quotes["KOSPI"])
+	}
+
+	prices, err := parseNaverIndexChart("KOSPI", naverIndexChartFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prices) != 2 {
+		t.Fatalf("Expected 2 prices, got %d", len(prices))
+	}
+	expected = StockPrice{
+		StockID:   "KOSPI",
+		Timestamp: commons.GetTimestamp("20060102", "20200131"),
+		Open:      214512,
+		Close:     211901,
+		High:      215094,
+		Low:       211925,
+		Volume:    623215,
+	}
+	if prices[0] != expected {
+		t.Errorf("Most recent first: expected %+v, got %+v", expected, prices[0])
+	}
+	if _, err := parseNaverIndexChart("KOSPI", `<protocol><chartdata><item data="20200131|1" /></chartdata></protocol>`); err == nil {
+		t.Error("Invalid item must fail")
+	}
+}
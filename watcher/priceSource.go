@@ -0,0 +1,25 @@
+package watcher
+
+import "time"
+
+// PriceSource provides prices of stocks to Watcher
+type PriceSource interface {
+	// Name of the source, i.e. naver
+	Name() string
+	// Quote intraday snapshot of the stock: open, high, low and volume of the day so far, current price as close
+	Quote(stockID string) (StockPrice, error)
+	// DailyHistory daily prices of the stock on page, starting from 1, most recent first.
+	// Empty if there are no more pages.
+	DailyHistory(stockID string, page int) ([]StockPrice, error)
+	// IntradayBars minute bars of the stock on the day, ordered by time, with the volume of the day so far like Quote
+	IntradayBars(stockID string, day time.Time) ([]StockPrice, error)
+}
+
+// BatchPriceSource is a PriceSource which can quote many stocks in a request
+type BatchPriceSource interface {
+	PriceSource
+	// MaxBatchSize maximum number of stocks quoted in a request
+	MaxBatchSize() int
+	// Quotes intraday snapshots of the stocks, Key: Stock ID. Stocks without a quote are left out.
+	Quotes(stockIDs []string) (map[string]StockPrice, error)
+}
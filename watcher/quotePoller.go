@@ -0,0 +1,224 @@
+package watcher
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/helloworldpark/tickle-stock-watcher/commons"
+	"github.com/helloworldpark/tickle-stock-watcher/logger"
+)
+
+// defaultQuoteBudget requests per minute for quotes of every watched stock
+const defaultQuoteBudget = 60
+
+// requestBudget is a token bucket limiting the number of requests
+type requestBudget struct {
+	capacity float64
+	tokens   float64
+	perSec   float64
+	last     time.Time
+	now      func() time.Time
+}
+
+func newRequestBudget(perMinute int) *requestBudget {
+	return &requestBudget{
+		capacity: float64(perMinute),
+		tokens:   float64(perMinute),
+		perSec:   float64(perMinute) / 60,
+		now:      time.Now,
+	}
+}
+
+// take takes a token if available
+func (b *requestBudget) take() bool {
+	now := b.now()
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.perSec
+		if b.tokens > b.capacity {
+			b.tokens = b.capacity
+		}
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// quotePoller polls quotes of every subscribed stock together, batching them if the source allows,
+// and fans them out to the subscribers
+type quotePoller struct {
+	source      PriceSource
+	interval    time.Duration
+	jitter      time.Duration // Maximum delay before the first poll
+	budget      *requestBudget
+	subscribers map[string][]chan StockPrice // Key: Stock ID, Value: a feed for each subscription, holding only the latest quote
+	offset      int                          // Where to start polling, so that deferred stocks are polled first
+	running     bool
+	requests    int64 // Statistics
+	deferred    int64
+	mutex       *sync.Mutex
+}
+
+func newQuotePoller(source PriceSource, interval time.Duration, budgetPerMinute int) *quotePoller {
+	return &quotePoller{
+		source:      source,
+		interval:    interval,
+		budget:      newRequestBudget(budgetPerMinute),
+		subscribers: make(map[string][]chan StockPrice),
+		mutex:       &sync.Mutex{},
+	}
+}
+
+// batchSize number of stocks quoted in a request
+func (p *quotePoller) batchSize() int {
+	if batch, ok := p.source.(BatchPriceSource); ok && batch.MaxBatchSize() > 1 {
+		return batch.MaxBatchSize()
+	}
+	return 1
+}
+
+// subscribe starts polling the stock, starting the poller if needed.
+// Each subscription has its own feed, polled until unsubscribed.
+func (p *quotePoller) subscribe(stockID string) <-chan StockPrice {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	feed := make(chan StockPrice, 1)
+	p.subscribers[stockID] = append(p.subscribers[stockID], feed)
+	if !p.running {
+		p.running = true
+		commons.InvokeGoroutine("Watcher_quotePoller_run", p.run)
+	}
+	return feed
+}
+
+// unsubscribe cancels the subscription of the feed, and stops polling the stock if no other subscription is left.
+// The poller stops when nothing is subscribed.
+func (p *quotePoller) unsubscribe(stockID string, feed <-chan StockPrice) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	feeds := p.subscribers[stockID]
+	for i := range feeds {
+		if feeds[i] == feed {
+			feeds = append(feeds[:i:i], feeds[i+1:]...)
+			break
+		}
+	}
+	if len(feeds) == 0 {
+		delete(p.subscribers, stockID)
+	} else {
+		p.subscribers[stockID] = feeds
+	}
+}
+
+func (p *quotePoller) run() {
+	if p.jitter > 0 {
+		time.Sleep(time.Duration(rand.Int63n(int64(p.jitter))))
+	}
+	p.mutex.Lock()
+	interval := p.interval
+	p.mutex.Unlock()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !p.poll() {
+			logger.Info("[Watcher] Stop polling quotes: nothing to watch")
+			return
+		}
+	}
+}
+
+// poll polls quotes of the subscribed stocks within the budget, returns false if nothing is subscribed
+func (p *quotePoller) poll() bool {
+	p.mutex.Lock()
+	stockIDs := make([]string, 0, len(p.subscribers))
+	for stockID := range p.subscribers {
+		stockIDs = append(stockIDs, stockID)
+	}
+	if len(stockIDs) == 0 {
+		p.running = false
+		p.mutex.Unlock()
+		return false
+	}
+	sort.Strings(stockIDs)
+	offset := p.offset % len(stockIDs)
+	stockIDs = append(stockIDs[offset:], stockIDs[:offset]...)
+	p.mutex.Unlock()
+
+	size := p.batchSize()
+	for i := 0; i < len(stockIDs); i += size {
+		batch := stockIDs[i:commons.MinInt(i+size, len(stockIDs))]
+		p.mutex.Lock()
+		allowed := p.budget.take()
+		if !allowed {
+			p.offset = offset + i
+			p.deferred += int64(len(stockIDs) - i)
+		} else {
+			p.requests++
+		}
+		p.mutex.Unlock()
+		if !allowed {
+			logger.Warn("[Watcher] Quote budget exhausted: %d stocks deferred to the next poll", len(stockIDs)-i)
+			return true
+		}
+		for _, quote := range p.quotes(batch) {
+			p.deliver(quote)
+		}
+	}
+	p.mutex.Lock()
+	p.offset = 0
+	p.mutex.Unlock()
+	return true
+}
+
+// quotes quotes of the stocks in a request if the source allows, skipping failed ones
+func (p *quotePoller) quotes(stockIDs []string) []StockPrice {
+	if batch, ok := p.source.(BatchPriceSource); ok {
+		quotes, err := batch.Quotes(stockIDs)
+		if err != nil {
+			logger.Error("[Watcher] Error while getting quotes of %v from %s: %+v", stockIDs, p.source.Name(), err)
+			return nil
+		}
+		result := make([]StockPrice, 0, len(quotes))
+		for _, stockID := range stockIDs {
+			if quote, ok := quotes[stockID]; ok {
+				result = append(result, quote)
+			}
+		}
+		return result
+	}
+	var result []StockPrice
+	for _, stockID := range stockIDs {
+		quote, err := p.source.Quote(stockID)
+		if err != nil {
+			logger.Error("[Watcher] Error while getting quote of %s from %s: %+v", stockID, p.source.Name(), err)
+			continue
+		}
+		result = append(result, quote)
+	}
+	return result
+}
+
+// deliver replaces the quote not taken yet by each subscriber with the latest one
+func (p *quotePoller) deliver(quote StockPrice) {
+	p.mutex.Lock()
+	feeds := append([]chan StockPrice(nil), p.subscribers[quote.StockID]...)
+	p.mutex.Unlock()
+	for _, feed := range feeds {
+	replace:
+		for {
+			select {
+			case feed <- quote:
+				break replace
+			default:
+				select {
+				case <-feed:
+				default:
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package watcher
+
+import (
+	"testing"
+	"time"
+)
+
+// countingSource quotes every stock at the price 100, counting requests
+type countingSource struct {
+	*ReplaySource
+	batchSize int
+	requests  [][]string
+}
+
+func (s *countingSource) MaxBatchSize() int {
+	return s.batchSize
+}
+
+func (s *countingSource) Quotes(stockIDs []string) (map[string]StockPrice, error) {
+	s.requests = append(s.requests, append([]string(nil), stockIDs...))
+	quotes := make(map[string]StockPrice)
+	for _, stockID := range stockIDs {
+		quotes[stockID] = StockPrice{StockID: stockID, Close: 100}
+	}
+	return quotes, nil
+}
+
+func TestQuotePollerBatches(t *testing.T) {
+	source := &countingSource{ReplaySource: NewReplaySource(1), batchSize: 2}
+	p := newQuotePoller(source, time.Hour, 60)
+	p.running = true // 테스트에서는 직접 poll한다
+	feeds := make(map[string]<-chan StockPrice)
+	for _, stockID := range []string{"000660", "005930", "035420", "051910", "068270"} {
+		feeds[stockID] = p.subscribe(stockID)
+	}
+
+	p.poll()
+	if len(source.requests) != 3 {
+		t.Fatalf("Expected 3 requests for 5 stocks, got %v", source.requests)
+	}
+	for stockID, feed := range feeds {
+		select {
+		case quote := <-feed:
+			if quote.StockID != stockID {
+				t.Errorf("Expected quote of %s, got %+v", stockID, quote)
+			}
+		default:
+			t.Errorf("No quote of %s", stockID)
+		}
+	}
+
+	// 받아가지 않은 시세는 최신 것으로 바뀐다
+	p.poll()
+	p.poll()
+	if len(feeds["005930"]) != 1 {
+		t.Errorf("Expected only the latest quote, got %d", len(feeds["005930"]))
+	}
+}
+
+func TestQuotePollerBudget(t *testing.T) {
+	source := &countingSource{ReplaySource: NewReplaySource(1), batchSize: 2}
+	p := newQuotePoller(source, time.Hour, 2)
+	now := time.Date(2020, 1, 31, 9, 0, 0, 0, time.UTC)
+	p.budget.now = func() time.Time { return now }
+	p.running = true
+	for _, stockID := range []string{"000660", "005930", "035420", "051910", "068270"} {
+		p.subscribe(stockID)
+	}
+
+	p.poll()
+	if len(source.requests) != 2 || p.deferred != 1 {
+		t.Fatalf("Expected 2 requests and 1 deferred stock, got %v, %d", source.requests, p.deferred)
+	}
+
+	// 미뤄진 종목부터 다시 받는다
+	now = now.Add(30 * time.Second)
+	p.poll()
+	if len(source.requests) != 3 || source.requests[2][0] != "068270" {
+		t.Fatalf("Expected the deferred stock first, got %v", source.requests)
+	}
+}
+
+func TestQuotePollerSubscriptions(t *testing.T) {
+	source := &countingSource{ReplaySource: NewReplaySource(1), batchSize: 2}
+	p := newQuotePoller(source, time.Hour, 60)
+	p.running = true
+	old := p.subscribe("005930")
+	feed := p.subscribe("005930")
+
+	// 먼저 구독한 쪽이 그만두어도 나중에 구독한 쪽은 계속 받는다
+	p.unsubscribe("005930", old)
+	p.poll()
+	if len(feed) != 1 || len(old) != 0 {
+		t.Fatalf("Expected the quote only to the remaining subscription, got %d and %d", len(feed), len(old))
+	}
+
+	p.unsubscribe("005930", feed)
+	if p.poll() {
+		t.Error("Expected to stop polling without subscriptions")
+	}
+}
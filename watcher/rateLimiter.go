@@ -0,0 +1,115 @@
+package watcher
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultRequestsPerSecond requests per second to a host, unless configured otherwise
+const defaultRequestsPerSecond = 2.0
+
+// hostLimit schedule and statistics of requests to a host
+type hostLimit struct {
+	next      time.Time // When the next request may be sent
+	waiting   int       // Requests waiting for their turn
+	requests  int64
+	throttled int64 // Requests which had to wait
+}
+
+// rateLimiter spaces requests to each host evenly, so that no host gets more than its requests per second.
+// Non-positive requests per second means no limit.
+type rateLimiter struct {
+	perSecond float64
+	hostRates map[string]float64 // Key: host, Value: requests per second overriding perSecond
+	hosts     map[string]*hostLimit
+	now       func() time.Time
+	sleep     func(time.Duration)
+	mutex     *sync.Mutex
+}
+
+func newRateLimiter(perSecond float64) *rateLimiter {
+	return &rateLimiter{
+		perSecond: perSecond,
+		hostRates: make(map[string]float64),
+		hosts:     make(map[string]*hostLimit),
+		now:       time.Now,
+		sleep:     time.Sleep,
+		mutex:     &sync.Mutex{},
+	}
+}
+
+// SetRequestsPerSecond sets requests per second to each host for every request in watcher
+func SetRequestsPerSecond(perSecond float64) {
+	defaultFetcher.limiter.mutex.Lock()
+	defer defaultFetcher.limiter.mutex.Unlock()
+	defaultFetcher.limiter.perSecond = perSecond
+}
+
+// SetHostRequestsPerSecond sets requests per second to the host, i.e. finance.naver.com
+func SetHostRequestsPerSecond(host string, perSecond float64) {
+	defaultFetcher.limiter.mutex.Lock()
+	defer defaultFetcher.limiter.mutex.Unlock()
+	defaultFetcher.limiter.hostRates[host] = perSecond
+}
+
+// interval between requests to the host, 0 if not limited
+func (l *rateLimiter) interval(host string) time.Duration {
+	perSecond, ok := l.hostRates[host]
+	if !ok {
+		perSecond = l.perSecond
+	}
+	if perSecond <= 0 {
+		return 0
+	}
+	return time.Duration(float64(time.Second) / perSecond)
+}
+
+// wait blocks until the request to the host can be sent
+func (l *rateLimiter) wait(host string) {
+	l.mutex.Lock()
+	limit, ok := l.hosts[host]
+	if !ok {
+		limit = &hostLimit{}
+		l.hosts[host] = limit
+	}
+	now := l.now()
+	slot := now
+	if limit.next.After(now) {
+		slot = limit.next
+	}
+	limit.next = slot.Add(l.interval(host))
+	limit.requests++
+	delay := slot.Sub(now)
+	if delay > 0 {
+		limit.throttled++
+		limit.waiting++
+	}
+	l.mutex.Unlock()
+
+	if delay <= 0 {
+		return
+	}
+	l.sleep(delay)
+	l.mutex.Lock()
+	limit.waiting--
+	l.mutex.Unlock()
+}
+
+// description queue depth and throttling counts of each host
+func (l *rateLimiter) description() []string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	hosts := make([]string, 0, len(l.hosts))
+	for host := range l.hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	lines := []string{fmt.Sprintf("Rate Limit: %v requests per second per host", l.perSecond)}
+	for _, host := range hosts {
+		limit := l.hosts[host]
+		lines = append(lines, fmt.Sprintf("    %s: Interval %v, Queue %d, Throttled %d/%d", host, l.interval(host), limit.waiting, limit.throttled, limit.requests))
+	}
+	return lines
+}
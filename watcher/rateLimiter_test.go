@@ -0,0 +1,42 @@
+package watcher
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2020, 1, 31, 9, 0, 0, 0, time.UTC)
+	var delays []time.Duration
+	l := newRateLimiter(2)
+	l.now = func() time.Time { return now }
+	l.sleep = func(d time.Duration) { delays = append(delays, d) }
+	l.hostRates["fast.example.com"] = 0
+
+	// 같은 호스트는 0.5초 간격으로 순서대로 보낸다
+	for i := 0; i < 3; i++ {
+		l.wait("finance.naver.com")
+	}
+	expected := []time.Duration{500 * time.Millisecond, time.Second}
+	if len(delays) != 2 || delays[0] != expected[0] || delays[1] != expected[1] {
+		t.Fatalf("Expected delays %v, got %v", expected, delays)
+	}
+
+	// 다른 호스트나 제한 없는 호스트는 기다리지 않는다
+	l.wait("open.krx.co.kr")
+	l.wait("fast.example.com")
+	l.wait("fast.example.com")
+	if len(delays) != 2 {
+		t.Fatalf("Expected no more delays, got %v", delays)
+	}
+
+	// 시간이 지나면 다시 바로 보낸다
+	now = now.Add(2 * time.Second)
+	l.wait("finance.naver.com")
+	if len(delays) != 2 {
+		t.Fatalf("Expected no delay after idle, got %v", delays)
+	}
+	if limit := l.hosts["finance.naver.com"]; limit.requests != 4 || limit.throttled != 2 || limit.waiting != 0 {
+		t.Errorf("Unexpected statistics: %+v", limit)
+	}
+}
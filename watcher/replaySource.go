@@ -0,0 +1,423 @@
+package watcher
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/helloworldpark/tickle-stock-watcher/commons"
+)
+
+const (
+	replayPageSize        = 10 // Same as sise_day.nhn
+	replayTimestampFormat = "2006-01-02 15:04:05"
+)
+
+// ReplaySource replays recorded prices instead of scraping.
+// Quotes follow a replay clock which starts at the first tick and runs speed times faster than the wall clock.
+type ReplaySource struct {
+	ticks  map[string][]StockPrice // Key: Stock ID, ordered by timestamp
+	quotes map[string][]StockPrice // Key: Stock ID, recorded intraday snapshots ordered by timestamp
+	daily  map[string][]StockPrice // Key: Stock ID, most recent first
+	speed  float64
+	origin int64     // Timestamp of the replay clock when started
+	start  time.Time // Wall clock when started
+	now    func() time.Time
+	mutex  *sync.Mutex
+}
+
+// NewReplaySource creates an empty ReplaySource running speed times faster than the wall clock
+func NewReplaySource(speed float64) *ReplaySource {
+	if speed <= 0 {
+		speed = 1
+	}
+	return &ReplaySource{
+		ticks:  make(map[string][]StockPrice),
+		quotes: make(map[string][]StockPrice),
+		daily:  make(map[string][]StockPrice),
+		speed:  speed,
+		now:    time.Now,
+		mutex:  &sync.Mutex{},
+	}
+}
+
+// NewReplaySourceFromPath creates a ReplaySource from a CSV or JSON file of ticks, or a directory of fixtures
+func NewReplaySourceFromPath(path string, speed float64) (*ReplaySource, error) {
+	source := NewReplaySource(speed)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		err = source.LoadFixtures(path)
+	} else {
+		err = source.loadTicksFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return source, nil
+}
+
+func (s *ReplaySource) Name() string {
+	return "replay"
+}
+
+// Start starts the replay clock from origin, a timestamp
+func (s *ReplaySource) Start(origin int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.origin = origin
+	s.start = s.now()
+}
+
+// replayTimestamp timestamp of the replay clock, starting it at the first tick if not started yet
+func (s *ReplaySource) replayTimestamp() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.start.IsZero() {
+		s.start = s.now()
+		s.origin = 0
+		for _, recorded := range []map[string][]StockPrice{s.ticks, s.quotes} {
+			for _, ticks := range recorded {
+				if len(ticks) > 0 && (s.origin == 0 || ticks[0].Timestamp < s.origin) {
+					s.origin = ticks[0].Timestamp
+				}
+			}
+		}
+	}
+	elapsed := float64(s.now().Sub(s.start)) * s.speed
+	return s.origin + int64(elapsed/float64(time.Second))
+}
+
+// Now time of the replay clock, starting it at the first tick if not started yet
+func (s *ReplaySource) Now() time.Time {
+	return commons.Unix(s.replayTimestamp())
+}
+
+// lastBefore number of the prices at or before the timestamp
+func lastBefore(prices []StockPrice, timestamp int64) int {
+	return sort.Search(len(prices), func(i int) bool {
+		return prices[i].Timestamp > timestamp
+	})
+}
+
+// Quote the intraday snapshot of the stock at the replay clock.
+// Recorded snapshots are replayed as they are, otherwise the snapshot is assembled from the ticks of the day.
+func (s *ReplaySource) Quote(stockID string) (StockPrice, error) {
+	now := s.replayTimestamp()
+	if quotes := s.quotes[stockID]; len(quotes) > 0 {
+		k := lastBefore(quotes, now)
+		if k == 0 {
+			return StockPrice{}, newError(fmt.Sprintf("No quotes of %s until %v", stockID, commons.Unix(now)))
+		}
+		return quotes[k-1], nil
+	}
+
+	ticks := s.ticks[stockID]
+	k := lastBefore(ticks, now)
+	if k == 0 {
+		return StockPrice{}, newError(fmt.Sprintf("No ticks of %s until %v", stockID, commons.Unix(now)))
+	}
+	last := ticks[k-1]
+	y, m, d := commons.Unix(last.Timestamp).Date()
+	dayStart := time.Date(y, m, d, 0, 0, 0, 0, commons.AsiaSeoul).Unix()
+	from := lastBefore(ticks, dayStart-1)
+
+	snapshot := ticks[from]
+	snapshot.Timestamp = last.Timestamp
+	snapshot.Close = last.Close
+	for _, tick := range ticks[from+1 : k] {
+		snapshot.High = commons.MaxInt(snapshot.High, tick.High)
+		snapshot.Low = commons.MinInt(snapshot.Low, tick.Low)
+		snapshot.Volume += tick.Volume
+	}
+	if prevClose := s.closeBefore(stockID, dayStart); prevClose > 0 {
+		snapshot.Change = snapshot.Close - prevClose
+	}
+	return snapshot, nil
+}
+
+// MaxBatchSize replays are local, so no limit in practice
+func (s *ReplaySource) MaxBatchSize() int {
+	return 100
+}
+
+// Quotes intraday snapshots of the stocks at the replay clock
+func (s *ReplaySource) Quotes(stockIDs []string) (map[string]StockPrice, error) {
+	quotes := make(map[string]StockPrice)
+	for _, stockID := range stockIDs {
+		if quote, err := s.Quote(stockID); err == nil {
+			quotes[stockID] = quote
+		}
+	}
+	return quotes, nil
+}
+
+// closeBefore last close of the stock before the timestamp, 0 if unknown
+func (s *ReplaySource) closeBefore(stockID string, timestamp int64) int {
+	ticks := s.ticks[stockID]
+	if k := lastBefore(ticks, timestamp-1); k > 0 {
+		return ticks[k-1].Close
+	}
+	for _, price := range s.daily[stockID] {
+		if price.Timestamp < timestamp {
+			return price.Close
+		}
+	}
+	return 0
+}
+
+// DailyHistory recorded daily prices of the stock, paged like sise_day.nhn
+func (s *ReplaySource) DailyHistory(stockID string, page int) ([]StockPrice, error) {
+	daily := s.daily[stockID]
+	from := (page - 1) * replayPageSize
+	if page < 1 || from >= len(daily) {
+		return nil, nil
+	}
+	return daily[from:commons.MinInt(from+replayPageSize, len(daily))], nil
+}
+
+// IntradayBars minute bars of the ticks of the stock on the day, with the volume accumulated since the first tick of the day
+func (s *ReplaySource) IntradayBars(stockID string, day time.Time) ([]StockPrice, error) {
+	y, m, d := day.In(commons.AsiaSeoul).Date()
+	from := time.Date(y, m, d, 0, 0, 0, 0, commons.AsiaSeoul).Unix()
+	to := from + 24*60*60
+
+	var bars []StockPrice
+	volume := 0.0
+	for _, tick := range s.ticks[stockID] {
+		if tick.Timestamp < from || tick.Timestamp >= to {
+			continue
+		}
+		volume += tick.Volume
+		minute := tick.Timestamp - tick.Timestamp%60
+		if len(bars) == 0 || bars[len(bars)-1].Timestamp != minute {
+			bar := tick
+			bar.Timestamp = minute
+			bar.Volume = volume
+			bars = append(bars, bar)
+			continue
+		}
+		bar := &bars[len(bars)-1]
+		bar.High = commons.MaxInt(bar.High, tick.High)
+		bar.Low = commons.MinInt(bar.Low, tick.Low)
+		bar.Close = tick.Close
+		bar.Volume = volume
+	}
+	return bars, nil
+}
+
+// AddTicks adds ticks to replay
+func (s *ReplaySource) AddTicks(ticks ...StockPrice) {
+	for _, tick := range ticks {
+		if tick.Open == 0 {
+			tick.Open = tick.Close
+		}
+		if tick.High == 0 {
+			tick.High = commons.MaxInt(tick.Open, tick.Close)
+		}
+		if tick.Low == 0 {
+			tick.Low = commons.MinInt(tick.Open, tick.Close)
+		}
+		s.ticks[tick.StockID] = append(s.ticks[tick.StockID], tick)
+	}
+	for stockID := range s.ticks {
+		ticks := s.ticks[stockID]
+		sort.SliceStable(ticks, func(i, j int) bool {
+			return ticks[i].Timestamp < ticks[j].Timestamp
+		})
+	}
+}
+
+// AddQuotes adds recorded intraday snapshots to replay, such as main.nhn of finance.naver.com
+func (s *ReplaySource) AddQuotes(quotes ...StockPrice) {
+	for _, quote := range quotes {
+		s.quotes[quote.StockID] = append(s.quotes[quote.StockID], quote)
+	}
+	for stockID := range s.quotes {
+		quotes := s.quotes[stockID]
+		sort.SliceStable(quotes, func(i, j int) bool {
+			return quotes[i].Timestamp < quotes[j].Timestamp
+		})
+	}
+}
+
+// AddDailyPrices adds daily prices to be collected
+func (s *ReplaySource) AddDailyPrices(prices ...StockPrice) {
+	for _, price := range prices {
+		s.daily[price.StockID] = append(s.daily[price.StockID], price)
+	}
+	for stockID := range s.daily {
+		daily := s.daily[stockID]
+		sort.SliceStable(daily, func(i, j int) bool {
+			return daily[i].Timestamp > daily[j].Timestamp
+		})
+	}
+}
+
+func (s *ReplaySource) loadTicksFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if strings.HasSuffix(strings.ToLower(path), ".json") {
+		return s.LoadTicksJSON(f)
+	}
+	return s.LoadTicksCSV(f)
+}
+
+// LoadTicksJSON loads ticks written as a JSON array of StockPrice
+func (s *ReplaySource) LoadTicksJSON(r io.Reader) error {
+	var ticks []StockPrice
+	if err := json.NewDecoder(r).Decode(&ticks); err != nil {
+		return err
+	}
+	s.AddTicks(ticks...)
+	return nil
+}
+
+// LoadTicksCSV loads ticks written as CSV with a header.
+// StockID, Timestamp and Close are required, Open, High, Low and Volume are optional.
+// Timestamp is either a unix timestamp or yyyy-mm-dd hh:mm:ss of Asia/Seoul.
+func (s *ReplaySource) LoadTicksCSV(r io.Reader) error {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"stockid", "timestamp", "close"} {
+		if _, ok := columns[name]; !ok {
+			return newError(fmt.Sprintf("Column %s is missing", name))
+		}
+	}
+
+	var ticks []StockPrice
+	for line, record := range records[1:] {
+		field := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+		tick := StockPrice{StockID: field("stockid")}
+		if tick.Timestamp, err = parseReplayTimestamp(field("timestamp")); err != nil {
+			return newError(fmt.Sprintf("Line %d: %v", line+2, err))
+		}
+		for _, v := range []struct {
+			name string
+			dst  *int
+		}{{"open", &tick.Open}, {"high", &tick.High}, {"low", &tick.Low}, {"close", &tick.Close}} {
+			if len(field(v.name)) == 0 {
+				continue
+			}
+			if *v.dst, err = strconv.Atoi(strings.Replace(field(v.name), ",", "", -1)); err != nil {
+				return newError(fmt.Sprintf("Line %d: %v", line+2, err))
+			}
+		}
+		if len(field("volume")) > 0 {
+			if tick.Volume, err = strconv.ParseFloat(strings.Replace(field("volume"), ",", "", -1), 64); err != nil {
+				return newError(fmt.Sprintf("Line %d: %v", line+2, err))
+			}
+		}
+		ticks = append(ticks, tick)
+	}
+	s.AddTicks(ticks...)
+	return nil
+}
+
+func parseReplayTimestamp(value string) (int64, error) {
+	if timestamp, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return timestamp, nil
+	}
+	t, err := time.ParseInLocation(replayTimestampFormat, value, commons.AsiaSeoul)
+	if err != nil {
+		return 0, err
+	}
+	return t.Unix(), nil
+}
+
+// LoadFixtures loads recorded pages of finance.naver.com and tick files in dir, organised by Stock ID
+//     <dir>/<Stock ID>/sise_day_<page>.html     pages of sise_day.nhn
+//     <dir>/<Stock ID>/main_<timestamp>.html    main.nhn recorded at the unix timestamp
+//     <dir>/*.csv, <dir>/*.json                 ticks, see LoadTicksCSV and LoadTicksJSON
+func (s *ReplaySource) LoadFixtures(dir string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if !entry.IsDir() {
+			ext := strings.ToLower(filepath.Ext(entry.Name()))
+			if ext == ".csv" || ext == ".json" {
+				if err := s.loadTicksFile(path); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := s.loadNaverFixtures(entry.Name(), path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *ReplaySource) loadNaverFixtures(stockID, dir string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		var parse func(html string) error
+		switch {
+		case strings.HasPrefix(name, "sise_day_"):
+			parse = func(html string) error {
+				prices, err := parseNaverDailyHistory(stockID, html)
+				s.AddDailyPrices(prices...)
+				return err
+			}
+		case strings.HasPrefix(name, "main_"):
+			timestamp, err := strconv.ParseInt(strings.TrimPrefix(name, "main_"), 10, 64)
+			if err != nil {
+				return newError(fmt.Sprintf("Invalid fixture name: %s", entry.Name()))
+			}
+			parse = func(html string) error {
+				price, err := parseNaverQuote(stockID, html, timestamp)
+				if err == nil {
+					s.AddQuotes(price)
+				}
+				return err
+			}
+		default:
+			continue
+		}
+		raw, err := ioutil.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		if err := parse(string(raw)); err != nil {
+			return newError(fmt.Sprintf("Invalid fixture %s: %v", entry.Name(), err))
+		}
+	}
+	return nil
+}
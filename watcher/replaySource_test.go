@@ -0,0 +1,191 @@
+package watcher
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/helloworldpark/tickle-stock-watcher/commons"
+	"github.com/helloworldpark/tickle-stock-watcher/structs"
+)
+
+const replayTicksFixture = `StockID,Timestamp,Close,Volume
+005930,2020-01-31 09:00:10,56000,100
+005930,2020-01-31 09:00:40,56200,50
+005930,2020-01-31 09:01:05,55900,70
+000660,2020-01-31 09:00:20,95000,10
+`
+
+func newTestReplaySource(t *testing.T) (*ReplaySource, *time.Time) {
+	source := NewReplaySource(60)
+	if err := source.LoadTicksCSV(strings.NewReader(replayTicksFixture)); err != nil {
+		t.Fatal(err)
+	}
+	wallClock := time.Date(2026, time.January, 1, 0, 0, 0, 0, commons.AsiaSeoul)
+	source.now = func() time.Time { return wallClock }
+	return source, &wallClock
+}
+
+func TestReplaySourceQuote(t *testing.T) {
+	source, wallClock := newTestReplaySource(t)
+
+	price, err := source.Quote("005930")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if price.Close != 56000 {
+		t.Errorf("Expected the first tick, got %+v", price)
+	}
+	if _, err := source.Quote("000660"); err == nil {
+		t.Error("Tick in the future must not be quoted")
+	}
+
+	// 60배속이므로 1초 뒤에는 1분이 지나 있다
+	*wallClock = wallClock.Add(time.Second)
+	expected := StockPrice{
+		StockID:   "005930",
+		Timestamp: time.Date(2020, time.January, 31, 9, 1, 5, 0, commons.AsiaSeoul).Unix(),
+		Open:      56000,
+		High:      56200,
+		Low:       55900,
+		Close:     55900,
+		Volume:    220,
+	}
+	if price, _ = source.Quote("005930"); price != expected {
+		t.Errorf("Expected the snapshot at 09:01:05 %+v, got %+v", expected, price)
+	}
+	if price, _ = source.Quote("000660"); price.Close != 95000 {
+		t.Errorf("Expected the tick of 09:00:20, got %+v", price)
+	}
+}
+
+func TestReplaySourceNow(t *testing.T) {
+	source, wallClock := newTestReplaySource(t)
+
+	// 첫 틱에서 시작해 60배속으로 간다
+	if now := source.Now(); !now.Equal(time.Date(2020, time.January, 31, 9, 0, 10, 0, commons.AsiaSeoul)) {
+		t.Errorf("Expected the replay clock at the first tick, got %v", now)
+	}
+	*wallClock = wallClock.Add(time.Second)
+	if now := source.Now(); !now.Equal(time.Date(2020, time.January, 31, 9, 1, 10, 0, commons.AsiaSeoul)) {
+		t.Errorf("Expected the replay clock a minute later, got %v", now)
+	}
+}
+
+func TestReplaySourceIntradayBars(t *testing.T) {
+	source, _ := newTestReplaySource(t)
+	day := time.Date(2020, time.January, 31, 0, 0, 0, 0, commons.AsiaSeoul)
+	bars, err := source.IntradayBars("005930", day)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bars) != 2 {
+		t.Fatalf("Expected 2 bars, got %d", len(bars))
+	}
+	expected := StockPrice{
+		StockID:   "005930",
+		Timestamp: time.Date(2020, time.January, 31, 9, 0, 0, 0, commons.AsiaSeoul).Unix(),
+		Open:      56000,
+		High:      56200,
+		Low:       56000,
+		Close:     56200,
+		Volume:    150,
+	}
+	if bars[0] != expected {
+		t.Errorf("Expected %+v, got %+v", expected, bars[0])
+	}
+	// 거래량은 Quote처럼 당일 누적
+	if bars[1].Volume != 220 {
+		t.Errorf("Expected the volume of the day so far, got %+v", bars[1])
+	}
+}
+
+func TestReplaySourceFixtures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	stockDir := filepath.Join(dir, "005930")
+	if err := os.Mkdir(stockDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		filepath.Join(stockDir, "sise_day_1.html"):      naverDailyFixture,
+		filepath.Join(stockDir, "main_1580428800.html"): naverQuoteFixture,
+		filepath.Join(dir, "ticks.csv"):                 replayTicksFixture,
+	}
+	for path, contents := range files {
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	source, err := NewReplaySourceFromPath(dir, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	daily, _ := source.DailyHistory("005930", 1)
+	if len(daily) != 2 || daily[0].Close != 56400 {
+		t.Errorf("Unexpected daily prices: %+v", daily)
+	}
+	if daily, _ = source.DailyHistory("005930", 2); len(daily) != 0 {
+		t.Errorf("Expected no more pages, got %+v", daily)
+	}
+	if ticks := source.ticks["005930"]; len(ticks) != 3 {
+		t.Errorf("Unexpected ticks: %+v", ticks)
+	}
+	if quote, err := source.Quote("005930"); err != nil || quote.Close != 56300 || quote.Change != 1800 {
+		t.Errorf("Expected the recorded quote, got %+v, %v", quote, err)
+	}
+}
+
+func TestWatcherWithReplaySource(t *testing.T) {
+	source, _ := newTestReplaySource(t)
+	w := New(nil, source, 10*time.Millisecond)
+	w.SetStartJitter(0)
+	w.crawlers["005930"] = newInternalCrawler(0)
+
+	provider := w.StartWatchingStock("005930")
+	for i := 0; i < 3; i++ {
+		if price := <-provider; price.Close != 56000 {
+			t.Errorf("Expected the first tick, got %+v", price)
+		}
+	}
+	w.StopWatchingStock("005930")
+}
+
+func TestStopWatching(t *testing.T) {
+	source, _ := newTestReplaySource(t)
+	w := New(nil, source, 10*time.Millisecond)
+	w.SetStartJitter(0)
+	// 지수처럼 등록만 하고 감시하지 않는 종목도 있다
+	w.crawlers[structs.IndexKOSPI] = newInternalCrawler(0)
+	w.crawlers["005930"] = newInternalCrawler(0)
+	provider := w.StartWatchingStock("005930")
+	<-provider
+
+	stopped := make(chan struct{})
+	go func() {
+		w.StopWatching()
+		w.StopWatchingStock("005930")
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("StopWatching must not wait for stocks not being watched")
+	}
+	for range provider {
+	}
+
+	// 다시 감시하고 두 번 멈춰도 된다
+	provider = w.StartWatchingStock("005930")
+	provider = w.StartWatchingStock("005930")
+	<-provider
+	w.StopWatchingStock("005930")
+	w.StopWatchingStock("005930")
+}
@@ -8,16 +8,25 @@ import (
 	"golang.org/x/text/transform"
 
 	"github.com/anaskhan96/soup"
+	"github.com/helloworldpark/tickle-stock-watcher/commons"
 	"github.com/helloworldpark/tickle-stock-watcher/database"
 	"github.com/helloworldpark/tickle-stock-watcher/logger"
 	"github.com/helloworldpark/tickle-stock-watcher/structs"
 )
 
+// maxProductsLength products of a stock are cut to fit in the column of the database
+const maxProductsLength = 255
+
+// kindDateLayout layout of the listing date of KIND
+const kindDateLayout = "2006-01-02"
+
 // StockItemChecker is a simple struct holding stock info and a DB client.
 type StockItemChecker struct {
-	stocks    map[string]structs.Stock // Key: Stock ID, Value: Stock
-	invStocks map[string]structs.Stock // Key: Stock Name, Value: Stock
-	dbClient  *database.DBClient
+	stocks     map[string]structs.Stock // Key: Stock ID, Value: Stock
+	invStocks  map[string]structs.Stock // Key: Stock Name, Value: Stock
+	dbClient   *database.DBClient
+	onChange   func(changes []ListingChange)
+	isComplete bool // If every market was downloaded on the last update
 }
 
 // StockAccess Accessor for stock info
@@ -43,6 +52,39 @@ func NewStockItemChecker(dbClient *database.DBClient) *StockItemChecker {
 	return stockAccessGlobal
 }
 
+// NewOfflineStockItemChecker returns a new StockItemChecker with the stocks stored in DB, without downloading from KRX.
+// The list is never complete, so that no stock is regarded as unlisted while offline.
+func NewOfflineStockItemChecker(dbClient *database.DBClient) *StockItemChecker {
+	if stockAccessGlobal == nil {
+		checker := StockItemChecker{
+			stocks:    make(map[string]structs.Stock),
+			invStocks: make(map[string]structs.Stock),
+			dbClient:  dbClient,
+		}
+		checker.loadStocks()
+		stockAccessGlobal = &checker
+	}
+	return stockAccessGlobal
+}
+
+// loadStocks fills the stock info with the market indices and the stocks stored in DB
+func (checker *StockItemChecker) loadStocks() {
+	var stored []structs.Stock
+	if _, err := checker.dbClient.Select(&stored, "where true"); err != nil {
+		logger.Error("[Watcher] Error while reading stock info from database: %s", err.Error())
+	}
+	for _, v := range structs.Indices {
+		checker.stocks[v.StockID] = v
+		checker.invStocks[trimLowerReplace(v.Name)] = v
+		checker.invStocks[trimLowerReplace(v.StockID)] = v
+	}
+	for _, v := range stored {
+		checker.stocks[v.StockID] = v
+		checker.invStocks[trimLowerReplace(v.Name)] = v
+	}
+	logger.Info("[Watcher] Loaded stock info: total %d stock items available", len(stored))
+}
+
 // IsValid checks if the given stock ID exists in the list.
 func (checker *StockItemChecker) IsValid(stockid string) bool {
 	_, ok := checker.stocks[stockid]
@@ -64,44 +106,96 @@ func (checker *StockItemChecker) StockFromName(stockname string) (structs.Stock,
 }
 
 // UpdateStocks updates stock info from the KRX server.
+// Stock info of a market is kept as it was if failed to download.
+// Market indices are always listed, since they are not in the list of KRX.
+// Only if every market is downloaded, stocks no longer listed are removed and the changes are handled.
 func (checker *StockItemChecker) UpdateStocks() {
 	stocksDB := make([]interface{}, 0)
-	kospi := downloadStockSymbols(structs.KOSPI)
-	for _, v := range kospi {
+	details, err := downloadStockDetails()
+	if err != nil {
+		logger.Error("[Watcher] Error while downloading stock details: %s", err.Error())
+	}
+	listed := make([]structs.Stock, 0)
+	isComplete := true
+	for _, source := range listingSources {
+		stocks, err := source.download()
+		if err != nil {
+			logger.Error("[Watcher] Error while downloading stock info of %s: %s", source.name, err.Error())
+			isComplete = false
+			continue
+		}
+		for _, v := range stocks {
+			v = details.fill(v)
+			listed = append(listed, v)
+			stocksDB = append(stocksDB, v)
+		}
+	}
+	if len(stocksDB) == 0 {
+		return
+	}
+	checker.isComplete = isComplete
+
+	var changes []ListingChange
+	if isComplete {
+		// 처음 받아올 때는 비교할 목록이 없다
+		if len(checker.AllStockID()) > 0 {
+			newStocks := make(map[string]structs.Stock)
+			for _, v := range listed {
+				newStocks[v.StockID] = v
+			}
+			changes = diffListings(checker.stocks, newStocks)
+		}
+		checker.stocks = make(map[string]structs.Stock)
+		checker.invStocks = make(map[string]structs.Stock)
+	}
+	for _, v := range structs.Indices {
 		checker.stocks[v.StockID] = v
 		checker.invStocks[trimLowerReplace(v.Name)] = v
-		stocksDB = append(stocksDB, v)
+		checker.invStocks[trimLowerReplace(v.StockID)] = v
 	}
-	kospi = nil
-	kosdaq := downloadStockSymbols(structs.KOSDAQ)
-	for _, v := range kosdaq {
+	for _, v := range listed {
 		checker.stocks[v.StockID] = v
 		checker.invStocks[trimLowerReplace(v.Name)] = v
-		stocksDB = append(stocksDB, v)
 	}
-	kosdaq = nil
-	_, err := checker.dbClient.Upsert(stocksDB...)
+	_, err = checker.dbClient.Upsert(stocksDB...)
 	if err == nil {
 		logger.Info("[Watcher] Updated stock info: total %d stock items available", len(stocksDB))
 	} else {
 		logger.Error("[Watcher] Error while writing stock item info to database: %s", err.Error())
 	}
+
+	if len(changes) == 0 {
+		return
+	}
+	logger.Info("[Watcher] %d stocks changed in the listing: %v", len(changes), changes)
+	if checker.onChange != nil {
+		checker.onChange(changes)
+	}
+}
+
+// IsComplete checks if every market was downloaded on the last update, so that stocks not found are no longer listed
+func (checker *StockItemChecker) IsComplete() bool {
+	return checker.isComplete
 }
 
+// AllStockID stock IDs of every listed stock, except the market indices
 func (checker *StockItemChecker) AllStockID() []string {
 	var result []string
-	for stockID := range checker.stocks {
+	for stockID, stock := range checker.stocks {
+		if stock.MarketType == structs.INDEX {
+			continue
+		}
 		result = append(result, stockID)
 	}
 	return result
 }
 
 // https://minjejeon.github.io/learningstock/2017/09/07/download-krx-ticker-symbols-at-once.html
-func downloadStockSymbols(market structs.Market) []structs.Stock {
+func downloadStockSymbols(market structs.Market) ([]structs.Stock, error) {
 	marketType := map[structs.Market]string{
 		"kospi":  "stockMkt",
 		"kosdaq": "kosdaqMkt",
-		// "konex":  "konexMkt",
+		"konex":  "konexMkt",
 	}
 
 	u := "http://kind.krx.co.kr/corpgeneral/corpList.do?method=download&searchType=13"
@@ -110,30 +204,63 @@ func downloadStockSymbols(market structs.Market) []structs.Stock {
 		u += marketType[market]
 	}
 
-	response, err := soup.Get(u)
+	response, err := defaultFetcher.get(u)
 	if err != nil {
-		logger.Error("[Watcher] %s", err.Error())
-		return nil
+		return nil, err
 	}
+	stocks, err := parseStockSymbols(response, market)
+	return stocks, withURL(err, u)
+}
 
+// parseStockSymbols parses the table of KIND.
+// 회사명, 종목코드, 업종, 주요제품, 상장일, 결산월, 대표자명, 홈페이지, 지역
+func parseStockSymbols(response string, market structs.Market) ([]structs.Stock, error) {
 	symbolHTML := soup.HTMLParse(response)
-	handleSoupError(symbolHTML)
+	if symbolHTML.Error != nil {
+		return nil, newParseError("Invalid HTML: %+v", symbolHTML.Error)
+	}
 
 	table := symbolHTML.Find("table")
-	handleSoupError(table)
+	if table.Error != nil {
+		return nil, newParseError("Cannot find table: %+v", table.Error)
+	}
 
 	trs := table.FindAll("tr")
+	if len(trs) < 2 {
+		return nil, newParseError("No stocks in table")
+	}
 	trs = trs[1:]
 
-	result := make([]structs.Stock, len(trs))
-	for i, v := range trs {
+	result := make([]structs.Stock, 0, len(trs))
+	for _, v := range trs {
 		tds := v.FindAll("td")
-		name := euckr2utf8(tds[0].Text())
-		id := tds[1].Text()
-		result[i] = structs.Stock{StockID: id, Name: name, MarketType: market}
+		if len(tds) < 2 {
+			return nil, newParseError("Invalid row: %d columns", len(tds))
+		}
+		stock := structs.Stock{
+			StockID:    strings.TrimSpace(tds[1].Text()),
+			Name:       euckr2utf8(tds[0].Text()),
+			MarketType: market,
+			Instrument: structs.InstrumentStock,
+		}
+		// 상세 정보는 없어도 종목은 등록한다
+		if len(tds) > 4 {
+			stock.Industry = strings.TrimSpace(euckr2utf8(tds[2].Text()))
+			stock.Products = truncateRunes(strings.TrimSpace(euckr2utf8(tds[3].Text())), maxProductsLength)
+			stock.ListingDate, _ = commons.ParseTimestamp(kindDateLayout, tds[4].Text())
+		}
+		result = append(result, stock)
 	}
 
-	return result
+	return result, nil
+}
+
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
 }
 
 func euckr2utf8(s string) string {
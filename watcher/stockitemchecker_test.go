@@ -4,12 +4,18 @@ import (
 	"fmt"
 	"testing"
 
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/transform"
+
 	"github.com/helloworldpark/tickle-stock-watcher/database"
 	"github.com/helloworldpark/tickle-stock-watcher/structs"
 )
 
 func TestDownload(t *testing.T) {
-	result := downloadStockSymbols(structs.KOSDAQ)
+	result, err := downloadStockSymbols(structs.KOSDAQ)
+	if err != nil {
+		fmt.Println(err)
+	}
 	for _, v := range result {
 		fmt.Println(v)
 	}
@@ -36,3 +42,41 @@ func TestUpdate(t *testing.T) {
 	stock, ok = checker.StockFromName("CJCGV\n")
 	fmt.Println(ok, stock)
 }
+
+func TestParseStockSymbols(t *testing.T) {
+	html := `<table><tr><th>회사명</th><th>종목코드</th><th>업종</th><th>주요제품</th><th>상장일</th><th>결산월</th></tr>
+<tr><td>삼성전자</td><td>005930</td><td>통신 및 방송 장비 제조업</td><td>IMT2000 서비스용 동기식 기지국,교환국장비,데이터단말기</td><td>1975-06-11</td><td>12월</td></tr>
+<tr><td>테스트</td><td>000001</td></tr></table>`
+	encoded, _, err := transform.String(korean.EUCKR.NewEncoder(), html)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stocks, err := parseStockSymbols(encoded, structs.KOSPI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []structs.Stock{
+		{
+			StockID:     "005930",
+			Name:        "삼성전자",
+			MarketType:  structs.KOSPI,
+			Instrument:  structs.InstrumentStock,
+			Industry:    "통신 및 방송 장비 제조업",
+			Products:    "IMT2000 서비스용 동기식 기지국,교환국장비,데이터단말기",
+			ListingDate: 171644400,
+		},
+		{StockID: "000001", Name: "테스트", MarketType: structs.KOSPI, Instrument: structs.InstrumentStock},
+	}
+	if len(stocks) != len(expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, stocks)
+	}
+	for i := range expected {
+		if stocks[i] != expected[i] {
+			t.Errorf("Expected %+v, got %+v", expected[i], stocks[i])
+		}
+	}
+
+	if _, err := parseStockSymbols("<html></html>", structs.KOSPI); err == nil {
+		t.Error("Expected error without table")
+	}
+}
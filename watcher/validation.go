@@ -0,0 +1,174 @@
+package watcher
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/helloworldpark/tickle-stock-watcher/commons"
+	"github.com/helloworldpark/tickle-stock-watcher/logger"
+	"github.com/helloworldpark/tickle-stock-watcher/structs"
+)
+
+// Reasons of quarantined prices
+const (
+	RejectZeroPrice = "zero price"
+	RejectHigh      = "high below open or close"
+	RejectLow       = "low above open or close"
+	RejectJump      = "jump from the previous close"
+)
+
+// maxDailyChange 가격제한폭 30%를 넘는 변동은 이상치로 본다
+const maxDailyChange = 0.3
+
+// maxQuarantineLines lines of quarantined prices in a summary
+const maxQuarantineLines = 20
+
+// priceValidator checks daily prices before they are stored
+type priceValidator struct {
+	maxChange float64
+	// prevClose last stored close of the stock before the timestamp, 0 if unknown
+	prevClose func(stockID string, before int64) int
+}
+
+// checkPrice reason to reject the price by itself, empty if valid
+func checkPrice(price StockPrice) string {
+	if price.Open <= 0 || price.High <= 0 || price.Low <= 0 || price.Close <= 0 {
+		return RejectZeroPrice
+	}
+	if price.High < commons.MaxInt(price.Open, price.Close) {
+		return RejectHigh
+	}
+	if price.Low > commons.MinInt(price.Open, price.Close) {
+		return RejectLow
+	}
+	return ""
+}
+
+// isJump tells if the close changed more than maxChange from the previous close
+func (v priceValidator) isJump(close, prevClose int) bool {
+	if prevClose <= 0 {
+		return false
+	}
+	return math.Abs(float64(close)/float64(prevClose)-1) > v.maxChange
+}
+
+// validate splits the prices into valid ones and quarantined ones.
+// A jump is rejected only if the next price comes back near the previous close, i.e. a spike.
+// If the next price stays at the jumped level, it is kept as a level shift such as a split.
+func (v priceValidator) validate(prices []StockPrice) ([]StockPrice, []structs.QuarantinedPrice) {
+	sorted := make([]StockPrice, len(prices))
+	copy(sorted, prices)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].StockID != sorted[j].StockID {
+			return sorted[i].StockID < sorted[j].StockID
+		}
+		return sorted[i].Timestamp < sorted[j].Timestamp
+	})
+
+	now := commons.Now().Unix()
+	valid := make([]StockPrice, 0, len(sorted))
+	var rejected []structs.QuarantinedPrice
+	prevClose := 0
+	for i, price := range sorted {
+		if i == 0 || sorted[i-1].StockID != price.StockID {
+			prevClose = 0
+			if v.prevClose != nil {
+				prevClose = v.prevClose(price.StockID, price.Timestamp)
+			}
+		}
+		reason := checkPrice(price)
+		if len(reason) == 0 && v.isJump(price.Close, prevClose) {
+			if i+1 < len(sorted) && sorted[i+1].StockID == price.StockID && !v.isJump(sorted[i+1].Close, prevClose) {
+				reason = RejectJump
+			} else {
+				logger.Warn("[Watcher] %s jumped from %d to %d on %v: kept as a level shift", price.StockID, prevClose, price.Close, commons.Unix(price.Timestamp))
+			}
+		}
+		if len(reason) > 0 {
+			rejected = append(rejected, structs.NewQuarantinedPrice(price, reason, now))
+			continue
+		}
+		valid = append(valid, price)
+		prevClose = price.Close
+	}
+	return valid, rejected
+}
+
+// lastStoredClose last close of the stock stored before the timestamp, 0 if unknown
+func (w *Watcher) lastStoredClose(stockID string, before int64) int {
+	if w.dbClient == nil {
+		return 0
+	}
+	var prices []structs.StockPrice
+	_, err := w.dbClient.Select(&prices, "where StockID=? and Timestamp<? and Close>0 order by Timestamp desc limit 1", stockID, before)
+	if err != nil || len(prices) == 0 {
+		return 0
+	}
+	return prices[0].Close
+}
+
+// insertPrices validates the daily prices, stores the valid ones and quarantines the others.
+// Returns the prices stored.
+func (w *Watcher) insertPrices(prices []StockPrice) ([]StockPrice, error) {
+	validator := priceValidator{maxChange: maxDailyChange, prevClose: w.lastStoredClose}
+	valid, rejected := validator.validate(prices)
+	if len(rejected) > 0 {
+		quarantined := make([]interface{}, len(rejected))
+		for i := range rejected {
+			quarantined[i] = &rejected[i]
+			logger.Warn("[Watcher] Quarantined price of %s on %v: %s", rejected[i].StockID, commons.Unix(rejected[i].Timestamp), rejected[i].Reason)
+		}
+		if _, err := w.dbClient.Upsert(quarantined...); err != nil {
+			logger.Error("[Watcher] Error while quarantining prices: %+v", err)
+		}
+		w.mutex.Lock()
+		w.quarantined = append(w.quarantined, rejected...)
+		w.mutex.Unlock()
+	}
+	if len(valid) == 0 {
+		return nil, nil
+	}
+	stored := make([]interface{}, len(valid))
+	for i := range valid {
+		stored[i] = &valid[i]
+	}
+	if _, err := w.dbClient.BulkInsert(true, stored...); err != nil {
+		return nil, err
+	}
+	return valid, nil
+}
+
+// TakeQuarantineSummary summary of the prices quarantined since the last summary, empty if none
+func (w *Watcher) TakeQuarantineSummary() string {
+	w.mutex.Lock()
+	quarantined := w.quarantined
+	w.quarantined = nil
+	w.mutex.Unlock()
+	if len(quarantined) == 0 {
+		return ""
+	}
+
+	reasons := make(map[string]int)
+	for _, price := range quarantined {
+		reasons[price.Reason]++
+	}
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("[Quarantine] %d prices rejected\n", len(quarantined)))
+	for _, reason := range []string{RejectZeroPrice, RejectHigh, RejectLow, RejectJump} {
+		if reasons[reason] > 0 {
+			buf.WriteString(fmt.Sprintf("    %s: %d\n", reason, reasons[reason]))
+		}
+	}
+	for i, price := range quarantined {
+		if i == maxQuarantineLines {
+			buf.WriteString(fmt.Sprintf("... and %d more\n", len(quarantined)-maxQuarantineLines))
+			break
+		}
+		buf.WriteString(fmt.Sprintf("%s %s O%d H%d L%d C%d: %s\n",
+			price.StockID, commons.Unix(price.Timestamp).Format("2006-01-02"),
+			price.Open, price.High, price.Low, price.Close, price.Reason))
+	}
+	return buf.String()
+}
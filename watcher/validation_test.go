@@ -0,0 +1,62 @@
+package watcher
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestValidatePrices(t *testing.T) {
+	day := int64(24 * 60 * 60)
+	price := func(stockID string, i int64, open, high, low, close int) StockPrice {
+		return StockPrice{StockID: stockID, Timestamp: i * day, Open: open, High: high, Low: low, Close: close, Volume: 100}
+	}
+	prices := []StockPrice{
+		price("005930", 5, 1000, 1010, 990, 1000),
+		price("005930", 1, 1000, 1010, 990, 1000),
+		price("005930", 2, 0, 0, 0, 1000),          // 거래정지
+		price("005930", 3, 1000, 990, 980, 1000),   // 고가 < 종가
+		price("005930", 4, 5000, 5000, 5000, 5000), // 튀는 값
+		price("000660", 1, 1000, 1010, 990, 1000),
+		price("000660", 2, 1000, 1010, 995, 990), // 저가 > 종가
+		price("000660", 3, 200, 210, 190, 200),   // 액면분할처럼 계속 유지
+		price("000660", 4, 200, 210, 190, 205),
+	}
+	validator := priceValidator{
+		maxChange: maxDailyChange,
+		prevClose: func(stockID string, before int64) int { return 1000 },
+	}
+	valid, rejected := validator.validate(prices)
+
+	reasons := make(map[string]string)
+	for _, q := range rejected {
+		reasons[fmt.Sprintf("%s-%d", q.StockID, q.Timestamp/day)] = q.Reason
+	}
+	expected := map[string]string{
+		"005930-2": RejectZeroPrice,
+		"005930-3": RejectHigh,
+		"005930-4": RejectJump,
+		"000660-2": RejectLow,
+	}
+	if len(reasons) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, reasons)
+	}
+	for k, reason := range expected {
+		if reasons[k] != reason {
+			t.Errorf("%s: expected %s, got %s", k, reason, reasons[k])
+		}
+	}
+	if len(valid) != 5 {
+		t.Errorf("Expected 5 valid prices, got %+v", valid)
+	}
+
+	w := New(nil, NewReplaySource(1), 0)
+	w.quarantined = rejected
+	summary := w.TakeQuarantineSummary()
+	if !strings.Contains(summary, "4 prices rejected") || !strings.Contains(summary, RejectJump+": 1") {
+		t.Errorf("Unexpected summary: %s", summary)
+	}
+	if w.TakeQuarantineSummary() != "" {
+		t.Error("Expected an empty summary after taken")
+	}
+}
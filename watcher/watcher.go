@@ -3,7 +3,6 @@ package watcher
 import (
 	"bytes"
 	"fmt"
-	"math/rand"
 	"sort"
 	"sync"
 	"time"
@@ -23,6 +22,14 @@ const CandleTimeUnitSeconds = CandleTimeUnitMinute * 60
 // CandleTimeUnitNanoseconds 하나의 캔들은 15분, 이를 time.Time 구조체로 표현
 const CandleTimeUnitNanoseconds = time.Minute * 15 // 15분
 
+// IntradayBarMinutes 분봉의 단위들
+var IntradayBarMinutes = []int64{1, 5, CandleTimeUnitMinute}
+
+// IntradayRetentionDays 장중 시세는 이 기간만큼만 보관
+const IntradayRetentionDays = 7
+
+var newError = commons.NewTaggedError("Watcher")
+
 // StockPrice is just a simple type alias
 type StockPrice = structs.StockPrice
 
@@ -40,29 +47,81 @@ type WatcherAccess interface {
 
 type internalCrawler struct {
 	lastTimestamp int64
-	sentinel      chan struct{}
+	sentinel      chan struct{} // Closed to stop the watching goroutine
+	running       bool          // Whether a watching goroutine listens to the sentinel
 	ref           *commons.Ref
 }
 
+// stop stops the watching goroutine of the crawler if running, closing the sentinel only once.
+// Returns false if not running. Mutex of the watcher must be locked.
+func (c *internalCrawler) stop() bool {
+	if !c.running {
+		return false
+	}
+	c.running = false
+	close(c.sentinel)
+	return true
+}
+
 // Watcher is a struct for watching the market
 type Watcher struct {
 	crawlers  map[string]*internalCrawler // key: Stock ID, value: last timestamp of the price info and sentinel
 	dbClient  *database.DBClient
+	source    PriceSource
 	sleepTime time.Duration
+	poller    *quotePoller
 	mutex     *sync.Mutex
+
+	historyYears  int            // Years of daily prices to collect, structs.FullHistory for all
+	historyDepths map[string]int // Key: Stock ID, Value: years overriding historyYears
+
+	quarantined []structs.QuarantinedPrice // Quarantined since the last summary
 }
 
-// New creates a new Watcher struct
-func New(dbClient *database.DBClient, sleepingTime time.Duration) *Watcher {
+// New creates a new Watcher struct, which gets prices from source
+func New(dbClient *database.DBClient, source PriceSource, sleepingTime time.Duration) *Watcher {
+	poller := newQuotePoller(source, sleepingTime, defaultQuoteBudget)
+	poller.jitter = 60 * time.Second
 	watcher := Watcher{
 		crawlers:  make(map[string]*internalCrawler),
 		dbClient:  dbClient,
+		source:    source,
 		sleepTime: sleepingTime,
+		poller:    poller,
 		mutex:     &sync.Mutex{},
+
+		historyYears: DefaultHistoryYears,
 	}
 	return &watcher
 }
 
+// SetStartJitter sets the maximum random delay before starting to poll quotes
+func (w *Watcher) SetStartJitter(jitter time.Duration) {
+	w.poller.jitter = jitter
+}
+
+// PollInterval how often quotes are polled
+func (w *Watcher) PollInterval() time.Duration {
+	w.poller.mutex.Lock()
+	defer w.poller.mutex.Unlock()
+	return w.poller.interval
+}
+
+// SetPollInterval sets how often to poll quotes, i.e. more often while replaying faster than the wall clock
+func (w *Watcher) SetPollInterval(interval time.Duration) {
+	w.poller.mutex.Lock()
+	defer w.poller.mutex.Unlock()
+	w.sleepTime = interval
+	w.poller.interval = interval
+}
+
+// SetQuoteBudget sets how many requests per minute may be sent for quotes of every watched stock altogether
+func (w *Watcher) SetQuoteBudget(perMinute int) {
+	w.poller.mutex.Lock()
+	defer w.poller.mutex.Unlock()
+	w.poller.budget = newRequestBudget(perMinute)
+}
+
 func newInternalCrawler(lastTimestamp int64) *internalCrawler {
 	ref := &commons.Ref{}
 	ref.Retain()
@@ -138,12 +197,30 @@ func (w *Watcher) Withdraw(stock Stock) bool {
 		logger.Error("[Watcher] Error while deleting WatchingStock: %+v", err)
 		return false
 	}
-	close(crawler.sentinel)
+	crawler.stop()
 	delete(w.crawlers, stock.StockID)
 	logger.Info("[Watcher] Withdrawal success: no more need to watch or collect %s(%s)", stock.Name, stock.StockID)
 	return true
 }
 
+// Forget stops collecting the stock no longer listed however many need it, and deletes its WatchingStock.
+func (w *Watcher) Forget(stockID string) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if crawler, ok := w.crawlers[stockID]; ok {
+		crawler.stop()
+		delete(w.crawlers, stockID)
+	}
+	_, err := w.dbClient.Delete(WatchingStock{}, "where StockID=?", stockID)
+	if err != nil {
+		logger.Error("[Watcher] Error while deleting WatchingStock of %s: %+v", stockID, err)
+		return false
+	}
+	logger.Info("[Watcher] Forgot stock ID no longer listed: %s", stockID)
+	return true
+}
+
 // StartWatchingStock use it to start watching the market.
 // A channel of StockPrice is returned to get the price info for the given stock id.
 // The channel is valid only for one day, since the channel will be closed after the market closing time.
@@ -152,57 +229,128 @@ func (w *Watcher) StartWatchingStock(stockID string) <-chan StockPrice {
 	w.mutex.Lock()
 	defer w.mutex.Unlock()
 
-	old := w.crawlers[stockID]
-	if old.lastTimestamp < 0 {
-		logger.Warn("[Watcher] Negative last timestamp: %d of stock ID: %s", old.lastTimestamp, stockID)
+	crawler, ok := w.crawlers[stockID]
+	if !ok {
+		logger.Warn("[Watcher] Attempt to watch unregistered stock ID: %s", stockID)
 		return nil
 	}
-	// Prepare new sentinel
-	w.crawlers[stockID] = newInternalCrawler(old.lastTimestamp)
-	// Construct function
+	if crawler.lastTimestamp < 0 {
+		logger.Warn("[Watcher] Negative last timestamp: %d of stock ID: %s", crawler.lastTimestamp, stockID)
+		return nil
+	}
+	// Prepare new sentinel, stopping the previous watching if any
+	crawler.stop()
+	crawler.sentinel = make(chan struct{})
+	crawler.running = true
+	// 시세는 한꺼번에 받아 와서 종목별로 나눠준다
 	out := make(chan StockPrice)
-	sleepTime := w.sleepTime
-	after := time.Second * time.Duration(rand.Int63n(60))
+	feed := w.poller.subscribe(stockID)
+	sentinel := crawler.sentinel
 	commons.InvokeGoroutine("Watcher_StartWatchingStock_"+stockID, func() {
-		afterTimer := time.NewTimer(after)
-		<-afterTimer.C
-		ticker := time.NewTicker(sleepTime)
-		for range ticker.C {
-			if _, ok := w.crawlers[stockID]; !ok {
-				logger.Info("[Watcher] Stock ID already withdrawn: %s", stockID)
-				break
-			}
+		defer w.poller.unsubscribe(stockID, feed)
+		defer close(out)
+		defer logger.Info("[Watcher] Finish StartWatchingStock: %s", stockID)
+		for {
 			select {
-			case out <- CrawlNow(stockID, 0):
-				continue
-			case <-w.crawlers[stockID].sentinel:
+			case price := <-feed:
+				w.storeIntradayPrice(price)
+				select {
+				case out <- price:
+				case <-sentinel:
+					return
+				}
+			case <-sentinel:
 				return
 			}
 		}
-		logger.Info("[Watcher] Finish StartWatchingStock: %s", stockID)
-		close(out)
 	})
 	logger.Info("[Watcher] StartWatchingStock: %s", stockID)
 	return out
 }
 
+// storeIntradayPrice stores the polled quote, to be aggregated into minute bars
+func (w *Watcher) storeIntradayPrice(quote StockPrice) {
+	if w.dbClient == nil {
+		return
+	}
+	intraday := structs.NewIntradayPrice(quote)
+	if _, err := w.dbClient.Upsert(&intraday); err != nil {
+		logger.Error("[Watcher] Error while storing intraday price of %s: %+v", quote.StockID, err)
+	}
+}
+
+// FillIntradayPrices stores the minute bars of the stock on the day before its first polled quote of the day,
+// so that the intraday time frames have no gap when watching started late, i.e. restarted during the session.
+// Returns the number of bars stored.
+func (w *Watcher) FillIntradayPrices(stockID string, day time.Time) (int, error) {
+	y, m, d := day.In(commons.AsiaSeoul).Date()
+	from := time.Date(y, m, d, 0, 0, 0, 0, commons.AsiaSeoul).Unix()
+	until := from + 24*60*60
+	var polled []structs.IntradayPrice
+	if _, err := w.dbClient.Select(&polled, "where StockID=? and Timestamp>=? and Timestamp<? order by Timestamp limit 1", stockID, from, until); err != nil {
+		return 0, err
+	}
+	if len(polled) > 0 {
+		until = polled[0].Timestamp
+	}
+
+	bars, err := w.source.IntradayBars(stockID, day)
+	if err != nil {
+		return 0, err
+	}
+	var intraday []interface{}
+	for _, bar := range bars {
+		if bar.Timestamp >= until {
+			break
+		}
+		price := structs.NewIntradayPrice(bar)
+		intraday = append(intraday, &price)
+	}
+	if len(intraday) == 0 {
+		return 0, nil
+	}
+	if _, err := w.dbClient.BulkUpsert(intraday...); err != nil {
+		return 0, err
+	}
+	logger.Info("[Watcher] Filled %d minute bars of %s on %s", len(intraday), stockID, commons.Unix(from).Format("2006-01-02"))
+	return len(intraday), nil
+}
+
+// PruneIntradayPrices deletes intraday prices older than IntradayRetentionDays
+func (w *Watcher) PruneIntradayPrices() {
+	before := commons.Today().AddDate(0, 0, -IntradayRetentionDays).Unix()
+	if _, err := w.dbClient.Delete(structs.IntradayPrice{}, "where Timestamp<?", before); err != nil {
+		logger.Error("[Watcher] Error while pruning intraday prices: %+v", err)
+		return
+	}
+	logger.Info("[Watcher] Pruned intraday prices before %v", commons.Unix(before))
+}
+
 // StopWatching call it when to stop watching the market.
+// Only the stocks being watched are stopped, i.e. registered indices which no strategy refers to are not.
 func (w *Watcher) StopWatching() {
-	// Send signal to sentinel
-	for k := range w.crawlers {
-		w.StopWatchingStock(k)
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	stopped := 0
+	for _, c := range w.crawlers {
+		if c.stop() {
+			stopped++
+		}
 	}
-	logger.Info("[Watcher] Stop watching %d stocks", len(w.crawlers))
+	logger.Info("[Watcher] Stop watching %d stocks", stopped)
 }
 
 // StopWatchingStock call it when to stop watching the specific stock.
 func (w *Watcher) StopWatchingStock(stockID string) {
-	// Send signal to sentinel
-	if c, ok := w.crawlers[stockID]; ok {
-		c.sentinel <- struct{}{}
-		logger.Info("[Watcher] Stop watching stock ID: %s", stockID)
-	} else {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	c, ok := w.crawlers[stockID]
+	if !ok {
 		logger.Error("[Watcher] Stop watching stock ID(%s) has failed: No crawler found", stockID)
+		return
+	}
+	if c.stop() {
+		logger.Info("[Watcher] Stop watching stock ID: %s", stockID)
 	}
 }
 
@@ -224,24 +372,21 @@ func (w *Watcher) Collect() {
 		}
 	}
 
+	historyStarts := make(map[string]int64)
 	for _, watch := range registeredWatching {
-		sentinel := w.crawlers[watch.StockID].sentinel
-		newCrawler := newInternalCrawler(watch.LastPriceTimestamp)
-		newCrawler.sentinel = sentinel
-		w.crawlers[watch.StockID] = newCrawler
+		historyStarts[watch.StockID] = w.historyStart(watch.StockID)
+		w.crawlers[watch.StockID].lastTimestamp = watch.LastPriceTimestamp
 	}
 	logger.Info("[Watcher] Start Collect %d stocks", len(registeredWatching))
 	w.mutex.Unlock()
 
-	timestampTwoYears := GetCollectionStartingDate(commons.Now().Year() - 2).Unix()
-
 	// Construct function
 	workerFuncGenerator := func(stockID string) workerFunc {
 		f := func() <-chan StockPrice {
 			outResult := make(chan StockPrice)
 			var pivotValue int64
-			if w.crawlers[stockID].lastTimestamp < timestampTwoYears {
-				pivotValue = timestampTwoYears
+			if w.crawlers[stockID].lastTimestamp < historyStarts[stockID] {
+				pivotValue = historyStarts[stockID]
 			} else {
 				pivotValue = w.crawlers[stockID].lastTimestamp
 			}
@@ -262,7 +407,11 @@ func (w *Watcher) Collect() {
 					// 열심히 긁어온 값에서 같은 시간의 데이터를 발견하면 중지한다
 					// 그렇지 않으면 페이지를 늘린다
 					// 그리고 잠시 쉰다
-					collected := CrawlPast(stockID, page)
+					collected, err := w.source.DailyHistory(stockID, page)
+					if err != nil {
+						logger.Error("[Watcher] Error while collecting %s(page %d) from %s: %+v", stockID, page, w.source.Name(), err)
+						break
+					}
 					if len(collected) == 0 {
 						break
 					}
@@ -280,7 +429,6 @@ func (w *Watcher) Collect() {
 					}
 					if shouldGo {
 						page++
-						time.Sleep(w.sleepTime)
 					} else {
 						break
 					}
@@ -309,18 +457,14 @@ func (w *Watcher) Collect() {
 			IsWatching:         true,
 		}
 	}
-	randomGen := rand.New(rand.NewSource(time.Now().UnixNano()))
+	// 요청 간격은 fetcher의 rate limiter가 조절한다
 	for _, watch := range registeredWatching {
 		stockID := watch.StockID
 		worker := workerFuncGenerator(stockID)
+		wg.Add(1)
 		commons.InvokeGoroutine(fmt.Sprintf("watcher_Watcher_Collect_workerFunc_%s", stockID), func() {
 			output(stockID, worker())
 		})
-		wg.Add(1)
-		sleepTime := randomGen.Float64()
-		sleepTime += 0.001
-		duration := time.Duration(sleepTime * float64(time.Second))
-		time.Sleep(duration)
 	}
 	commons.InvokeGoroutine("watcher_Watcher_Collect_dbcollect1", func() {
 		wg.Wait()
@@ -349,7 +493,11 @@ func (w *Watcher) Collect() {
 	buckets[1] = &bucket2
 	activeBucket := 0
 	insertToDb := func(b *[]interface{}) {
-		_, err := w.dbClient.BulkInsert(true, (*b)...)
+		prices := make([]StockPrice, len(*b))
+		for i := range *b {
+			prices[i] = *((*b)[i].(*StockPrice))
+		}
+		_, err := w.insertPrices(prices)
 		if err != nil {
 			logger.Error("[Watcher] Error while Collect: %+v", err)
 		}
@@ -407,7 +555,15 @@ func (w *Watcher) Description() string {
 	}
 
 	addLine("[Watcher] Status \n%v", now)
+	addLine("Source: %v", w.source.Name())
 	addLine("SleepTime: %v", w.sleepTime)
+	w.poller.mutex.Lock()
+	addLine("Quotes: %d stocks, %d stocks per request, %.0f requests per minute", len(w.poller.subscribers), w.poller.batchSize(), w.poller.budget.capacity)
+	addLine("Quote Requests: %d, Deferred: %d", w.poller.requests, w.poller.deferred)
+	w.poller.mutex.Unlock()
+	for _, line := range defaultFetcher.limiter.description() {
+		addLine(line)
+	}
 	addLine("Crawlers")
 	i := 1
 	for stockID, crawler := range w.crawlers {
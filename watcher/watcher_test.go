@@ -14,7 +14,7 @@ import (
 )
 
 func TestWatcher(t *testing.T) {
-	w := watcher.New(nil, time.Millisecond*500)
+	w := watcher.New(nil, watcher.NewNaverSource(), time.Millisecond*500)
 	w.Register(structs.Stock{Name: "Samsung Electronics", StockID: "005930", MarketType: structs.KOSPI})
 	w.Register(structs.Stock{Name: "Korean Air", StockID: "003490", MarketType: structs.KOSPI})
 	w.Register(structs.Stock{Name: "Hanwha Chemicals", StockID: "009830", MarketType: structs.KOSPI})
@@ -57,7 +57,7 @@ func TestCrawlPast(t *testing.T) {
 		structs.WatchingStock{},
 	})
 
-	w := watcher.New(client, time.Millisecond*500)
+	w := watcher.New(client, watcher.NewNaverSource(), time.Millisecond*500)
 	w.Register(structs.Stock{StockID: "271980", MarketType: structs.KOSPI})
 	w.Register(structs.Stock{StockID: "272450", MarketType: structs.KOSPI})
 	w.Register(structs.Stock{StockID: "272550", MarketType: structs.KOSPI})